@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,58 +12,163 @@ import (
 	"time"
 
 	"video-converter/internal/api"
+	"video-converter/internal/auth"
 	"video-converter/internal/config"
+	"video-converter/internal/logger"
+	"video-converter/internal/metrics"
 	"video-converter/internal/storage"
+	"video-converter/internal/tracing"
 	"video-converter/pkg/converter"
+	"video-converter/pkg/disk"
+	"video-converter/pkg/filemanager"
+	"video-converter/pkg/objectstore"
 	"video-converter/pkg/queue"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
+	// 运维子命令
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:]))
+	}
+
 	// 加载配置
 	cfg, err := config.LoadConfig("")
 	if err != nil {
 		log.Fatalf("加载配置失败: %v", err)
 	}
 
+	// 初始化日志
+	logCloser, err := logger.Init(&cfg.Log)
+	if err != nil {
+		log.Fatalf("初始化日志失败: %v", err)
+	}
+	defer logCloser.Close()
+
 	// 验证配置
 	if err := cfg.ValidateConfig(); err != nil {
-		log.Fatalf("配置验证失败: %v", err)
+		fatal("配置验证失败", err)
 	}
 
 	// 设置Gin模式
 	gin.SetMode(cfg.Server.Mode)
 
+	// 初始化链路追踪
+	shutdownTracing, err := tracing.Init(context.Background(), &cfg.Tracing)
+	if err != nil {
+		fatal("初始化链路追踪失败", err)
+	}
+
 	// 初始化数据库连接
-	db, err := storage.NewMySQLDB(cfg.GetDatabaseDSN())
+	db, err := storage.NewMySQLDB(cfg.GetDatabaseDSN(), cfg.Log.Level)
 	if err != nil {
-		log.Fatalf("数据库连接失败: %v", err)
+		fatal("数据库连接失败", err)
 	}
 	defer storage.CloseDB(db)
 
+	// 创建初始管理员账号
+	if err := auth.EnsureAdmin(db, &cfg.Auth.Admin); err != nil {
+		fatal("初始化管理员账号失败", err)
+	}
+
 	// 初始化Redis连接
 	redisClient, err := storage.NewRedisClient(cfg.GetRedisAddr(), cfg.Redis.Password, cfg.Redis.DB)
 	if err != nil {
-		log.Fatalf("Redis连接失败: %v", err)
+		fatal("Redis连接失败", err)
 	}
 	defer redisClient.Close()
 
 	// 创建FFmpeg转换器
 	ffmpegConverter := converter.NewFFmpegConverter(&cfg.FFmpeg)
 
+	// 探测FFmpeg能力，缺少配置的编码器时直接退出，避免任务在运行时才失败
+	probeCtx, cancelProbe := context.WithTimeout(context.Background(), 30*time.Second)
+	caps, err := ffmpegConverter.DetectCapabilities(probeCtx)
+	cancelProbe()
+	if err != nil {
+		fatal("探测FFmpeg能力失败", err)
+	}
+	if err := caps.Require(cfg.FFmpeg.AudioCodec); err != nil {
+		fatal("FFmpeg不满足转换要求", err)
+	}
+	slog.Info("FFmpeg能力探测完成",
+		"ffmpeg_version", caps.FFmpegVersion,
+		"audio_encoders", len(caps.AudioEncoders),
+		"muxers", len(caps.Muxers),
+		"filters", len(caps.Filters),
+	)
+
 	// 创建Redis管理器
 	redisManager := storage.NewRedisManager(redisClient)
 
+	// 创建文件存储
+	storeCtx, cancelStore := context.WithTimeout(context.Background(), 30*time.Second)
+	store, err := objectstore.New(storeCtx, &cfg.Storage)
+	cancelStore()
+	if err != nil {
+		fatal("初始化文件存储失败", err)
+	}
+	slog.Info("文件存储已就绪", "backend", store.Backend())
+
 	// 创建任务处理器
-	taskProcessor := queue.NewTaskProcessor(db, redisManager, ffmpegConverter, cfg.File.OutputDir, 2) // 2个worker
+	taskProcessor := queue.NewTaskProcessor(db, redisManager, ffmpegConverter, store,
+		cfg.File.OutputDir, cfg.File.TempDir, 2) // 2个worker
+
+	// 注册监控指标
+	if cfg.Metrics.Enabled {
+		if err := metrics.RegisterDBCallbacks(db); err != nil {
+			fatal("注册数据库指标回调失败", err)
+		}
+		redisClient.AddHook(metrics.RedisHook{})
+		prometheus.MustRegister(metrics.NewStateCollector(db,
+			func() (int, int, int) {
+				stats := taskProcessor.Stats()
+				return stats.Workers, stats.BusyWorkers, stats.ChannelDepth
+			},
+			map[string]string{
+				"upload": cfg.File.UploadDir,
+				"output": cfg.File.OutputDir,
+				"temp":   cfg.File.TempDir,
+			},
+		))
+	}
+
+	// 注册链路追踪钩子
+	if cfg.Tracing.Enabled {
+		if err := tracing.RegisterDBCallbacks(db); err != nil {
+			fatal("注册数据库追踪回调失败", err)
+		}
+		redisClient.AddHook(tracing.RedisHook{})
+	}
+
+	// 定期检查磁盘剩余空间，空间不足时拒绝新任务、暂停领取任务
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	var diskGuard *disk.Guard
+	if cfg.DiskGuard.Enabled {
+		diskGuard = disk.NewGuard(diskWatermarks(cfg))
+		taskProcessor.SetDiskGuard(diskGuard)
+		go diskGuard.Run(cleanupCtx, time.Duration(cfg.DiskGuard.Interval)*time.Second)
+	}
 
 	// 启动任务处理器
 	taskProcessor.Start()
 	defer taskProcessor.Stop()
 
+	// 定期清理过期的断点续传上传
+	go cleanupTusUploads(cleanupCtx,
+		filemanager.NewFileManager(cfg.File.UploadDir, cfg.File.OutputDir, cfg.File.TempDir), time.Hour)
+
+	// 按保留策略释放过期任务的文件，多实例时通过Redis锁只由一个实例执行
+	if cfg.Retention.Enabled {
+		retention := storage.NewRetentionScheduler(db, redisManager, storage.NewBlobStore(db, store), &cfg.Retention)
+		go retention.Run(cleanupCtx)
+	}
+
 	// 创建API路由
-	router := api.SetupRoutes(cfg, db, redisClient)
+	router := api.SetupRoutes(cfg, db, redisClient, store, diskGuard, taskProcessor, ffmpegConverter)
 
 	// 创建HTTP服务器
 	server := &http.Server{
@@ -74,10 +180,9 @@ func main() {
 
 	// 启动服务器
 	go func() {
-		log.Printf("服务器启动在 http://%s:%s", cfg.Server.Host, cfg.Server.Port)
-		log.Printf("任务处理器已启动，开始监听转换任务...")
+		slog.Info("服务器启动", "addr", fmt.Sprintf("http://%s:%s", cfg.Server.Host, cfg.Server.Port))
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("启动服务器失败: %v", err)
+			fatal("启动服务器失败", err)
 		}
 	}()
 
@@ -85,19 +190,74 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("正在关闭服务器...")
+	slog.Info("正在关闭服务器")
 
-	// 首先停止任务处理器
-	log.Println("正在停止任务处理器...")
+	// 首先停止任务处理器和后台清理
 	taskProcessor.Stop()
+	stopCleanup()
 
 	// 5秒超时的优雅关闭
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("服务器关闭超时:", err)
+		fatal("服务器关闭超时", err)
 	}
 
-	log.Println("服务器已关闭")
+	// 导出剩余的span
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("关闭链路追踪失败", "error", err)
+	}
+
+	slog.Info("服务器已关闭")
+}
+
+// cleanupTusUploads 按固定间隔删除过期的断点续传上传，直到ctx取消
+func cleanupTusUploads(ctx context.Context, fm *filemanager.FileManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := fm.CleanupExpiredTusUploads()
+			if err != nil {
+				slog.Warn("清理过期的断点续传上传失败", "error", err)
+			} else if removed > 0 {
+				slog.Info("已清理过期的断点续传上传", "count", removed)
+			}
+		}
+	}
+}
+
+// diskWatermarks 按配置生成各目录的水位，未配置水位的目录不检查
+func diskWatermarks(cfg *config.Config) []disk.Watermark {
+	dirs := map[string]string{
+		"upload": cfg.File.UploadDir,
+		"output": cfg.File.OutputDir,
+		"temp":   cfg.File.TempDir,
+	}
+
+	var watermarks []disk.Watermark
+	for _, name := range []string{"upload", "output", "temp"} {
+		wm, ok := cfg.DiskGuard.Watermarks[name]
+		if !ok {
+			continue
+		}
+		watermarks = append(watermarks, disk.Watermark{
+			Name:     name,
+			Path:     dirs[name],
+			Low:      uint64(wm.LowMB) * 1024 * 1024,
+			Critical: uint64(wm.CriticalMB) * 1024 * 1024,
+		})
+	}
+	return watermarks
+}
+
+// fatal 记录错误日志并退出进程
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
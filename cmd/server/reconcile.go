@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"video-converter/internal/config"
+	"video-converter/internal/logger"
+	"video-converter/internal/storage"
+	"video-converter/pkg/objectstore"
+)
+
+// runReconcile reconcile 子命令：对比存储中的文件与任务记录，结果以JSON输出到标准输出
+//
+//	server reconcile [-config path] [-dry-run] [-quarantine] [-repair]
+func runReconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	configPath := flags.String("config", "", "配置文件路径，默认查找 ./config.yaml")
+	var opts storage.ReconcileOptions
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "只报告将要执行的操作，不修改存储和数据库")
+	flags.BoolVar(&opts.Quarantine, "quarantine", false, "将孤立文件移到隔离目录")
+	flags.BoolVar(&opts.Repair, "repair", false, "修复悬空引用和引用计数")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+	// 日志（包括SQL日志）输出到标准错误，标准输出只保留对账结果
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logger.ParseLevel(cfg.Log.Level)})))
+	if err := cfg.ValidateConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "配置验证失败: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := storage.NewMySQLDB(cfg.GetDatabaseDSN(), cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "数据库连接失败: %v\n", err)
+		return 1
+	}
+	defer storage.CloseDB(db)
+
+	redisClient, err := storage.NewRedisClient(cfg.GetRedisAddr(), cfg.Redis.Password, cfg.Redis.DB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Redis连接失败: %v\n", err)
+		return 1
+	}
+	defer redisClient.Close()
+
+	storeCtx, cancelStore := context.WithTimeout(ctx, 30*time.Second)
+	store, err := objectstore.New(storeCtx, &cfg.Storage)
+	cancelStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "初始化文件存储失败: %v\n", err)
+		return 1
+	}
+
+	reconciler := storage.NewReconciler(db, storage.NewRedisManager(redisClient), store, &cfg.File, &cfg.Reconcile)
+	report, err := reconciler.Run(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "存储对账失败: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(os.Stderr, "输出对账结果失败: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -12,6 +12,7 @@ CREATE TABLE IF NOT EXISTS users (
     password VARCHAR(255) NOT NULL,
     avatar VARCHAR(500),
     is_active BOOLEAN DEFAULT TRUE,
+    role VARCHAR(20) DEFAULT 'user',
     task_count INT DEFAULT 0,
     completed_count INT DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
@@ -20,6 +21,7 @@ CREATE TABLE IF NOT EXISTS users (
     
     INDEX idx_users_username (username),
     INDEX idx_users_email (email),
+    INDEX idx_users_role (role),
     INDEX idx_users_deleted_at (deleted_at)
 );
 
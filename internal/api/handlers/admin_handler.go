@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"video-converter/internal/logger"
+	"video-converter/internal/model"
+	"video-converter/internal/storage"
+	"video-converter/pkg/filemanager"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler 管理后台处理器
+type AdminHandler struct {
+	*BaseHandler
+	fileManager  *filemanager.FileManager
+	redisManager *storage.RedisManager
+	blobStore    *storage.BlobStore
+	reconciler   *storage.Reconciler
+	retention    *storage.RetentionScheduler
+}
+
+// StorageCleanupRequest 存储清理请求
+// temp 按时长删除临时目录中的文件；上传和输出文件可能仍被任务引用或与其他任务共享，
+// 只能通过 retention 立即执行一轮保留策略清理，按任务状态释放
+type StorageCleanupRequest struct {
+	Target      string `json:"target" binding:"required,oneof=temp retention"`                  // 清理目标
+	MaxAgeHours int    `json:"max_age_hours" binding:"required_if=Target temp,omitempty,min=1"` // 超过该时长的临时文件会被删除
+}
+
+// NewAdminHandler 创建管理后台处理器
+func NewAdminHandler(deps *Dependencies) *AdminHandler {
+	fm := filemanager.NewFileManager(
+		deps.Config.File.UploadDir,
+		deps.Config.File.OutputDir,
+		deps.Config.File.TempDir,
+	)
+
+	redisManager := storage.NewRedisManager(deps.Redis)
+	blobStore := storage.NewBlobStore(deps.DB, deps.Storage)
+	return &AdminHandler{
+		BaseHandler:  NewBaseHandler(deps),
+		fileManager:  fm,
+		redisManager: redisManager,
+		blobStore:    blobStore,
+		reconciler: storage.NewReconciler(deps.DB, redisManager, deps.Storage,
+			&deps.Config.File, &deps.Config.Reconcile),
+		retention: storage.NewRetentionScheduler(deps.DB, redisManager, blobStore, &deps.Config.Retention),
+	}
+}
+
+// ListUsers 用户列表
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	query := h.dbCtx(c).Model(&model.User{})
+
+	// 可选过滤条件
+	if keyword := c.Query("q"); keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("username LIKE ? OR email LIKE ?", like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if active := c.Query("is_active"); active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			h.ValidationError(c, "is_active参数格式错误")
+			return
+		}
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	var users []model.User
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&users).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取用户列表成功", NewPaginationResponse(users, total, page, perPage))
+}
+
+// SuspendUser 停用用户
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	h.setUserActive(c, false)
+}
+
+// ActivateUser 启用用户
+func (h *AdminHandler) ActivateUser(c *gin.Context) {
+	h.setUserActive(c, true)
+}
+
+// setUserActive 更新用户启用状态
+func (h *AdminHandler) setUserActive(c *gin.Context, active bool) {
+	userID := c.Param("id")
+	if userID == h.currentUserID(c) {
+		h.ValidationError(c, "不能修改自己的账号状态")
+		return
+	}
+
+	var user model.User
+	if err := h.dbCtx(c).First(&user, "id = ?", userID).Error; err != nil {
+		h.NotFoundError(c, "用户不存在")
+		return
+	}
+
+	if err := h.dbCtx(c).Model(&user).Update("is_active", active).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	action := model.AuditActionUserSuspend
+	message := "用户已停用"
+	if active {
+		action = model.AuditActionUserActivate
+		message = "用户已启用"
+	}
+	h.audit(c, action, "user", user.ID, gin.H{"username": user.Username})
+
+	h.SuccessResponse(c, http.StatusOK, message, gin.H{
+		"user_id":   user.ID,
+		"is_active": active,
+	})
+}
+
+// ListTasks 跨用户任务列表
+func (h *AdminHandler) ListTasks(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	query := h.dbCtx(c).Model(&model.ConversionTask{})
+
+	// 可选过滤条件
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if taskType := c.Query("type"); taskType != "" {
+		query = query.Where("type = ?", taskType)
+	}
+	if keyword := c.Query("q"); keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("title LIKE ? OR original_name LIKE ? OR original_url LIKE ?", like, like, like)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			h.ValidationError(c, "from参数需为RFC3339时间格式")
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			h.ValidationError(c, "to参数需为RFC3339时间格式")
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	var tasks []model.ConversionTask
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&tasks).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取任务列表成功", NewPaginationResponse(tasks, total, page, perPage))
+}
+
+// CancelTask 强制取消任务（正在处理的任务会终止FFmpeg进程）
+func (h *AdminHandler) CancelTask(c *gin.Context) {
+	var task model.ConversionTask
+	if err := h.dbCtx(c).First(&task, "id = ?", c.Param("id")).Error; err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
+
+	if !task.CanCancel() {
+		h.ErrorResponse(c, http.StatusBadRequest, "任务当前状态不允许取消", nil)
+		return
+	}
+
+	// 先以状态为条件改为已取消，worker只在任务仍处于处理中时写入结果，不会覆盖取消
+	result := h.dbCtx(c).Model(&task).
+		Where("status = ?", task.Status).
+		Updates(map[string]interface{}{
+			"status":     model.TaskStatusCanceled,
+			"updated_at": time.Now(),
+			"expires_at": nil, // 由保留策略按取消时间重新计算
+		})
+	if result.Error != nil {
+		h.InternalError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.ErrorResponse(c, http.StatusConflict, "任务状态已变化，请刷新后重试", nil)
+		return
+	}
+	h.redisManager.SetTaskStatus(c.Request.Context(), task.ID, string(model.TaskStatusCanceled))
+
+	// 中断正在进行的处理
+	killed := false
+	if h.processor != nil {
+		killed = h.processor.CancelTask(task.ID)
+	}
+
+	h.audit(c, model.AuditActionTaskCancel, "task", task.ID, gin.H{
+		"previous_status": task.Status,
+		"worker_killed":   killed,
+	})
+
+	h.SuccessResponse(c, http.StatusOK, "任务已强制取消", gin.H{
+		"task_id":       task.ID,
+		"status":        string(model.TaskStatusCanceled),
+		"worker_killed": killed,
+	})
+}
+
+// RequeueTask 将任务重新放入队列
+func (h *AdminHandler) RequeueTask(c *gin.Context) {
+	var task model.ConversionTask
+	if err := h.dbCtx(c).First(&task, "id = ?", c.Param("id")).Error; err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
+
+	if task.Status == model.TaskStatusProcessing || task.Status == model.TaskStatusQueued {
+		h.ErrorResponse(c, http.StatusConflict, "任务正在排队或处理中，无需重新排队", nil)
+		return
+	}
+
+	if task.InputPath == "" {
+		h.ErrorResponse(c, http.StatusConflict, "任务输入文件不存在，无法重新排队", nil)
+		return
+	}
+	if _, err := h.store.Stat(c.Request.Context(), task.InputPath); err != nil {
+		h.ErrorResponse(c, http.StatusConflict, "任务输入文件不存在，无法重新排队", nil)
+		return
+	}
+
+	// 以状态为条件更新，与保留策略清理或并发的取消竞争时只有一方生效，避免重复释放旧输出
+	previousStatus, previousOutput := task.Status, task.OutputPath
+	result := h.dbCtx(c).Model(&task).
+		Where("status = ?", previousStatus).
+		Updates(map[string]interface{}{
+			"status":        model.TaskStatusQueued,
+			"progress":      0,
+			"error_message": "",
+			"output_path":   "",
+			"output_size":   0,
+			"output_hash":   "",
+			"updated_at":    time.Now(),
+			"expires_at":    nil,
+		})
+	if result.Error != nil {
+		h.InternalError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.ErrorResponse(c, http.StatusConflict, "任务状态已变化，请刷新后重试", nil)
+		return
+	}
+
+	// 重新转换会生成新的输出，释放对旧输出的引用
+	if err := h.blobStore.Release(c.Request.Context(), previousOutput); err != nil {
+		slog.WarnContext(logger.WithTaskID(c.Request.Context(), task.ID), "删除旧输出文件失败", "path", previousOutput, "error", err)
+	}
+
+	ctx := c.Request.Context()
+	h.redisManager.SetTaskStatus(ctx, task.ID, string(model.TaskStatusQueued))
+	h.redisManager.SetTaskProgress(ctx, task.ID, 0)
+
+	// 直接交给任务处理器，队列已满时由扫描器稍后处理
+	// 重新读取更新后的任务交给worker，避免与构造响应并发读写
+	if h.processor != nil {
+		var queued model.ConversionTask
+		if err := h.dbCtx(c).First(&queued, "id = ?", task.ID).Error; err == nil {
+			h.processor.AddTask(context.WithoutCancel(ctx), &queued)
+		}
+	}
+
+	h.audit(c, model.AuditActionTaskRequeue, "task", task.ID, gin.H{"previous_status": previousStatus})
+
+	h.SuccessResponse(c, http.StatusOK, "任务已重新排队", gin.H{
+		"task_id": task.ID,
+		"status":  string(model.TaskStatusQueued),
+	})
+}
+
+// DeleteTask 删除任务及其文件
+func (h *AdminHandler) DeleteTask(c *gin.Context) {
+	var task model.ConversionTask
+	if err := h.dbCtx(c).First(&task, "id = ?", c.Param("id")).Error; err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
+
+	// 正在处理的任务先终止
+	if task.Status == model.TaskStatusProcessing && h.processor != nil {
+		h.processor.CancelTask(task.ID)
+	}
+
+	// 文件可能与其他任务共享，释放引用，最后一个引用释放时才删除
+	for _, path := range []string{task.InputPath, task.OutputPath} {
+		if err := h.blobStore.Release(c.Request.Context(), path); err != nil {
+			slog.WarnContext(logger.WithTaskID(c.Request.Context(), task.ID), "删除任务文件失败", "path", path, "error", err)
+		}
+	}
+
+	h.redisManager.DeleteTaskData(c.Request.Context(), task.ID)
+
+	if err := h.dbCtx(c).Where("task_id = ?", task.ID).Delete(&model.ShareLink{}).Error; err != nil {
+		slog.WarnContext(logger.WithTaskID(c.Request.Context(), task.ID), "删除分享链接失败", "error", err)
+	}
+	if err := h.dbCtx(c).Delete(&task).Error; err != nil {
+		h.InternalError(c, fmt.Errorf("删除任务记录失败: %v", err))
+		return
+	}
+
+	h.audit(c, model.AuditActionTaskDelete, "task", task.ID, gin.H{
+		"user_id": task.UserID,
+		"status":  task.Status,
+		"title":   task.Title,
+	})
+
+	h.SuccessResponse(c, http.StatusOK, "任务已删除", gin.H{"task_id": task.ID})
+}
+
+// SystemStatus 系统状态（队列深度、worker状态、任务统计）
+func (h *AdminHandler) SystemStatus(c *gin.Context) {
+	// 按状态统计任务数量
+	var rows []struct {
+		Status model.TaskStatus
+		Count  int64
+	}
+	if err := h.dbCtx(c).Model(&model.ConversionTask{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	tasksByStatus := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		tasksByStatus[string(row.Status)] = row.Count
+	}
+
+	data := gin.H{
+		"queue_depth":     tasksByStatus[string(model.TaskStatusQueued)],
+		"tasks_by_status": tasksByStatus,
+	}
+
+	if h.processor != nil {
+		data["processor"] = h.processor.Stats()
+	}
+
+	// 各存储目录占用
+	storageUsage := gin.H{}
+	for name, dir := range h.storageDirs() {
+		size, err := h.fileManager.GetDirectorySize(dir)
+		if err != nil {
+			storageUsage[name] = gin.H{"path": dir, "error": err.Error()}
+			continue
+		}
+		storageUsage[name] = gin.H{"path": dir, "size": size, "size_text": filemanager.FormatFileSize(size)}
+	}
+	data["storage"] = storageUsage
+
+	if h.diskGuard != nil {
+		data["disk_guard"] = gin.H{
+			"level":       h.diskGuard.Level().String(),
+			"directories": h.diskGuard.Statuses(),
+		}
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取系统状态成功", data)
+}
+
+// CleanupStorage 清理临时目录中的过期文件，或立即执行一轮保留策略清理
+func (h *AdminHandler) CleanupStorage(c *gin.Context) {
+	var req StorageCleanupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ValidationError(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+
+	if req.Target == "retention" {
+		h.runRetention(c)
+		return
+	}
+
+	dir := h.cfg.File.TempDir
+
+	before, _ := h.fileManager.GetDirectorySize(dir)
+	if err := h.fileManager.CleanupExpiredFiles(dir, time.Duration(req.MaxAgeHours)*time.Hour); err != nil {
+		h.InternalError(c, fmt.Errorf("清理目录失败: %v", err))
+		return
+	}
+	after, _ := h.fileManager.GetDirectorySize(dir)
+
+	// 立即更新水位，清理出空间后不必等到下一次定期检查才恢复接受任务
+	if h.diskGuard != nil {
+		h.diskGuard.Check()
+	}
+
+	freed := before - after
+	if freed < 0 {
+		freed = 0
+	}
+
+	h.audit(c, model.AuditActionStorageCleanup, "storage", req.Target, gin.H{
+		"max_age_hours": req.MaxAgeHours,
+		"freed_bytes":   freed,
+	})
+
+	h.SuccessResponse(c, http.StatusOK, "存储清理完成", gin.H{
+		"target":      req.Target,
+		"freed_bytes": freed,
+		"freed_text":  filemanager.FormatFileSize(freed),
+	})
+}
+
+// runRetention 立即执行一轮保留策略清理，与定期执行的清理共用同一把锁
+func (h *AdminHandler) runRetention(c *gin.Context) {
+	if !h.cfg.Retention.Enabled {
+		h.ErrorResponse(c, http.StatusBadRequest, "未启用保留策略，无法清理上传和输出文件", nil)
+		return
+	}
+
+	result, err := h.retention.RunOnce(c.Request.Context())
+	if errors.Is(err, storage.ErrRetentionRunning) {
+		h.ErrorResponse(c, http.StatusConflict, "保留策略清理正在执行，请稍后重试", nil)
+		return
+	}
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	if h.diskGuard != nil {
+		h.diskGuard.Check()
+	}
+
+	h.audit(c, model.AuditActionStorageCleanup, "storage", "retention", gin.H{
+		"released_inputs": result.ReleasedInputs,
+		"expired_tasks":   result.ExpiredTasks,
+	})
+
+	h.SuccessResponse(c, http.StatusOK, "保留策略清理完成", gin.H{
+		"target":          "retention",
+		"released_inputs": result.ReleasedInputs,
+		"expired_tasks":   result.ExpiredTasks,
+	})
+}
+
+// ReconcileStorage 对比存储中的文件与任务记录，报告孤立文件和悬空引用
+// 请求体可省略，默认只报告；dry_run 时只报告将要执行的隔离和修复操作
+func (h *AdminHandler) ReconcileStorage(c *gin.Context) {
+	var opts storage.ReconcileOptions
+	if err := c.ShouldBindJSON(&opts); err != nil && !errors.Is(err, io.EOF) {
+		h.ValidationError(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+
+	report, err := h.reconciler.Run(c.Request.Context(), opts)
+	if err != nil {
+		h.InternalError(c, fmt.Errorf("存储对账失败: %v", err))
+		return
+	}
+
+	// 隔离文件后立即更新水位
+	if h.diskGuard != nil && opts.Quarantine && !opts.DryRun {
+		h.diskGuard.Check()
+	}
+
+	if !opts.DryRun && (opts.Quarantine || opts.Repair) {
+		h.audit(c, model.AuditActionStorageReconcile, "storage", h.store.Backend(), gin.H{
+			"quarantine":   opts.Quarantine,
+			"repair":       opts.Repair,
+			"counts":       report.Counts,
+			"orphan_bytes": report.OrphanBytes,
+		})
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "存储对账完成", report)
+}
+
+// ListAuditLogs 审计日志列表
+func (h *AdminHandler) ListAuditLogs(c *gin.Context) {
+	page, perPage := parsePagination(c)
+
+	query := h.dbCtx(c).Model(&model.AuditLog{})
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	var logs []model.AuditLog
+	if err := query.Order("id DESC").
+		Offset((page - 1) * perPage).
+		Limit(perPage).
+		Find(&logs).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取审计日志成功", NewPaginationResponse(logs, total, page, perPage))
+}
+
+// storageDirs 系统状态中统计占用的存储目录
+func (h *AdminHandler) storageDirs() map[string]string {
+	return map[string]string{
+		"upload": h.cfg.File.UploadDir,
+		"output": h.cfg.File.OutputDir,
+		"temp":   h.cfg.File.TempDir,
+	}
+}
+
+// audit 记录管理操作审计日志
+func (h *AdminHandler) audit(c *gin.Context, action model.AuditAction, targetType, targetID string, detail gin.H) {
+	entry := &model.AuditLog{
+		ActorID:    h.currentUserID(c),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		ClientIP:   c.ClientIP(),
+		CreatedAt:  time.Now(),
+	}
+	if user := h.currentUser(c); user != nil {
+		entry.ActorName = user.Username
+	}
+	if detail != nil {
+		if data, err := json.Marshal(detail); err == nil {
+			entry.Detail = string(data)
+		}
+	}
+
+	// 审计写入失败不影响操作结果，但需要留下日志
+	if err := h.db.WithContext(context.Background()).Create(entry).Error; err != nil {
+		slog.ErrorContext(c.Request.Context(), "写入审计日志失败", "action", action, "target", targetID, "error", err)
+	}
+}
+
+// parsePagination 解析分页参数
+func parsePagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	return page, perPage
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+	"video-converter/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAdminTestRouter 创建管理后台处理器，上传、输出和临时目录位于测试临时目录中
+// retention 为nil时不启用保留策略
+func newAdminTestRouter(t *testing.T, retention *config.RetentionConfig) (*gin.Engine, *Dependencies) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	if retention != nil {
+		cfg.Retention = *retention
+	}
+	cfg.File.UploadDir = filepath.Join(dir, "uploads")
+	cfg.File.OutputDir = filepath.Join(dir, "outputs")
+	cfg.File.TempDir = filepath.Join(dir, "temp")
+	deps, _ := newTestDeps(t, cfg)
+
+	handler := NewAdminHandler(deps)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", "admin") })
+	router.POST("/api/v1/admin/storage/cleanup", handler.CleanupStorage)
+	return router, deps
+}
+
+// postCleanup 调用存储清理接口
+func postCleanup(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/storage/cleanup", stringReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// writeAgedFile 创建修改时间在 age 之前的文件
+func writeAgedFile(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanupStorage(t *testing.T) {
+	router, deps := newAdminTestRouter(t, nil)
+	cfg := deps.Config
+
+	oldTemp := filepath.Join(cfg.File.TempDir, "old.tmp")
+	newTemp := filepath.Join(cfg.File.TempDir, "new.tmp")
+	upload := filepath.Join(cfg.File.UploadDir, "queued.mp4")
+	output := filepath.Join(cfg.File.OutputDir, "completed.mp3")
+	writeAgedFile(t, oldTemp, 48*time.Hour)
+	writeAgedFile(t, newTemp, 0)
+	writeAgedFile(t, upload, 48*time.Hour)
+	writeAgedFile(t, output, 48*time.Hour)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "上传目录不能按时长清理", body: `{"target":"upload","max_age_hours":1}`, want: http.StatusBadRequest},
+		{name: "输出目录不能按时长清理", body: `{"target":"output","max_age_hours":1}`, want: http.StatusBadRequest},
+		{name: "缺少时长", body: `{"target":"temp"}`, want: http.StatusBadRequest},
+		{name: "未启用保留策略", body: `{"target":"retention"}`, want: http.StatusBadRequest},
+		{name: "清理临时目录", body: `{"target":"temp","max_age_hours":24}`, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postCleanup(router, tt.body); w.Code != tt.want {
+				t.Errorf("状态码 = %d，应为 %d，响应: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	for path, want := range map[string]bool{oldTemp: false, newTemp: true, upload: true, output: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s 存在 = %v，应为 %v", filepath.Base(path), err == nil, want)
+		}
+	}
+}
+
+func TestCleanupStorageRetention(t *testing.T) {
+	router, deps := newAdminTestRouter(t, &config.RetentionConfig{
+		Enabled:             true,
+		Interval:            3600,
+		BatchSize:           10,
+		ConvertedInputHours: 1,
+	})
+	cfg := deps.Config
+
+	// 已转换超过保留时长的任务释放输入，排队中的任务即使文件很旧也不受影响
+	convertedInput := filepath.Join(cfg.File.UploadDir, "converted.mp4")
+	queuedInput := filepath.Join(cfg.File.UploadDir, "queued.mp4")
+	expiredOutput := filepath.Join(cfg.File.OutputDir, "expired.mp3")
+	for _, path := range []string{convertedInput, queuedInput, expiredOutput} {
+		writeAgedFile(t, path, 48*time.Hour)
+	}
+
+	past := time.Now().Add(-2 * time.Hour)
+	tasks := []model.ConversionTask{
+		{ID: "converted", UserID: "user", Status: model.TaskStatusCompleted, InputPath: convertedInput, UpdatedAt: past},
+		{ID: "queued", UserID: "user", Status: model.TaskStatusQueued, InputPath: queuedInput, UpdatedAt: past},
+		{ID: "expired", UserID: "user", Status: model.TaskStatusCompleted, OutputPath: expiredOutput, UpdatedAt: time.Now(), ExpiresAt: &past},
+	}
+	for i := range tasks {
+		if err := deps.DB.Create(&tasks[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := postCleanup(router, `{"target":"retention"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d，响应: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data storage.RetentionResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.ReleasedInputs != 1 || resp.Data.ExpiredTasks != 1 {
+		t.Errorf("清理结果 = %+v，应释放1个输入、过期1个任务", resp.Data)
+	}
+
+	for path, want := range map[string]bool{convertedInput: false, queuedInput: true, expiredOutput: false} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s 存在 = %v，应为 %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	var expired model.ConversionTask
+	deps.DB.First(&expired, "id = ?", "expired")
+	if expired.Status != model.TaskStatusExpired {
+		t.Errorf("过期任务状态 = %s，应为 expired", expired.Status)
+	}
+}
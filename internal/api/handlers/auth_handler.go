@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"video-converter/internal/auth"
+	"video-converter/internal/logger"
+	"video-converter/internal/model"
+	"video-converter/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// AuthHandler 认证处理器
+type AuthHandler struct {
+	*BaseHandler
+	redisManager *storage.RedisManager
+	oidc         *auth.OIDCProvider
+}
+
+// oidcLoginState OIDC登录过程中暂存的状态
+type oidcLoginState struct {
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Redirect     string `json:"redirect"`
+}
+
+// oidcStateTTL 授权流程必须在该时间内完成
+const oidcStateTTL = 10 * time.Minute
+
+// RegisterRequest 注册请求
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"` // 用户名或邮箱
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse 登录响应
+type LoginResponse struct {
+	Token        string      `json:"token"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	User         *model.User `json:"user"`
+	ClaimedTasks int64       `json:"claimed_tasks"` // 从匿名会话认领的任务数
+}
+
+// NewAuthHandler 创建认证处理器
+func NewAuthHandler(deps *Dependencies) *AuthHandler {
+	return &AuthHandler{
+		BaseHandler:  NewBaseHandler(deps),
+		redisManager: storage.NewRedisManager(deps.Redis),
+		oidc:         deps.OIDC,
+	}
+}
+
+// Providers 获取可用的登录方式
+func (h *AuthHandler) Providers(c *gin.Context) {
+	providers := []gin.H{
+		{"type": model.AuthProviderLocal, "name": "账号密码登录"},
+	}
+	if h.oidc != nil {
+		providers = append(providers, gin.H{
+			"type":      "oidc",
+			"name":      h.oidc.DisplayName(),
+			"login_url": "/api/v1/auth/oidc/login",
+		})
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取登录方式成功", providers)
+}
+
+// Register 注册本地账号
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ValidationError(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	// 检查用户名和邮箱是否已被占用
+	var count int64
+	if err := h.dbCtx(c).Model(&model.User{}).
+		Where("username = ? OR email = ?", req.Username, req.Email).
+		Count(&count).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+	if count > 0 {
+		h.ErrorResponse(c, http.StatusConflict, "用户名或邮箱已被注册", nil)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	user := &model.User{
+		ID:           uuid.New().String(),
+		Username:     req.Username,
+		Email:        req.Email,
+		Password:     hash,
+		IsActive:     true,
+		Role:         model.UserRoleUser,
+		AuthProvider: model.AuthProviderLocal,
+	}
+	if err := h.dbCtx(c).Create(user).Error; err != nil {
+		h.InternalError(c, fmt.Errorf("创建用户失败: %v", err))
+		return
+	}
+
+	response, err := h.issueSession(c, user)
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	// 注册前以匿名身份创建的任务归入新账号
+	response.ClaimedTasks = h.claimAnonymousTasks(c, user.ID)
+
+	h.SuccessResponse(c, http.StatusCreated, "注册成功", response)
+}
+
+// Login 本地账号登录
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ValidationError(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+
+	identifier := strings.TrimSpace(req.Username)
+
+	var user model.User
+	err := h.dbCtx(c).Where("username = ? OR email = ?", identifier, strings.ToLower(identifier)).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.UnauthorizedError(c, "用户名或密码错误")
+			return
+		}
+		h.InternalError(c, err)
+		return
+	}
+
+	if !auth.CheckPassword(user.Password, req.Password) {
+		h.UnauthorizedError(c, "用户名或密码错误")
+		return
+	}
+
+	if !user.IsActive {
+		h.ForbiddenError(c, "账号已被停用")
+		return
+	}
+
+	response, err := h.issueSession(c, &user)
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+	response.ClaimedTasks = h.claimAnonymousTasks(c, user.ID)
+
+	h.SuccessResponse(c, http.StatusOK, "登录成功", response)
+}
+
+// Logout 退出登录
+func (h *AuthHandler) Logout(c *gin.Context) {
+	token := c.GetString("session_token")
+	if token != "" {
+		h.redisManager.DeleteSession(c.Request.Context(), token)
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "已退出登录", nil)
+}
+
+// Me 获取当前登录用户信息
+func (h *AuthHandler) Me(c *gin.Context) {
+	user := h.currentUser(c)
+	if user == nil {
+		h.UnauthorizedError(c, "请先登录")
+		return
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取用户信息成功", user)
+}
+
+// ClaimTasks 将当前匿名会话创建的任务认领到登录账号
+func (h *AuthHandler) ClaimTasks(c *gin.Context) {
+	if c.GetString("anonymous_id") == "" {
+		h.ValidationError(c, "当前请求没有匿名会话")
+		return
+	}
+
+	claimed := h.claimAnonymousTasks(c, h.currentUserID(c))
+
+	h.SuccessResponse(c, http.StatusOK, "任务认领完成", gin.H{
+		"claimed_tasks": claimed,
+	})
+}
+
+// claimAnonymousTasks 把匿名会话拥有的任务转移给指定用户，返回转移数量
+func (h *AuthHandler) claimAnonymousTasks(c *gin.Context, userID string) int64 {
+	anonymousID := c.GetString("anonymous_id")
+	if anonymousID == "" {
+		return 0
+	}
+
+	// 登录、注册时context中尚无用户ID
+	ctx := logger.WithUserID(c.Request.Context(), userID)
+	result := h.dbCtx(c).Model(&model.ConversionTask{}).
+		Where("user_id = ? AND anonymous_id = ?", defaultUserID, anonymousID).
+		Updates(map[string]interface{}{
+			"user_id":      userID,
+			"anonymous_id": "",
+		})
+	if result.Error != nil {
+		slog.ErrorContext(ctx, "认领匿名任务失败", "error", result.Error)
+		return 0
+	}
+
+	if result.RowsAffected > 0 {
+		h.dbCtx(c).Model(&model.User{}).Where("id = ?", userID).
+			UpdateColumn("task_count", gorm.Expr("task_count + ?", result.RowsAffected))
+		slog.InfoContext(ctx, "认领匿名任务", "count", result.RowsAffected)
+	}
+
+	return result.RowsAffected
+}
+
+// issueSession 为用户创建登录会话
+func (h *AuthHandler) issueSession(c *gin.Context, user *model.User) (*LoginResponse, error) {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := auth.SessionTTL(&h.cfg.Auth)
+	if err := h.redisManager.SetSession(c.Request.Context(), token, user.ID, ttl); err != nil {
+		return nil, fmt.Errorf("保存会话失败: %v", err)
+	}
+
+	return &LoginResponse{
+		Token:     token,
+		ExpiresAt: time.Now().Add(ttl),
+		User:      user,
+	}, nil
+}
+
+// OIDCLogin 跳转到IdP进行单点登录
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if h.oidc == nil {
+		h.NotFoundError(c, "未启用单点登录")
+		return
+	}
+
+	state, err := auth.GenerateToken()
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+	nonce, err := auth.GenerateToken()
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	loginState := oidcLoginState{
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Redirect:     safeRedirect(c.Query("redirect"), h.oidc.PostLoginRedirect()),
+	}
+	data, err := json.Marshal(loginState)
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.redisManager.SetCacheWithExpiry(ctx, "oidc_state:"+state, string(data), oidcStateTTL); err != nil {
+		h.InternalError(c, fmt.Errorf("保存登录状态失败: %v", err))
+		return
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(ctx, state, nonce, loginState.CodeVerifier)
+	if err != nil {
+		h.ErrorResponse(c, http.StatusBadGateway, "身份提供方暂不可用", err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback IdP授权回调
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.oidc == nil {
+		h.NotFoundError(c, "未启用单点登录")
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		h.UnauthorizedError(c, "单点登录失败: "+errCode+" "+c.Query("error_description"))
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		h.ValidationError(c, "缺少state或code参数")
+		return
+	}
+
+	// state只能使用一次
+	ctx := c.Request.Context()
+	raw, err := h.redisManager.PopCache(ctx, "oidc_state:"+state)
+	if err != nil {
+		h.UnauthorizedError(c, "登录请求已过期，请重新登录")
+		return
+	}
+
+	var loginState oidcLoginState
+	if err := json.Unmarshal([]byte(raw), &loginState); err != nil {
+		h.InternalError(c, fmt.Errorf("解析登录状态失败: %v", err))
+		return
+	}
+
+	identity, err := h.oidc.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		h.UnauthorizedError(c, "单点登录校验失败: "+err.Error())
+		return
+	}
+
+	user, err := auth.ProvisionOIDCUser(h.dbCtx(c), h.oidc, identity)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCGroupNotAllowed) {
+			h.ForbiddenError(c, err.Error())
+			return
+		}
+		if errors.Is(err, auth.ErrOIDCEmailTaken) {
+			h.ErrorResponse(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		h.InternalError(c, err)
+		return
+	}
+
+	if !user.IsActive {
+		h.ForbiddenError(c, "账号已被停用")
+		return
+	}
+
+	response, err := h.issueSession(c, user)
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	h.claimAnonymousTasks(c, user.ID)
+	slog.InfoContext(logger.WithUserID(c.Request.Context(), user.ID), "单点登录成功", "username", user.Username, "provider", h.oidc.Name())
+
+	// 通过URL片段把token交给前端，片段不会发送到服务器或写入访问日志
+	fragment := url.Values{}
+	fragment.Set("token", response.Token)
+	fragment.Set("expires_at", response.ExpiresAt.Format(time.RFC3339))
+	c.Redirect(http.StatusFound, loginState.Redirect+"#"+fragment.Encode())
+}
+
+// safeRedirect 仅允许站内相对路径作为跳转地址，防止开放重定向
+func safeRedirect(redirect, fallback string) string {
+	if redirect == "" || !strings.HasPrefix(redirect, "/") ||
+		strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return fallback
+	}
+	return redirect
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"video-converter/internal/auth"
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+)
+
+// mockIdP 最小化的OIDC身份提供方：discovery、授权、token（校验PKCE）和JWKS
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu         sync.Mutex
+	discovered int
+	codes      map[string]mockAuthRequest
+}
+
+// mockAuthRequest 授权码对应的授权请求
+type mockAuthRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成签名密钥失败: %v", err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]mockAuthRequest)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	idp.discovered++
+	idp.mu.Unlock()
+
+	issuer := idp.server.URL
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorize 直接同意授权，带着code和原样的state跳回客户端
+func (idp *mockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code, _ := auth.GenerateToken()
+	idp.mu.Lock()
+	idp.codes[code] = mockAuthRequest{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	idp.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token 校验授权码和PKCE verifier后签发ID Token
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	req, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: idp.key, KeyID: "test"},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":                idp.server.URL,
+		"sub":                "mock-subject",
+		"aud":                "test-client",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              req.nonce,
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"video-admins"},
+	})
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &idp.key.PublicKey,
+		KeyID:     "test",
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+// oidcTestEnv 接入模拟IdP的认证处理器
+type oidcTestEnv struct {
+	idp    *mockIdP
+	mr     *miniredis.Miniredis
+	deps   *Dependencies
+	router *gin.Engine
+	client *http.Client
+}
+
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+
+	idp := newMockIdP(t)
+	cfg := &config.Config{}
+	cfg.Auth.OIDC = config.OIDCConfig{
+		Enabled:           true,
+		ProviderName:      "mock",
+		IssuerURL:         idp.server.URL,
+		ClientID:          "test-client",
+		ClientSecret:      "test-secret",
+		RedirectURL:       "http://app.test/api/v1/auth/oidc/callback",
+		GroupsClaim:       "groups",
+		RoleMappings:      []config.OIDCRoleMapping{{Group: "video-admins", Role: "admin"}},
+		PostLoginRedirect: "/",
+	}
+	deps, mr := newTestDeps(t, cfg)
+	deps.OIDC = auth.NewOIDCProvider(&cfg.Auth.OIDC)
+
+	router := gin.New()
+	handler := NewAuthHandler(deps)
+	router.GET("/api/v1/auth/oidc/login", handler.OIDCLogin)
+	router.GET("/api/v1/auth/oidc/callback", handler.OIDCCallback)
+
+	return &oidcTestEnv{
+		idp:    idp,
+		mr:     mr,
+		deps:   deps,
+		router: router,
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+// login 发起登录并经过IdP授权，返回IdP跳回的回调地址
+func (env *oidcTestEnv) login(t *testing.T) *url.URL {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("登录跳转状态码 = %d，响应: %s", w.Code, w.Body.String())
+	}
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(authURL.String(), env.idp.server.URL+"/authorize") {
+		t.Fatalf("登录跳转地址 = %q，应指向IdP授权地址", w.Header().Get("Location"))
+	}
+	for _, param := range []string{"state", "nonce", "code_challenge"} {
+		if authURL.Query().Get(param) == "" {
+			t.Fatalf("授权地址缺少 %s 参数: %s", param, authURL)
+		}
+	}
+
+	resp, err := env.client.Get(authURL.String())
+	if err != nil {
+		t.Fatalf("请求IdP授权地址失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("IdP授权状态码 = %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("解析回调地址失败: %v", err)
+	}
+	if callback.Query().Get("state") != authURL.Query().Get("state") {
+		t.Fatalf("IdP返回的state与授权请求不一致")
+	}
+	return callback
+}
+
+// callback 以IdP跳回的参数调用回调接口
+func (env *oidcTestEnv) callback(callback *url.URL) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+callback.RawQuery, nil))
+	return w
+}
+
+// tamperState 修改暂存的登录状态，模拟被替换的nonce或PKCE verifier
+func (env *oidcTestEnv) tamperState(t *testing.T, state string, modify func(*oidcLoginState)) {
+	t.Helper()
+
+	key := "oidc_state:" + state
+	raw, err := env.mr.Get(key)
+	if err != nil {
+		t.Fatalf("读取登录状态失败: %v", err)
+	}
+	var loginState oidcLoginState
+	if err := json.Unmarshal([]byte(raw), &loginState); err != nil {
+		t.Fatalf("解析登录状态失败: %v", err)
+	}
+	modify(&loginState)
+	data, _ := json.Marshal(loginState)
+	env.mr.Set(key, string(data))
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	env := newOIDCTestEnv(t)
+
+	callback := env.login(t)
+	w := env.callback(callback)
+	if w.Code != http.StatusFound {
+		t.Fatalf("回调状态码 = %d，响应: %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	path, fragment, _ := strings.Cut(location, "#")
+	if path != "/" {
+		t.Errorf("登录后跳转到 %q，应为 /", path)
+	}
+	values, _ := url.ParseQuery(fragment)
+	token := values.Get("token")
+	if token == "" {
+		t.Fatalf("跳转地址中缺少token: %s", location)
+	}
+
+	var user model.User
+	if err := env.deps.DB.First(&user, "auth_provider = ? AND external_id = ?", "mock", "mock-subject").Error; err != nil {
+		t.Fatalf("未创建单点登录用户: %v", err)
+	}
+	if user.Role != model.UserRoleAdmin {
+		t.Errorf("用户角色 = %s，应按用户组映射为 admin", user.Role)
+	}
+	if userID, err := env.mr.Get("session:" + token); err != nil || userID != user.ID {
+		t.Errorf("会话 = %q (%v)，应关联到用户 %s", userID, err, user.ID)
+	}
+
+	env.idp.mu.Lock()
+	discovered := env.idp.discovered
+	env.idp.mu.Unlock()
+	if discovered != 1 {
+		t.Errorf("discovery 请求次数 = %d，应只在首次使用时请求一次", discovered)
+	}
+
+	// state只能使用一次
+	if w := env.callback(callback); w.Code != http.StatusUnauthorized {
+		t.Errorf("重放回调状态码 = %d，应为 401", w.Code)
+	}
+}
+
+func TestOIDCCallbackRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, env *oidcTestEnv, callback *url.URL)
+	}{
+		{
+			name: "未知的state",
+			modify: func(t *testing.T, env *oidcTestEnv, callback *url.URL) {
+				values := callback.Query()
+				values.Set("state", "unknown-state")
+				callback.RawQuery = values.Encode()
+			},
+		},
+		{
+			name: "PKCE verifier不匹配",
+			modify: func(t *testing.T, env *oidcTestEnv, callback *url.URL) {
+				env.tamperState(t, callback.Query().Get("state"), func(s *oidcLoginState) {
+					s.CodeVerifier = "wrong-verifier-wrong-verifier-wrong-verifier"
+				})
+			},
+		},
+		{
+			name: "nonce不匹配",
+			modify: func(t *testing.T, env *oidcTestEnv, callback *url.URL) {
+				env.tamperState(t, callback.Query().Get("state"), func(s *oidcLoginState) {
+					s.Nonce = "other-nonce"
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOIDCTestEnv(t)
+			callback := env.login(t)
+			tt.modify(t, env, callback)
+
+			w := env.callback(callback)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("回调状态码 = %d，应为 401，响应: %s", w.Code, w.Body.String())
+			}
+			var count int64
+			env.deps.DB.Model(&model.User{}).Count(&count)
+			if count != 0 {
+				t.Errorf("校验失败时不应创建用户，实际创建了 %d 个", count)
+			}
+		})
+	}
+}
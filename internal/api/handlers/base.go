@@ -1,47 +1,121 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
+	"strconv"
+	"video-converter/internal/auth"
 	"video-converter/internal/config"
+	"video-converter/internal/model"
+	"video-converter/pkg/converter"
+	"video-converter/pkg/disk"
+	"video-converter/pkg/objectstore"
+	"video-converter/pkg/queue"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
+// defaultUserID 未登录请求使用的默认用户ID
+const defaultUserID = "5ba6d3f8-4478-11f0-8574-74df036e1f50"
+
 // Dependencies 处理器依赖
 type Dependencies struct {
-	Config *config.Config
-	DB     *gorm.DB
-	Redis  *redis.Client
+	Config    *config.Config
+	DB        *gorm.DB
+	Redis     *redis.Client
+	Storage   objectstore.Store // 上传文件和转换输出的存储
+	DiskGuard *disk.Guard       // 未启用磁盘空间准入控制时为nil
+	Processor *queue.TaskProcessor
+	Converter *converter.FFmpegConverter // 与任务处理器共用，持有启动时探测到的能力
+	OIDC      *auth.OIDCProvider         // 未启用单点登录时为nil
 }
 
 // BaseHandler 基础处理器
 type BaseHandler struct {
-	cfg   *config.Config
-	db    *gorm.DB
-	redis *redis.Client
+	cfg       *config.Config
+	db        *gorm.DB
+	redis     *redis.Client
+	store     objectstore.Store
+	diskGuard *disk.Guard
+	processor *queue.TaskProcessor
 }
 
 // NewBaseHandler 创建基础处理器
 func NewBaseHandler(deps *Dependencies) *BaseHandler {
 	return &BaseHandler{
-		cfg:   deps.Config,
-		db:    deps.DB,
-		redis: deps.Redis,
+		cfg:       deps.Config,
+		db:        deps.DB,
+		redis:     deps.Redis,
+		store:     deps.Storage,
+		diskGuard: deps.DiskGuard,
+		processor: deps.Processor,
 	}
 }
 
-// HealthCheck 健康检查端点
-func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "服务运行正常",
-		"data": gin.H{
-			"status":    "healthy",
-			"timestamp": gin.H{},
-		},
-	})
+// currentUserID 获取当前请求的用户ID，未登录时返回默认用户
+func (h *BaseHandler) currentUserID(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return userID
+	}
+	return defaultUserID
+}
+
+// ownerScope 将任务查询限制为当前请求者拥有的任务
+// 登录用户按用户ID过滤，匿名访客按匿名会话ID过滤
+func (h *BaseHandler) ownerScope(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	userID := c.GetString("user_id")
+	anonymousID := c.GetString("anonymous_id")
+
+	return func(db *gorm.DB) *gorm.DB {
+		if userID != "" {
+			return db.Where("user_id = ?", userID)
+		}
+		if anonymousID != "" {
+			return db.Where("user_id = ? AND anonymous_id = ?", defaultUserID, anonymousID)
+		}
+		// 既未登录也没有匿名会话，不可见任何任务
+		return db.Where("1 = 0")
+	}
+}
+
+// dbCtx 返回绑定当前请求上下文的数据库会话，使查询挂在请求的trace下
+func (h *BaseHandler) dbCtx(c *gin.Context) *gorm.DB {
+	return h.db.WithContext(c.Request.Context())
+}
+
+// findOwnedTask 查找当前请求者拥有的任务
+func (h *BaseHandler) findOwnedTask(c *gin.Context, taskID string, task *model.ConversionTask) error {
+	return h.dbCtx(c).Scopes(h.ownerScope(c)).First(task, "id = ?", taskID).Error
+}
+
+// assignOwner 设置新任务的归属
+func (h *BaseHandler) assignOwner(c *gin.Context, task *model.ConversionTask) {
+	task.UserID = h.currentUserID(c)
+	if c.GetString("user_id") == "" {
+		task.AnonymousID = c.GetString("anonymous_id")
+	}
+}
+
+// checkDiskSpace 剩余空间低于低水位时拒绝新的上传和URL任务，返回是否可以继续处理
+func (h *BaseHandler) checkDiskSpace(c *gin.Context) bool {
+	if h.diskGuard.Level() < disk.LevelLow {
+		return true
+	}
+	c.Header("Retry-After", strconv.Itoa(h.cfg.DiskGuard.Interval))
+	h.ErrorResponse(c, http.StatusInsufficientStorage, "服务器存储空间不足，暂不接受新任务，请稍后再试", nil)
+	return false
+}
+
+// currentUser 获取当前登录用户，未登录时返回nil
+func (h *BaseHandler) currentUser(c *gin.Context) *model.User {
+	if value, ok := c.Get("user"); ok {
+		if user, ok := value.(*model.User); ok {
+			return user
+		}
+	}
+	return nil
 }
 
 // Welcome 欢迎页面
@@ -103,6 +177,7 @@ func (h *BaseHandler) ValidationError(c *gin.Context, message string) {
 
 // InternalError 内部错误响应
 func (h *BaseHandler) InternalError(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "请求处理失败", "path", c.Request.URL.Path, "error", err)
 	h.ErrorResponse(c, http.StatusInternalServerError, "服务器内部错误", err)
 }
 
@@ -116,6 +191,11 @@ func (h *BaseHandler) UnauthorizedError(c *gin.Context, message string) {
 	h.ErrorResponse(c, http.StatusUnauthorized, message, nil)
 }
 
+// ForbiddenError 禁止访问错误响应
+func (h *BaseHandler) ForbiddenError(c *gin.Context, message string) {
+	h.ErrorResponse(c, http.StatusForbidden, message, nil)
+}
+
 // PaginationResponse 分页响应
 type PaginationResponse struct {
 	Items      interface{} `json:"items"`
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"video-converter/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BatchHandler 批量上传任务处理器
+type BatchHandler struct {
+	*BaseHandler
+}
+
+// BatchStatus 批次中各任务的汇总状态
+type BatchStatus struct {
+	BatchID  string                   `json:"batch_id"`
+	Total    int                      `json:"total"`
+	Counts   map[model.TaskStatus]int `json:"counts"`   // 各状态的任务数
+	Progress float64                  `json:"progress"` // 所有任务的平均进度
+	Finished bool                     `json:"finished"` // 所有任务都已结束（完成、失败或取消）
+	Tasks    []model.TaskSummary      `json:"tasks"`
+}
+
+// NewBatchHandler 创建批量上传任务处理器
+func NewBatchHandler(deps *Dependencies) *BatchHandler {
+	return &BatchHandler{
+		BaseHandler: NewBaseHandler(deps),
+	}
+}
+
+// GetBatch 获取批次中所有任务的状态
+func (h *BatchHandler) GetBatch(c *gin.Context) {
+	tasks, ok := h.findBatchTasks(c)
+	if !ok {
+		return
+	}
+
+	status := BatchStatus{
+		BatchID:  c.Param("id"),
+		Total:    len(tasks),
+		Counts:   make(map[model.TaskStatus]int),
+		Finished: true,
+		Tasks:    make([]model.TaskSummary, len(tasks)),
+	}
+	for i, task := range tasks {
+		status.Counts[task.Status]++
+		status.Progress += task.Progress
+		status.Tasks[i] = task.ToSummary()
+
+		switch task.Status {
+		case model.TaskStatusCompleted, model.TaskStatusFailed, model.TaskStatusCanceled, model.TaskStatusExpired:
+		default:
+			status.Finished = false
+		}
+	}
+	status.Progress /= float64(len(tasks))
+
+	h.SuccessResponse(c, http.StatusOK, "获取批次状态成功", status)
+}
+
+// DownloadBatch 将批次中已完成任务的输出打包为zip下载
+// 音频已经过压缩，zip中只存储不再压缩；未完成或输出丢失的任务不包含在内
+func (h *BatchHandler) DownloadBatch(c *gin.Context) {
+	tasks, ok := h.findBatchTasks(c)
+	if !ok {
+		return
+	}
+
+	var completed []model.ConversionTask
+	for _, task := range tasks {
+		if task.Status != model.TaskStatusCompleted || task.OutputPath == "" {
+			continue
+		}
+		if _, err := h.store.Stat(c.Request.Context(), task.OutputPath); err != nil {
+			continue
+		}
+		completed = append(completed, task)
+	}
+	if len(completed) == 0 {
+		h.ErrorResponse(c, http.StatusBadRequest, "批次中还没有已完成的任务", nil)
+		return
+	}
+
+	batchID := c.Param("id")
+	c.Header("Content-Description", "File Transfer")
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", h.attachmentDisposition("batch-"+batchID+".zip"))
+	c.Status(http.StatusOK)
+
+	// 响应头已发送，之后的错误只能中断响应并记录日志
+	writer := zip.NewWriter(c.Writer)
+	names := make(map[string]int)
+	for _, task := range completed {
+		if err := h.writeZipEntry(c.Request.Context(), writer, uniqueEntryName(names, h.outputFileName(&task)), task.OutputPath); err != nil {
+			slog.ErrorContext(c.Request.Context(), "打包批次输出失败", "batch_id", batchID, "task_id", task.ID, "error", err)
+			c.Abort()
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "打包批次输出失败", "batch_id", batchID, "error", err)
+	}
+}
+
+// findBatchTasks 查找当前请求者在批次中的任务，批次不存在时直接写入响应
+func (h *BatchHandler) findBatchTasks(c *gin.Context) ([]model.ConversionTask, bool) {
+	batchID := c.Param("id")
+	if batchID == "" {
+		h.ValidationError(c, "批次ID不能为空")
+		return nil, false
+	}
+
+	var tasks []model.ConversionTask
+	if err := h.dbCtx(c).Scopes(h.ownerScope(c)).
+		Where("batch_id = ?", batchID).
+		Order("created_at ASC").
+		Find(&tasks).Error; err != nil {
+		h.InternalError(c, err)
+		return nil, false
+	}
+	if len(tasks) == 0 {
+		h.NotFoundError(c, "批次不存在")
+		return nil, false
+	}
+	return tasks, true
+}
+
+// writeZipEntry 将存储中的文件以不压缩的方式写入zip
+func (h *BatchHandler) writeZipEntry(ctx context.Context, writer *zip.Writer, name, key string) error {
+	reader, info, err := h.store.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	entry, err := writer.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: info.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, reader)
+	return err
+}
+
+// uniqueEntryName 同名文件加序号区分，如 a.mp3、a (1).mp3
+// names 记录已使用的条目名和下一个候选序号，生成的名称与其他文件的原名相同时继续递增
+func uniqueEntryName(names map[string]int, name string) string {
+	if _, used := names[name]; !used {
+		names[name] = 1
+		return name
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := names[name]; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if _, used := names[candidate]; !used {
+			names[name] = i + 1
+			names[candidate] = 1
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueEntryName(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{
+			name:  "不重名",
+			names: []string{"a.mp3", "b.mp3"},
+			want:  []string{"a.mp3", "b.mp3"},
+		},
+		{
+			name:  "重名加序号",
+			names: []string{"a.mp3", "a.mp3", "a.mp3"},
+			want:  []string{"a.mp3", "a (1).mp3", "a (2).mp3"},
+		},
+		{
+			name:  "序号与后面的原名冲突",
+			names: []string{"a.mp3", "a.mp3", "a (1).mp3"},
+			want:  []string{"a.mp3", "a (1).mp3", "a (1) (1).mp3"},
+		},
+		{
+			name:  "序号与前面的原名冲突",
+			names: []string{"a (1).mp3", "a.mp3", "a.mp3"},
+			want:  []string{"a (1).mp3", "a.mp3", "a (2).mp3"},
+		},
+		{
+			name:  "没有扩展名",
+			names: []string{"a", "a"},
+			want:  []string{"a", "a (1)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := make(map[string]int)
+			got := make([]string, 0, len(tt.names))
+			for _, name := range tt.names {
+				got = append(got, uniqueEntryName(used, name))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueEntryName = %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
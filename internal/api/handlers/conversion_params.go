@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+	"video-converter/pkg/converter"
+)
+
+// ConversionParams 转换参数，上传、文件转换和URL转换共用
+// 未指定的参数使用配置中的默认值
+type ConversionParams struct {
+	Format       string  `json:"format,omitempty"`        // 输出格式，如 mp3、m4a
+	AudioCodec   string  `json:"audio_codec,omitempty"`   // 音频编码器
+	AudioBitrate string  `json:"audio_bitrate,omitempty"` // 音频比特率
+	SampleRate   string  `json:"sample_rate,omitempty"`   // 采样率
+	TrimStart    float64 `json:"trim_start,omitempty"`    // 截取起始时间（秒）
+	TrimEnd      float64 `json:"trim_end,omitempty"`      // 截取结束时间（秒），0表示到结尾
+	Normalize    bool    `json:"normalize,omitempty"`     // 响度标准化
+}
+
+// setFormValue 从上传表单字段设置转换参数，返回字段是否属于转换参数
+func (p *ConversionParams) setFormValue(name, value string) (bool, error) {
+	var err error
+	switch name {
+	case "format":
+		p.Format = value
+	case "audio_codec":
+		p.AudioCodec = value
+	case "audio_bitrate":
+		p.AudioBitrate = value
+	case "sample_rate":
+		p.SampleRate = value
+	case "trim_start":
+		p.TrimStart, err = parseFormSeconds(name, value)
+	case "trim_end":
+		p.TrimEnd, err = parseFormSeconds(name, value)
+	case "normalize":
+		p.Normalize, err = parseFormBool(name, value)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// resolve 填充默认值并检查参数是否有效
+// 尚未探测到FFmpeg能力时只检查参数本身，不检查本节点是否支持
+func (p *ConversionParams) resolve(cfg *config.FFmpegConfig, caps *converter.Capabilities) error {
+	var format *converter.OutputFormat
+	if p.Format != "" {
+		var ok bool
+		if format, ok = converter.LookupOutputFormat(p.Format); !ok {
+			return fmt.Errorf("不支持的输出格式: %s", p.Format)
+		}
+	}
+
+	// 未指定编码器时，默认编码器属于所选格式则使用默认编码器，否则使用该格式第一个可用的编码器
+	if p.AudioCodec == "" {
+		switch {
+		case format == nil || format.HasEncoder(cfg.AudioCodec):
+			p.AudioCodec = cfg.AudioCodec
+		default:
+			p.AudioCodec = format.Encoders[0]
+			for _, encoder := range format.Encoders {
+				if caps != nil && caps.HasEncoder(encoder) {
+					p.AudioCodec = encoder
+					break
+				}
+			}
+		}
+	}
+
+	codecFormat, ok := converter.FormatForEncoder(p.AudioCodec)
+	if !ok {
+		return fmt.Errorf("不支持的音频编码器: %s", p.AudioCodec)
+	}
+	if format != nil && format != codecFormat {
+		return fmt.Errorf("音频编码器 %s 不能用于输出格式 %s", p.AudioCodec, format.Name)
+	}
+	p.Format = codecFormat.Name
+	if caps != nil {
+		if err := caps.Require(p.AudioCodec); err != nil {
+			return fmt.Errorf("本节点不支持音频编码器 %s", p.AudioCodec)
+		}
+	}
+
+	if p.AudioBitrate == "" {
+		p.AudioBitrate = cfg.AudioBitrate
+	}
+	if !containsString(converter.AudioBitrates, p.AudioBitrate) {
+		return fmt.Errorf("不支持的音频比特率: %s", p.AudioBitrate)
+	}
+
+	if p.SampleRate == "" {
+		p.SampleRate = cfg.SampleRate
+	}
+	if !containsString(converter.SampleRates, p.SampleRate) {
+		return fmt.Errorf("不支持的采样率: %s", p.SampleRate)
+	}
+
+	if !isFiniteSeconds(p.TrimStart) || !isFiniteSeconds(p.TrimEnd) {
+		return fmt.Errorf("截取时间必须是有限的秒数")
+	}
+	if p.TrimStart < 0 || p.TrimEnd < 0 {
+		return fmt.Errorf("截取时间不能为负数")
+	}
+	if p.TrimEnd > 0 && p.TrimEnd <= p.TrimStart {
+		return fmt.Errorf("截取结束时间必须大于起始时间")
+	}
+
+	if p.Normalize && caps != nil && !caps.HasFilter("loudnorm") {
+		return fmt.Errorf("本节点的FFmpeg不支持响度标准化")
+	}
+	return nil
+}
+
+// apply 将转换参数写入任务
+func (p *ConversionParams) apply(task *model.ConversionTask) {
+	task.OutputFormat = p.Format
+	task.AudioCodec = p.AudioCodec
+	task.AudioBitrate = p.AudioBitrate
+	task.SampleRate = p.SampleRate
+	task.TrimStart = p.TrimStart
+	task.TrimEnd = p.TrimEnd
+	task.Normalize = p.Normalize
+}
+
+// parseFormSeconds 解析表单中的秒数
+func parseFormSeconds(name, value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	// ParseFloat 接受 NaN 和 Inf，它们能通过大小比较，需要单独拒绝
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || !isFiniteSeconds(seconds) {
+		return 0, fmt.Errorf("%s 必须是秒数", name)
+	}
+	return seconds, nil
+}
+
+// isFiniteSeconds 秒数是否为有限值（不是 NaN 或 Inf）
+func isFiniteSeconds(seconds float64) bool {
+	return !math.IsNaN(seconds) && !math.IsInf(seconds, 0)
+}
+
+// parseFormBool 解析表单中的布尔值
+func parseFormBool(name, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s 必须是布尔值", name)
+	}
+	return b, nil
+}
+
+// containsString 切片中是否包含指定字符串
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+
+	"video-converter/internal/config"
+)
+
+func TestParseFormSeconds(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "12.5", want: 12.5},
+		{value: "0", want: 0},
+		{value: "abc", wantErr: true},
+		{value: "NaN", wantErr: true},
+		{value: "nan", wantErr: true},
+		{value: "Inf", wantErr: true},
+		{value: "+Inf", wantErr: true},
+		{value: "-Infinity", wantErr: true},
+		{value: "1e400", wantErr: true}, // 超出范围
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseFormSeconds("trim_start", tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFormSeconds(%q) 错误 = %v，wantErr = %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseFormSeconds(%q) = %v，应为 %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversionParamsResolveTrim(t *testing.T) {
+	cfg := &config.FFmpegConfig{AudioCodec: "libmp3lame", AudioBitrate: "192k", SampleRate: "44100"}
+
+	tests := []struct {
+		name      string
+		trimStart float64
+		trimEnd   float64
+		wantErr   bool
+	}{
+		{name: "不截取"},
+		{name: "有效区间", trimStart: 5, trimEnd: 10},
+		{name: "只有起始时间", trimStart: 5},
+		{name: "负数", trimStart: -1, wantErr: true},
+		{name: "结束早于起始", trimStart: 10, trimEnd: 5, wantErr: true},
+		{name: "起始为NaN", trimStart: math.NaN(), wantErr: true},
+		{name: "结束为NaN", trimEnd: math.NaN(), wantErr: true},
+		{name: "起始为正无穷", trimStart: math.Inf(1), wantErr: true},
+		{name: "结束为正无穷", trimStart: 5, trimEnd: math.Inf(1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := ConversionParams{TrimStart: tt.trimStart, TrimEnd: tt.trimEnd}
+			err := params.resolve(cfg, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolve 错误 = %v，wantErr = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,24 +3,32 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"video-converter/internal/logger"
+	"video-converter/internal/metrics"
 	"video-converter/internal/model"
 	"video-converter/internal/storage"
+	"video-converter/internal/tracing"
 	"video-converter/pkg/converter"
+	"video-converter/pkg/filemanager"
 
 	"video-converter/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ConvertHandler 转换处理器
@@ -32,20 +40,16 @@ type ConvertHandler struct {
 
 // ConvertFileRequest 文件转换请求
 type ConvertFileRequest struct {
-	TaskID       string `json:"task_id" binding:"required"` // 上传任务ID
-	AudioCodec   string `json:"audio_codec,omitempty"`      // 音频编码器
-	AudioBitrate string `json:"audio_bitrate,omitempty"`    // 音频比特率
-	SampleRate   string `json:"sample_rate,omitempty"`      // 采样率
+	TaskID string `json:"task_id" binding:"required"` // 上传任务ID
+	ConversionParams
 }
 
 // ConvertURLRequest URL转换请求
 type ConvertURLRequest struct {
-	URL          string `json:"url" binding:"required"`  // 视频URL
-	Title        string `json:"title,omitempty"`         // 任务标题
-	Description  string `json:"description,omitempty"`   // 任务描述
-	AudioCodec   string `json:"audio_codec,omitempty"`   // 音频编码器
-	AudioBitrate string `json:"audio_bitrate,omitempty"` // 音频比特率
-	SampleRate   string `json:"sample_rate,omitempty"`   // 采样率
+	URL         string `json:"url" binding:"required"` // 视频URL
+	Title       string `json:"title,omitempty"`        // 任务标题
+	Description string `json:"description,omitempty"`  // 任务描述
+	ConversionParams
 }
 
 // ConvertResponse 转换响应
@@ -59,8 +63,11 @@ type ConvertResponse struct {
 
 // NewConvertHandler 创建转换处理器
 func NewConvertHandler(deps *Dependencies) *ConvertHandler {
-	// 创建FFmpeg转换器
-	ffmpegConverter := converter.NewFFmpegConverter(&deps.Config.FFmpeg)
+	// 使用共享的FFmpeg转换器，未注入时单独创建
+	ffmpegConverter := deps.Converter
+	if ffmpegConverter == nil {
+		ffmpegConverter = converter.NewFFmpegConverter(&deps.Config.FFmpeg)
+	}
 
 	// 创建Redis管理器
 	redisManager := storage.NewRedisManager(deps.Redis)
@@ -82,63 +89,78 @@ func (h *ConvertHandler) ConvertFile(c *gin.Context) {
 
 	// 查找上传任务
 	var uploadTask model.ConversionTask
-	if err := h.db.First(&uploadTask, "id = ? AND type = ?", req.TaskID, model.TaskTypeFileUpload).Error; err != nil {
+	if err := h.dbCtx(c).Scopes(h.ownerScope(c)).First(&uploadTask, "id = ? AND type = ?", req.TaskID, model.TaskTypeFileUpload).Error; err != nil {
 		h.NotFoundError(c, "找不到对应的上传任务")
 		return
 	}
 
 	// 检查上传任务状态
-	if uploadTask.Status != model.TaskStatusQueued {
-		h.ErrorResponse(c, http.StatusBadRequest, "只能转换处于排队状态的上传任务", nil)
+	if uploadTask.Status != model.TaskStatusUploaded {
+		h.ErrorResponse(c, http.StatusConflict, "只能转换已上传且尚未提交转换的任务", nil)
 		return
 	}
 
-	// 验证输入文件
-	if err := h.ffmpegConverter.ValidateInput(uploadTask.InputPath); err != nil {
+	// 验证输入文件，格式已在上传时检查，这里只确认文件仍在存储中
+	if _, err := h.store.Stat(c.Request.Context(), uploadTask.InputPath); err != nil {
 		h.ErrorResponse(c, http.StatusBadRequest, "输入文件验证失败", err)
 		return
 	}
 
 	// 设置转换参数（使用请求参数或默认值）
-	audioCodec := req.AudioCodec
-	if audioCodec == "" {
-		audioCodec = h.cfg.FFmpeg.AudioCodec
-	}
-
-	audioBitrate := req.AudioBitrate
-	if audioBitrate == "" {
-		audioBitrate = h.cfg.FFmpeg.AudioBitrate
-	}
-
-	sampleRate := req.SampleRate
-	if sampleRate == "" {
-		sampleRate = h.cfg.FFmpeg.SampleRate
+	params := req.ConversionParams
+	if err := params.resolve(&h.cfg.FFmpeg, h.ffmpegConverter.Capabilities()); err != nil {
+		h.ValidationError(c, err.Error())
+		return
 	}
 
-	// 更新任务转换参数
-	uploadTask.AudioCodec = audioCodec
-	uploadTask.AudioBitrate = audioBitrate
-	uploadTask.SampleRate = sampleRate
+	// 更新任务转换参数并放入队列，以状态为条件更新，避免重复提交
+	params.apply(&uploadTask)
+	uploadTask.Status = model.TaskStatusQueued
+	uploadTask.TraceContext = tracing.InjectString(c.Request.Context())
 	uploadTask.UpdatedAt = time.Now()
-
-	if err := h.db.Save(&uploadTask).Error; err != nil {
-		h.InternalError(c, err)
+	uploadTask.ExpiresAt = nil // 未提交转换的保留期不再适用
+
+	result := h.dbCtx(c).Model(&uploadTask).
+		Where("status = ?", model.TaskStatusUploaded).
+		Select("output_format", "audio_codec", "audio_bitrate", "sample_rate",
+			"trim_start", "trim_end", "normalize", "status", "trace_context", "updated_at", "expires_at").
+		Updates(&uploadTask)
+	if result.Error != nil {
+		h.InternalError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		h.ErrorResponse(c, http.StatusConflict, "任务已提交转换", nil)
 		return
 	}
 
-	// 获取视频信息估算时长
+	ctx := logger.WithTaskID(c.Request.Context(), uploadTask.ID)
+	slog.InfoContext(ctx, "文件转换任务已排队", "format", params.Format,
+		"audio_codec", params.AudioCodec, "audio_bitrate", params.AudioBitrate)
+	h.redisManager.SetTaskStatus(ctx, uploadTask.ID, string(uploadTask.Status))
+
+	// 获取视频信息估算时长，文件不在本地（对象存储）时不为估算而下载，由worker在转换前获取
 	estimatedDuration := "未知"
-	if videoInfo, err := h.ffmpegConverter.GetVideoInfo(uploadTask.InputPath); err == nil {
-		// 简单估算：通常转换时间约为视频时长的10-50%
-		estimated := int(videoInfo.Duration * 0.3) // 假设30%的时间
-		if estimated < 10 {
-			estimated = 10 // 最少10秒
+	if inputPath, ok := h.store.LocalPath(uploadTask.InputPath); ok {
+		if videoInfo, err := h.ffmpegConverter.GetVideoInfo(inputPath); err == nil {
+			// 简单估算：通常转换时间约为视频时长的10-50%
+			estimated := int(videoInfo.Duration * 0.3) // 假设30%的时间
+			if estimated < 10 {
+				estimated = 10 // 最少10秒
+			}
+			estimatedDuration = time.Duration(estimated * int(time.Second)).String()
+
+			// 更新数据库中的视频时长
+			uploadTask.Duration = videoInfo.Duration
+			h.dbCtx(c).Model(&uploadTask).Update("duration", videoInfo.Duration)
 		}
-		estimatedDuration = time.Duration(estimated * int(time.Second)).String()
+	}
 
-		// 更新数据库中的视频时长
-		uploadTask.Duration = videoInfo.Duration
-		h.db.Model(&uploadTask).Update("duration", videoInfo.Duration)
+	// 交给任务处理器，队列已满时由扫描器稍后处理
+	// worker会修改任务，传入副本避免与构造响应并发读写
+	if h.processor != nil {
+		queued := uploadTask
+		h.processor.AddTask(context.WithoutCancel(ctx), &queued)
 	}
 
 	response := ConvertResponse{
@@ -154,6 +176,10 @@ func (h *ConvertHandler) ConvertFile(c *gin.Context) {
 
 // ConvertURL URL转换
 func (h *ConvertHandler) ConvertURL(c *gin.Context) {
+	if !h.checkDiskSpace(c) {
+		return
+	}
+
 	var req ConvertURLRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
@@ -169,7 +195,7 @@ func (h *ConvertHandler) ConvertURL(c *gin.Context) {
 
 	// 如果提取的URL与原始URL不同，记录日志
 	if extractedURL != req.URL {
-		fmt.Printf("URL提取: 原始='%s' -> 提取='%s'\n", req.URL, extractedURL)
+		slog.DebugContext(c.Request.Context(), "从分享文本中提取视频链接", "original", req.URL, "extracted", extractedURL)
 	}
 
 	// 使用提取的URL
@@ -181,51 +207,44 @@ func (h *ConvertHandler) ConvertURL(c *gin.Context) {
 	}
 
 	// 设置转换参数
-	audioCodec := req.AudioCodec
-	if audioCodec == "" {
-		audioCodec = h.cfg.FFmpeg.AudioCodec
-	}
-
-	audioBitrate := req.AudioBitrate
-	if audioBitrate == "" {
-		audioBitrate = h.cfg.FFmpeg.AudioBitrate
-	}
-
-	sampleRate := req.SampleRate
-	if sampleRate == "" {
-		sampleRate = h.cfg.FFmpeg.SampleRate
+	params := req.ConversionParams
+	if err := params.resolve(&h.cfg.FFmpeg, h.ffmpegConverter.Capabilities()); err != nil {
+		h.ValidationError(c, err.Error())
+		return
 	}
 
 	// 创建URL转换任务
 	task := &model.ConversionTask{
-		ID:           uuid.New().String(),
-		UserID:       "5ba6d3f8-4478-11f0-8574-74df036e1f50", // 使用默认用户ID
-		Type:         model.TaskTypeURLConvert,
-		Status:       model.TaskStatusQueued,
-		Title:        req.Title,
-		Description:  req.Description,
-		OriginalURL:  req.URL,
-		AudioCodec:   audioCodec,
-		AudioBitrate: audioBitrate,
-		SampleRate:   sampleRate,
-		Progress:     0,
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+		ID:          uuid.New().String(),
+		Type:        model.TaskTypeURLConvert,
+		Status:      model.TaskStatusQueued,
+		Title:       req.Title,
+		Description: req.Description,
+		OriginalURL: req.URL,
+		Progress:    0,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
+	params.apply(task)
+
+	h.assignOwner(c, task)
+	task.TraceContext = tracing.InjectString(c.Request.Context())
 
 	// 保存到数据库
-	if err := h.db.Create(task).Error; err != nil {
+	if err := h.dbCtx(c).Create(task).Error; err != nil {
 		h.InternalError(c, err)
 		return
 	}
 
 	// 设置初始状态到Redis
-	ctx := c.Request.Context()
+	ctx := logger.WithTaskID(c.Request.Context(), task.ID)
+	slog.InfoContext(ctx, "创建URL转换任务", "url", req.URL)
 	h.redisManager.SetTaskStatus(ctx, task.ID, string(task.Status))
 	h.redisManager.SetTaskProgress(ctx, task.ID, task.Progress)
 
 	// 启动异步下载任务
-	go h.downloadAndProcessTask(task.ID, req.URL)
+	// 请求结束后继续使用其中的请求ID、用户和trace信息，但不随请求取消
+	go h.downloadAndProcessTask(context.WithoutCancel(c.Request.Context()), task.ID, req.URL)
 
 	response := ConvertResponse{
 		TaskID:            task.ID,
@@ -239,27 +258,70 @@ func (h *ConvertHandler) ConvertURL(c *gin.Context) {
 }
 
 // downloadAndProcessTask 下载视频并更新任务状态
-func (h *ConvertHandler) downloadAndProcessTask(taskID, videoURL string) {
-	ctx := context.Background()
+func (h *ConvertHandler) downloadAndProcessTask(ctx context.Context, taskID, videoURL string) {
+	ctx = logger.WithTaskID(ctx, taskID)
+	ctx, span := tracing.Start(ctx, "task.download", trace.WithAttributes(attribute.String("task.id", taskID)))
+	defer span.End()
+	db := h.db.WithContext(ctx)
 
 	// 更新任务状态为处理中
+	// 只写入下载过程修改的列，下载期间任务的归属可能因登录认领而变化；在此之前被取消的任务不再下载
 	task := &model.ConversionTask{}
-	if err := h.db.First(task, "id = ?", taskID).Error; err != nil {
+	if err := db.First(task, "id = ?", taskID).Error; err != nil {
+		slog.ErrorContext(ctx, "查询下载任务失败", "error", err)
 		return
 	}
 
+	result := db.Model(&model.ConversionTask{}).
+		Where("id = ? AND status IN ?", taskID, []model.TaskStatus{model.TaskStatusQueued, model.TaskStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":     model.TaskStatusProcessing,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		slog.ErrorContext(ctx, "更新下载任务状态失败", "error", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		slog.InfoContext(ctx, "任务已被取消，跳过下载")
+		return
+	}
 	task.Status = model.TaskStatusProcessing
-	h.db.Save(task)
 	h.redisManager.SetTaskStatus(ctx, taskID, string(model.TaskStatusProcessing))
 
+	// 每个任务使用独立的工作目录，同名文件互不覆盖；无论成功失败都删除整个目录
+	workDir, err := os.MkdirTemp(h.cfg.File.TempDir, "download-"+taskID+"-")
+	if err != nil {
+		err = &downloadError{reason: "local_write", err: fmt.Errorf("创建工作目录失败: %v", err)}
+	} else {
+		defer func() {
+			if err := os.RemoveAll(workDir); err != nil {
+				slog.WarnContext(ctx, "删除下载工作目录失败", "dir", workDir, "error", err)
+			}
+		}()
+	}
+
 	// 直接从下载服务下载视频文件
-	inputPath, originalName, err := h.downloadVideoFromService(taskID, videoURL)
+	startedAt := time.Now()
+	var inputPath, originalName string
+	if err == nil {
+		inputPath, originalName, err = h.downloadVideoFromService(ctx, taskID, videoURL, workDir)
+	}
+	metrics.ObserveDownload(time.Since(startedAt), downloadErrorReason(err))
+	if err == nil {
+		inputPath, err = h.storeDownload(ctx, taskID, inputPath)
+	}
 	if err != nil {
+		tracing.RecordError(span, err)
+		slog.ErrorContext(ctx, "下载视频失败", "url", videoURL, "error", err)
 		// 更新任务为失败状态
 		task.Status = model.TaskStatusFailed
 		task.ErrorMessage = fmt.Sprintf("下载视频失败: %v", err)
-		h.db.Save(task)
-		h.redisManager.SetTaskStatus(ctx, taskID, string(model.TaskStatusFailed))
+		if _, err := h.finishDownload(ctx, task, map[string]interface{}{
+			"error_message": task.ErrorMessage,
+		}); err != nil {
+			slog.ErrorContext(ctx, "更新下载任务状态失败", "error", err)
+		}
 		return
 	}
 
@@ -267,12 +329,50 @@ func (h *ConvertHandler) downloadAndProcessTask(taskID, videoURL string) {
 	task.InputPath = inputPath
 	task.OriginalName = originalName
 	task.Status = model.TaskStatusQueued // 重新放入队列等待转换
-	h.db.Save(task)
-	h.redisManager.SetTaskStatus(ctx, taskID, string(model.TaskStatusQueued))
+	updated, err := h.finishDownload(ctx, task, map[string]interface{}{
+		"input_path":    task.InputPath,
+		"original_name": task.OriginalName,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "更新下载任务状态失败", "error", err)
+		return
+	}
+	if !updated {
+		// 下载期间被取消或删除，删除已保存的文件
+		if err := h.store.Delete(ctx, inputPath); err != nil {
+			slog.WarnContext(ctx, "删除已取消任务的下载文件失败", "path", inputPath, "error", err)
+		}
+		slog.InfoContext(ctx, "任务已被取消，放弃下载的文件")
+		return
+	}
+
+	slog.InfoContext(ctx, "视频下载完成，等待转换", "file", originalName, "elapsed_ms", time.Since(startedAt).Milliseconds())
+	if h.processor != nil {
+		h.processor.AddTask(ctx, task)
+	}
+}
+
+// finishDownload 写入下载结果和任务的新状态，只在任务仍处于处理中时生效，返回是否已写入
+func (h *ConvertHandler) finishDownload(ctx context.Context, task *model.ConversionTask, updates map[string]interface{}) (bool, error) {
+	task.UpdatedAt = time.Now()
+	updates["status"] = task.Status
+	updates["updated_at"] = task.UpdatedAt
+	result := h.db.WithContext(ctx).Model(&model.ConversionTask{}).
+		Where("id = ? AND status = ?", task.ID, model.TaskStatusProcessing).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	h.redisManager.SetTaskStatus(ctx, task.ID, string(task.Status))
+	return true, nil
 }
 
-// downloadVideoFromService 从下载服务下载视频文件
-func (h *ConvertHandler) downloadVideoFromService(taskID, videoURL string) (string, string, error) {
+// downloadVideoFromService 从下载服务下载视频文件到任务的工作目录
+func (h *ConvertHandler) downloadVideoFromService(ctx context.Context, taskID, videoURL, workDir string) (string, string, error) {
 	// 构建请求URL
 	params := url.Values{}
 	params.Add("url", videoURL)
@@ -283,18 +383,23 @@ func (h *ConvertHandler) downloadVideoFromService(taskID, videoURL string) (stri
 
 	// 创建HTTP客户端
 	client := &http.Client{
-		Timeout: time.Duration(h.cfg.Download.Timeout) * time.Second,
+		Timeout:   time.Duration(h.cfg.Download.Timeout) * time.Second,
+		Transport: &tracing.Transport{},
 	}
 
 	// 下载视频
-	resp, err := client.Get(requestURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
 	if err != nil {
-		return "", "", fmt.Errorf("调用下载服务失败: %v", err)
+		return "", "", &downloadError{reason: "request", err: fmt.Errorf("构建下载请求失败: %v", err)}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", &downloadError{reason: "request", err: fmt.Errorf("调用下载服务失败: %v", err)}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("下载服务返回错误状态: %d", resp.StatusCode)
+		return "", "", &downloadError{reason: "http_" + strconv.Itoa(resp.StatusCode), err: fmt.Errorf("下载服务返回错误状态: %d", resp.StatusCode)}
 	}
 
 	// 检查Content-Type，如果是JSON则说明出错了
@@ -303,7 +408,7 @@ func (h *ConvertHandler) downloadVideoFromService(taskID, videoURL string) (stri
 		// 读取错误响应
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return "", "", fmt.Errorf("读取错误响应失败: %v", err)
+			return "", "", &downloadError{reason: "service_error", err: fmt.Errorf("读取错误响应失败: %v", err)}
 		}
 
 		// 尝试解析错误信息
@@ -313,48 +418,104 @@ func (h *ConvertHandler) downloadVideoFromService(taskID, videoURL string) (stri
 		}
 
 		if err := json.Unmarshal(body, &errorResp); err == nil {
-			return "", "", fmt.Errorf("下载服务错误[%d]: %s", errorResp.Code, errorResp.Message)
+			return "", "", &downloadError{reason: "service_error", err: fmt.Errorf("下载服务错误[%d]: %s", errorResp.Code, errorResp.Message)}
 		}
 
-		return "", "", fmt.Errorf("下载失败，可能是链接已过期或无效: %s", string(body))
+		return "", "", &downloadError{reason: "service_error", err: fmt.Errorf("下载失败，可能是链接已过期或无效: %s", string(body))}
 	}
 
-	// 从Content-Disposition头获取文件名
-	contentDisposition := resp.Header.Get("Content-Disposition")
-	var originalName string
-	if contentDisposition != "" {
-		// 解析 Content-Disposition 头
-		if matches := contentDispositionRegex.FindStringSubmatch(contentDisposition); len(matches) > 1 {
-			originalName = matches[1]
-		}
-	}
+	// 从Content-Disposition头获取文件名，文件名来自外部，清理后才用于本地路径
+	originalName := filemanager.FilenameFromContentDisposition(resp.Header.Get("Content-Disposition"))
 
 	// 如果没有获取到文件名，使用默认名称
 	if originalName == "" {
 		originalName = fmt.Sprintf("%s.mp4", taskID)
 	}
 
-	// 生成本地文件路径
-	inputPath := filepath.Join(h.cfg.File.TempDir, originalName)
-
 	// 创建本地文件
+	inputPath := filepath.Join(workDir, originalName)
 	file, err := os.Create(inputPath)
 	if err != nil {
-		return "", "", fmt.Errorf("创建本地文件失败: %v", err)
+		return "", "", &downloadError{reason: "local_write", err: fmt.Errorf("创建本地文件失败: %v", err)}
 	}
-	defer file.Close()
 
-	// 复制数据
+	// 复制数据，不完整的文件随工作目录一起删除
 	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return "", "", fmt.Errorf("保存视频文件失败: %v", err)
+		return "", "", &downloadError{reason: "transfer", err: fmt.Errorf("保存视频文件失败: %v", err)}
 	}
 
 	return inputPath, originalName, nil
 }
 
-// 正则表达式用于解析Content-Disposition头
-var contentDispositionRegex = regexp.MustCompile(`filename="([^"]+)"`)
+// storeDownload 将下载到工作目录的文件存入存储，与上传的文件放在同一目录，返回存储键
+func (h *ConvertHandler) storeDownload(ctx context.Context, taskID, tempPath string) (string, error) {
+	key := filepath.Join(h.cfg.File.UploadDir, taskID+strings.ToLower(filepath.Ext(tempPath)))
+	if err := h.store.PutFile(ctx, key, tempPath); err != nil {
+		return "", fmt.Errorf("保存视频文件失败: %v", err)
+	}
+	return key, nil
+}
+
+// downloadError 下载失败及其原因分类（用于监控指标）
+type downloadError struct {
+	reason string
+	err    error
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *downloadError) Unwrap() error {
+	return e.err
+}
+
+// downloadErrorReason 获取下载错误的原因分类，成功时返回空字符串
+func downloadErrorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var de *downloadError
+	if errors.As(err, &de) {
+		return de.reason
+	}
+	return "unknown"
+}
+
+// ListFormats 获取本节点支持的输出格式和转换参数
+func (h *ConvertHandler) ListFormats(c *gin.Context) {
+	caps := h.ffmpegConverter.Capabilities()
+	if caps == nil {
+		h.ErrorResponse(c, http.StatusServiceUnavailable, "尚未完成FFmpeg能力探测", nil)
+		return
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取支持格式成功", gin.H{
+		"ffmpeg_version": caps.FFmpegVersion,
+		"formats":        caps.Formats(),
+		"defaults": gin.H{
+			"format":        defaultFormatName(h.cfg.FFmpeg.AudioCodec),
+			"audio_codec":   h.cfg.FFmpeg.AudioCodec,
+			"audio_bitrate": h.cfg.FFmpeg.AudioBitrate,
+			"sample_rate":   h.cfg.FFmpeg.SampleRate,
+		},
+		"audio_bitrates": converter.AudioBitrates,
+		"sample_rates":   converter.SampleRates,
+		"detected_at":    caps.DetectedAt,
+	})
+}
+
+// defaultFormatName 默认编码器对应的输出格式名称
+func defaultFormatName(audioCodec string) string {
+	if format, ok := converter.FormatForEncoder(audioCodec); ok {
+		return format.Name
+	}
+	return ""
+}
 
 // isValidURL 简单的URL验证
 func isValidURL(url string) bool {
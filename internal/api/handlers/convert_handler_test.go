@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestDownloadAndProcessTask(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		duringCall func(db *gorm.DB, taskID string) // 下载服务返回数据前对任务的并发修改
+		wantStatus model.TaskStatus
+		wantOwner  string
+		wantInput  bool
+	}{
+		{
+			name: "下载期间认领任务不被覆盖",
+			duringCall: func(db *gorm.DB, taskID string) {
+				db.Model(&model.ConversionTask{}).Where("id = ?", taskID).
+					Updates(map[string]interface{}{"user_id": "member", "anonymous_id": ""})
+			},
+			wantStatus: model.TaskStatusQueued,
+			wantOwner:  "member",
+			wantInput:  true,
+		},
+		{
+			name: "下载期间取消",
+			duringCall: func(db *gorm.DB, taskID string) {
+				db.Model(&model.ConversionTask{}).Where("id = ?", taskID).Update("status", model.TaskStatusCanceled)
+			},
+			wantStatus: model.TaskStatusCanceled,
+			wantOwner:  "anonymous",
+		},
+		{
+			name:       "下载失败",
+			status:     http.StatusBadGateway,
+			wantStatus: model.TaskStatusFailed,
+			wantOwner:  "anonymous",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{}
+			cfg.File.UploadDir = filepath.Join(dir, "uploads")
+			cfg.File.TempDir = filepath.Join(dir, "temp")
+			cfg.Download.Timeout = 10
+			for _, d := range []string{cfg.File.UploadDir, cfg.File.TempDir} {
+				if err := os.MkdirAll(d, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deps, _ := newTestDeps(t, cfg)
+
+			task := &model.ConversionTask{
+				ID:          "22222222-2222-2222-2222-222222222222",
+				Type:        model.TaskTypeURLConvert,
+				Status:      model.TaskStatusQueued,
+				UserID:      "anonymous",
+				AnonymousID: "visitor",
+			}
+			if err := deps.DB.Create(task).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.duringCall != nil {
+					tt.duringCall(deps.DB, task.ID)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Header().Set("Content-Disposition", `attachment; filename="video.mp4"`)
+				w.Write([]byte("video"))
+			}))
+			defer service.Close()
+			cfg.Download.ServiceURL = service.URL
+
+			NewConvertHandler(deps).downloadAndProcessTask(context.Background(), task.ID, "https://example.com/v/1")
+
+			var stored model.ConversionTask
+			if err := deps.DB.First(&stored, "id = ?", task.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantStatus || stored.UserID != tt.wantOwner {
+				t.Errorf("status=%s user_id=%s，应为 status=%s user_id=%s", stored.Status, stored.UserID, tt.wantStatus, tt.wantOwner)
+			}
+			if (stored.InputPath != "") != tt.wantInput {
+				t.Errorf("input_path = %q", stored.InputPath)
+			}
+
+			// 取消或失败的任务不留下下载的文件
+			entries, _ := os.ReadDir(cfg.File.UploadDir)
+			if (len(entries) > 0) != tt.wantInput {
+				t.Errorf("上传目录中有 %d 个文件", len(entries))
+			}
+		})
+	}
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"video-converter/internal/model"
+	"video-converter/pkg/converter"
+	"video-converter/pkg/filemanager"
+	"video-converter/pkg/objectstore"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,12 +41,16 @@ func (h *DownloadHandler) DownloadFile(c *gin.Context) {
 
 	// 查找任务
 	var task model.ConversionTask
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
 		h.NotFoundError(c, "任务不存在")
 		return
 	}
 
 	// 检查任务状态
+	if task.Status == model.TaskStatusExpired {
+		h.ErrorResponse(c, http.StatusGone, "任务已过保留期，文件已删除", nil)
+		return
+	}
 	if task.Status != model.TaskStatusCompleted {
 		h.ErrorResponse(c, http.StatusBadRequest, "任务尚未完成，无法下载", nil)
 		return
@@ -50,40 +62,41 @@ func (h *DownloadHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	if _, err := os.Stat(task.OutputPath); os.IsNotExist(err) {
-		h.ErrorResponse(c, http.StatusNotFound, "输出文件不存在", nil)
-		return
+	// 设置下载文件名
+	filename := h.outputFileName(&task)
+	disposition := h.attachmentDisposition(filename)
+
+	// 存储支持预签名URL时重定向到存储直接下载，不经过服务端转发
+	if h.cfg.Storage.PresignDownloads {
+		location, err := h.store.PresignGet(c.Request.Context(), task.OutputPath, objectstore.PresignOptions{
+			ContentType:        outputContentType(&task),
+			ContentDisposition: disposition,
+			Expiry:             time.Duration(h.cfg.Storage.PresignExpiry) * time.Second,
+		})
+		switch {
+		case err == nil:
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, location)
+			return
+		case !errors.Is(err, objectstore.ErrPresignUnsupported):
+			slog.WarnContext(c.Request.Context(), "生成预签名下载URL失败，改由服务端转发", "task_id", task.ID, "error", err)
+		}
 	}
 
-	// 获取文件信息
-	fileInfo, err := os.Stat(task.OutputPath)
-	if err != nil {
+	// 打开输出文件
+	reader, info, err := h.store.Open(c.Request.Context(), task.OutputPath)
+	if errors.Is(err, objectstore.ErrNotExist) {
 		h.ErrorResponse(c, http.StatusNotFound, "输出文件不存在", nil)
 		return
 	}
-
-	// 设置下载文件名
-	filename := task.Title + ".mp3"
-	if task.OriginalName != "" {
-		// 如果有原始文件名，使用原始文件名但改为mp3扩展名
-		originalBase := filepath.Base(task.OriginalName)
-		ext := filepath.Ext(originalBase)
-		if ext != "" {
-			filename = originalBase[:len(originalBase)-len(ext)] + ".mp3"
-		}
+	if err != nil {
+		h.InternalError(c, err)
+		return
 	}
+	defer reader.Close()
 
-	// 设置响应头
 	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Type", "audio/mpeg")
-	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
-	c.Header("Cache-Control", "must-revalidate")
-	c.Header("Pragma", "public")
-
-	// 发送文件
-	c.File(task.OutputPath)
+	serveOutput(c, &task, filename, disposition, reader, info)
 }
 
 // CheckFile 检查文件是否存在（HEAD请求）
@@ -96,29 +109,101 @@ func (h *DownloadHandler) CheckFile(c *gin.Context) {
 
 	// 查找任务
 	var task model.ConversionTask
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
 		c.Status(http.StatusNotFound)
 		return
 	}
 
 	// 检查任务状态和文件
-	if task.Status == model.TaskStatusCompleted && task.OutputPath != "" {
-		if _, err := os.Stat(task.OutputPath); err == nil {
-			c.Header("X-File-Exists", "true")
-			c.Header("X-File-Size", getFileSize(task.OutputPath))
-			c.Status(http.StatusOK)
-			return
-		}
+	if task.Status != model.TaskStatusCompleted || task.OutputPath == "" {
+		c.Header("X-File-Exists", "false")
+		c.Status(http.StatusNotFound)
+		return
 	}
+	reader, info, err := h.store.Open(c.Request.Context(), task.OutputPath)
+	if err != nil {
+		c.Header("X-File-Exists", "false")
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	// 与GET相同的响应头和条件判断，HEAD请求不发送内容
+	filename := h.outputFileName(&task)
+	c.Header("X-File-Exists", "true")
+	c.Header("X-File-Size", strconv.FormatInt(info.Size, 10))
+	serveOutput(c, &task, filename, h.attachmentDisposition(filename), reader, info)
+}
 
-	c.Header("X-File-Exists", "false")
-	c.Status(http.StatusNotFound)
+// outputETag 以输出文件的内容哈希作为强ETag，没有哈希时返回空字符串
+func outputETag(task *model.ConversionTask) string {
+	if task.OutputHash == "" {
+		return ""
+	}
+	return `"` + task.OutputHash + `"`
 }
 
-// getFileSize 获取文件大小
-func getFileSize(filePath string) string {
-	if info, err := os.Stat(filePath); err == nil {
-		return string(rune(info.Size()))
+// serveOutput 发送输出文件，GET和HEAD共用
+// 有内容哈希时以其作为强ETag；条件请求（If-None-Match、If-Modified-Since、If-Range）
+// 和Range请求（包括多段范围）由 http.ServeContent 处理
+func serveOutput(c *gin.Context, task *model.ConversionTask, filename, disposition string, reader io.ReadSeeker, info *objectstore.ObjectInfo) {
+	c.Header("Content-Type", outputContentType(task))
+	c.Header("Content-Disposition", disposition)
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Cache-Control", "private, no-cache")
+	if etag := outputETag(task); etag != "" {
+		c.Header("ETag", etag)
+	}
+
+	http.ServeContent(c.Writer, c.Request, filename, info.ModTime, reader)
+}
+
+// attachmentDisposition 以附件形式下载的Content-Disposition，非ASCII文件名按 RFC 6266 编码
+func (h *BaseHandler) attachmentDisposition(filename string) string {
+	return filemanager.ContentDisposition(filename, h.cfg.File.DownloadNamePinyin)
+}
+
+// outputContentType 输出文件的Content-Type，按输出格式确定，早期任务按扩展名推断
+func outputContentType(task *model.ConversionTask) string {
+	if format, ok := converter.LookupOutputFormat(task.OutputFormat); ok {
+		return format.ContentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(task.OutputPath)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// outputFileName 下载时使用的文件名：按配置的模板生成，加上输出文件的扩展名
+func (h *BaseHandler) outputFileName(task *model.ConversionTask) string {
+	ext := filepath.Ext(task.OutputPath)
+	if ext == "" {
+		ext = ".mp3"
+	}
+
+	// 原始文件名去掉扩展名，没有时使用标题
+	originalName := task.Title
+	if task.OriginalName != "" {
+		originalBase := filepath.Base(task.OriginalName)
+		originalName = strings.TrimSuffix(originalBase, filepath.Ext(originalBase))
+	}
+	bitrate := task.AudioBitrate
+	if format, ok := converter.LookupOutputFormat(task.OutputFormat); ok && format.Lossless {
+		bitrate = "lossless"
+	}
+
+	name := strings.NewReplacer(
+		"{title}", task.Title,
+		"{original_name}", originalName,
+		"{date}", task.CreatedAt.Format("20060102"),
+		"{bitrate}", bitrate,
+		"{id}", task.ID,
+	).Replace(h.cfg.File.DownloadNameTemplate)
+
+	// 标题中可能含路径分隔符，替换后再整体清理，不能让其截掉前面的部分
+	name = filemanager.SanitizeFilename(strings.NewReplacer("/", "_", "\\", "_").Replace(name))
+	if name == "" {
+		name = task.ID
 	}
-	return "0"
+	return name + ext
 }
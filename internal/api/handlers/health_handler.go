@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"video-converter/internal/health"
+	"video-converter/pkg/converter"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ffmpegCheckCacheTTL ffmpeg能力检查结果的缓存时间
+const ffmpegCheckCacheTTL = time.Minute
+
+// HealthHandler 健康检查处理器
+type HealthHandler struct {
+	*BaseHandler
+	checker   *health.Checker
+	startedAt time.Time
+}
+
+// NewHealthHandler 创建健康检查处理器
+func NewHealthHandler(deps *Dependencies) *HealthHandler {
+	cfg := deps.Config
+	minFree := uint64(cfg.Health.MinFreeSpaceMB) * 1024 * 1024
+
+	ffmpegConverter := deps.Converter
+	if ffmpegConverter == nil {
+		ffmpegConverter = converter.NewFFmpegConverter(&cfg.FFmpeg)
+	}
+
+	checks := []health.Check{
+		health.DatabaseCheck(deps.DB),
+		health.RedisCheck(deps.Redis),
+		health.FFmpegCheck(ffmpegConverter, cfg.FFmpeg.AudioCodec, ffmpegCheckCacheTTL),
+		health.DirectoryCheck("upload", cfg.File.UploadDir, minFree),
+		health.DirectoryCheck("output", cfg.File.OutputDir, minFree),
+		health.DirectoryCheck("temp", cfg.File.TempDir, minFree),
+	}
+	if deps.DiskGuard != nil {
+		checks = append(checks, health.DiskGuardCheck(deps.DiskGuard))
+	}
+	if deps.Storage != nil && deps.Storage.Backend() != "local" {
+		// 本地存储已由目录检查覆盖
+		checks = append(checks, health.StorageCheck(deps.Storage))
+	}
+	if deps.Processor != nil {
+		checks = append(checks, health.Check{
+			Name:     "worker",
+			Critical: true,
+			Run: func(ctx context.Context) (map[string]interface{}, error) {
+				stats := deps.Processor.Stats()
+				details := map[string]interface{}{
+					"workers":      stats.Workers,
+					"busy_workers": stats.BusyWorkers,
+				}
+				if !stats.Running {
+					return details, errors.New("任务处理器未运行")
+				}
+				return details, nil
+			},
+		})
+	}
+	if cfg.Health.CheckDownloadService {
+		// 下载服务异常只影响URL转换，不影响文件上传转换
+		checks = append(checks, health.HTTPCheck("download_service", cfg.Download.ServiceURL, false))
+	}
+
+	return &HealthHandler{
+		BaseHandler: NewBaseHandler(deps),
+		checker:     health.NewChecker(time.Duration(cfg.Health.Timeout)*time.Second, checks...),
+		startedAt:   time.Now(),
+	}
+}
+
+// Livez 存活探针，只反映进程能否响应请求，不检查外部依赖
+func (h *HealthHandler) Livez(c *gin.Context) {
+	h.SuccessResponse(c, http.StatusOK, "服务运行正常", gin.H{
+		"status":         health.StatusUp,
+		"timestamp":      time.Now(),
+		"uptime_seconds": int64(time.Since(h.startedAt).Seconds()),
+	})
+}
+
+// Readyz 就绪探针，逐项检查依赖组件，关键组件异常时返回503
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.checker.Run(c.Request.Context())
+
+	switch report.Status {
+	case health.StatusDown:
+		c.JSON(http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Message: "服务未就绪",
+			Data:    report,
+		})
+	case health.StatusDegraded:
+		h.SuccessResponse(c, http.StatusOK, "服务已就绪，部分非关键组件异常", report)
+	default:
+		h.SuccessResponse(c, http.StatusOK, "服务已就绪", report)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+	"video-converter/pkg/objectstore"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestDeps 创建使用SQLite、miniredis和本地存储的处理器依赖
+func newTestDeps(t *testing.T, cfg *config.Config) (*Dependencies, *miniredis.Miniredis) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&model.ConversionTask{},
+		&model.User{},
+		&model.AuditLog{},
+		&model.FileBlob{},
+		&model.ShareLink{},
+	); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return &Dependencies{
+		Config:  cfg,
+		DB:      db,
+		Redis:   redisClient,
+		Storage: objectstore.NewLocalStore(),
+	}, mr
+}
+
+// stringReader 将字符串作为请求体
+func stringReader(s string) *strings.Reader {
+	return strings.NewReader(s)
+}
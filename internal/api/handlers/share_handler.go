@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-converter/internal/auth"
+	"video-converter/internal/model"
+	"video-converter/pkg/objectstore"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// sharePathPrefix 公开下载接口的路径前缀，与路由注册保持一致
+const sharePathPrefix = "/api/v1/share/"
+
+const (
+	// shareGrantCookie 保存下载凭证的Cookie，只发送到对应分享链接的路径
+	shareGrantCookie = "share_grant"
+	// shareGrantTTL 下载凭证的有效期，不超过分享链接本身的有效期
+	shareGrantTTL = time.Hour
+)
+
+// ShareHandler 分享链接处理器
+// 签名密钥未配置时使用进程级随机密钥，路由中只能创建一个实例
+type ShareHandler struct {
+	*BaseHandler
+	secret []byte
+}
+
+// CreateShareRequest 创建分享链接请求
+type CreateShareRequest struct {
+	ExpiresIn    int `json:"expires_in" binding:"omitempty,min=1"`    // 有效期（秒），为空时使用默认有效期
+	MaxDownloads int `json:"max_downloads" binding:"omitempty,min=0"` // 最多下载次数，0 表示不限
+}
+
+// ShareLinkResponse 分享链接信息
+type ShareLinkResponse struct {
+	model.ShareLink
+	Path string `json:"path"`
+	URL  string `json:"url"`
+}
+
+// NewShareHandler 创建分享链接处理器
+func NewShareHandler(deps *Dependencies) *ShareHandler {
+	secret := []byte(deps.Config.Share.Secret)
+	if len(secret) == 0 {
+		// 未配置密钥时使用进程级随机密钥，重启后已发出的分享链接失效
+		slog.Warn("未配置 share.secret，分享链接将在服务重启后失效")
+		random, err := auth.GenerateToken()
+		if err != nil {
+			panic(fmt.Sprintf("生成分享链接密钥失败: %v", err))
+		}
+		secret = []byte(random)
+	}
+
+	return &ShareHandler{
+		BaseHandler: NewBaseHandler(deps),
+		secret:      secret,
+	}
+}
+
+// CreateShare 为已完成的任务创建分享链接
+func (h *ShareHandler) CreateShare(c *gin.Context) {
+	var req CreateShareRequest
+	// 请求体可以为空，全部使用默认值
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.ValidationError(c, "请求参数格式错误: "+err.Error())
+		return
+	}
+
+	ttl := req.ExpiresIn
+	if ttl == 0 {
+		ttl = h.cfg.Share.DefaultTTL
+	}
+	if ttl > h.cfg.Share.MaxTTL {
+		h.ValidationError(c, fmt.Sprintf("有效期不能超过%d秒", h.cfg.Share.MaxTTL))
+		return
+	}
+
+	var task model.ConversionTask
+	if err := h.findOwnedTask(c, c.Param("id"), &task); err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
+	if task.Status != model.TaskStatusCompleted {
+		h.ErrorResponse(c, http.StatusBadRequest, "任务尚未完成，无法分享", nil)
+		return
+	}
+
+	// 令牌中的过期时间精确到秒，记录中保持一致
+	link := model.ShareLink{
+		ID:           uuid.New().String(),
+		TaskID:       task.ID,
+		UserID:       task.UserID,
+		AnonymousID:  task.AnonymousID,
+		ExpiresAt:    time.Now().Add(time.Duration(ttl) * time.Second).Truncate(time.Second),
+		MaxDownloads: req.MaxDownloads,
+	}
+	if err := h.dbCtx(c).Create(&link).Error; err != nil {
+		h.InternalError(c, fmt.Errorf("创建分享链接失败: %v", err))
+		return
+	}
+
+	h.SuccessResponse(c, http.StatusCreated, "分享链接已创建", h.linkResponse(c, link))
+}
+
+// ListShares 列出任务仍然有效的分享链接
+func (h *ShareHandler) ListShares(c *gin.Context) {
+	var task model.ConversionTask
+	if err := h.findOwnedTask(c, c.Param("id"), &task); err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
+
+	now := time.Now()
+	var links []model.ShareLink
+	if err := h.dbCtx(c).
+		Where("task_id = ? AND revoked_at IS NULL AND expires_at > ?", task.ID, now).
+		Order("created_at DESC").
+		Find(&links).Error; err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	// 令牌由记录确定性生成，列表中的链接与创建时返回的相同
+	items := make([]ShareLinkResponse, 0, len(links))
+	for _, link := range links {
+		if link.Active(now) {
+			items = append(items, h.linkResponse(c, link))
+		}
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "获取分享链接成功", gin.H{
+		"task_id": task.ID,
+		"items":   items,
+	})
+}
+
+// RevokeShare 撤销分享链接，撤销后链接立即失效
+func (h *ShareHandler) RevokeShare(c *gin.Context) {
+	var task model.ConversionTask
+	if err := h.findOwnedTask(c, c.Param("id"), &task); err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
+
+	var link model.ShareLink
+	if err := h.dbCtx(c).First(&link, "id = ? AND task_id = ?", c.Param("share_id"), task.ID).Error; err != nil {
+		h.NotFoundError(c, "分享链接不存在")
+		return
+	}
+
+	// 重复撤销保持第一次撤销的时间
+	if link.RevokedAt == nil {
+		now := time.Now()
+		if err := h.dbCtx(c).Model(&link).
+			Where("revoked_at IS NULL").
+			Update("revoked_at", now).Error; err != nil {
+			h.InternalError(c, fmt.Errorf("撤销分享链接失败: %v", err))
+			return
+		}
+		link.RevokedAt = &now
+	}
+
+	h.SuccessResponse(c, http.StatusOK, "分享链接已撤销", gin.H{
+		"id":         link.ID,
+		"task_id":    task.ID,
+		"revoked_at": link.RevokedAt,
+	})
+}
+
+// Download 通过分享链接下载文件（GET和HEAD），不需要登录
+// GET请求计入下载次数，并发放下载凭证；持有凭证的断点续传（见 isResume）和HEAD请求不计数。
+// 次数用完后只允许持有凭证的断点续传，其他请求（包括HEAD）都返回410
+func (h *ShareHandler) Download(c *gin.Context) {
+	id, expiresAt, ok := auth.VerifyShareToken(h.secret, c.Param("token"))
+	if !ok {
+		h.NotFoundError(c, "分享链接无效")
+		return
+	}
+	now := time.Now()
+	if !now.Before(expiresAt) {
+		h.ErrorResponse(c, http.StatusGone, "分享链接已过期", nil)
+		return
+	}
+
+	var link model.ShareLink
+	if err := h.dbCtx(c).First(&link, "id = ?", id).Error; err != nil {
+		h.NotFoundError(c, "分享链接无效")
+		return
+	}
+	if link.RevokedAt != nil {
+		h.ErrorResponse(c, http.StatusGone, "分享链接已撤销", nil)
+		return
+	}
+
+	var task model.ConversionTask
+	if err := h.dbCtx(c).First(&task, "id = ?", link.TaskID).Error; err != nil {
+		h.NotFoundError(c, "分享的文件不存在")
+		return
+	}
+	if task.Status == model.TaskStatusExpired {
+		h.ErrorResponse(c, http.StatusGone, "任务已过保留期，文件已删除", nil)
+		return
+	}
+	if task.Status != model.TaskStatusCompleted || task.OutputPath == "" {
+		h.NotFoundError(c, "分享的文件暂不可用")
+		return
+	}
+
+	// ETag 是公开的，只凭它不能续传，还需要计数的下载请求发放的凭证
+	resumed := isResume(c.Request, outputETag(&task)) && h.hasGrant(c, link.ID, now)
+	if !resumed && link.MaxDownloads > 0 && link.DownloadCount >= link.MaxDownloads {
+		h.ErrorResponse(c, http.StatusGone, "分享链接的下载次数已用完", nil)
+		return
+	}
+
+	if c.Request.Method == http.MethodGet && !resumed {
+		// 以次数和状态为条件原子递增，并发请求不会超过上限
+		result := h.dbCtx(c).Model(&model.ShareLink{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_downloads = 0 OR download_count < max_downloads)", link.ID, now).
+			UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+		if result.Error != nil {
+			h.InternalError(c, result.Error)
+			return
+		}
+		if result.RowsAffected == 0 {
+			h.ErrorResponse(c, http.StatusGone, "分享链接的下载次数已用完", nil)
+			return
+		}
+		h.grantDownload(c, &link, now)
+	}
+
+	reader, info, err := h.store.Open(c.Request.Context(), task.OutputPath)
+	if errors.Is(err, objectstore.ErrNotExist) {
+		h.NotFoundError(c, "分享的文件不存在")
+		return
+	}
+	if err != nil {
+		h.InternalError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	filename := h.outputFileName(&task)
+	serveOutput(c, &task, filename, h.attachmentDisposition(filename), reader, info)
+}
+
+// isResume 请求是否为断点续传
+// 只有带着与当前文件ETag相同的 If-Range 或 If-None-Match、且所有范围都不从第一个字节开始的GET请求
+// 视为断点续传；后缀范围 bytes=-N 和ETag不符的条件请求都可能返回完整文件，不视为续传
+func isResume(r *http.Request, etag string) bool {
+	return r.Method == http.MethodGet && etag != "" &&
+		(r.Header.Get("If-Range") == etag || etagListContains(r.Header.Get("If-None-Match"), etag)) &&
+		rangeSkipsFirstByte(r.Header.Get("Range"))
+}
+
+// grantDownload 为计数的下载请求发放下载凭证，凭证有效期内同一链接的断点续传不再计数
+func (h *ShareHandler) grantDownload(c *gin.Context, link *model.ShareLink, now time.Time) {
+	expiresAt := now.Add(shareGrantTTL)
+	if link.ExpiresAt.Before(expiresAt) {
+		expiresAt = link.ExpiresAt
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     shareGrantCookie,
+		Value:    auth.SignShareGrant(h.secret, link.ID, expiresAt),
+		Path:     c.Request.URL.Path,
+		Expires:  expiresAt,
+		MaxAge:   int(expiresAt.Sub(now).Seconds()),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// hasGrant 请求是否带有该分享链接有效的下载凭证
+func (h *ShareHandler) hasGrant(c *gin.Context, linkID string, now time.Time) bool {
+	grant, err := c.Cookie(shareGrantCookie)
+	if err != nil {
+		return false
+	}
+	return auth.VerifyShareGrant(h.secret, linkID, grant, now)
+}
+
+// etagListContains If-None-Match 的ETag列表中是否包含指定ETag（弱比较）
+func etagListContains(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeSkipsFirstByte Range头是否只包含起始位置大于0的字节范围
+// 后缀范围（bytes=-N）可以覆盖整个文件，视为从第一个字节开始
+func rangeSkipsFirstByte(header string) bool {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return false
+	}
+	for _, spec := range strings.Split(specs, ",") {
+		start, _, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		if !ok {
+			return false
+		}
+		offset, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || offset <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// linkResponse 生成分享链接的令牌和地址
+// 配置了 share.base_url 时使用该地址，否则按请求的协议和Host生成
+func (h *ShareHandler) linkResponse(c *gin.Context, link model.ShareLink) ShareLinkResponse {
+	path := sharePathPrefix + auth.SignShareToken(h.secret, link.ID, link.ExpiresAt)
+
+	base := strings.TrimRight(h.cfg.Share.BaseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+
+	return ShareLinkResponse{
+		ShareLink: link,
+		Path:      path,
+		URL:       base + path,
+	}
+}
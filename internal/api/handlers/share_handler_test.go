@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testETag = `"0123456789abcdef"`
+
+func TestIsResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		etag    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "完整下载"},
+		{name: "HEAD", method: http.MethodHead, headers: map[string]string{"Range": "bytes=100-", "If-Range": testETag}},
+		{name: "从头开始的Range", headers: map[string]string{"Range": "bytes=0-", "If-Range": testETag}},
+		{name: "续传", headers: map[string]string{"Range": "bytes=100-", "If-Range": testETag}, want: true},
+		{name: "续传带结束位置", headers: map[string]string{"Range": "bytes=100-199", "If-Range": testETag}, want: true},
+		{name: "以If-None-Match续传", headers: map[string]string{"Range": "bytes=100-", "If-None-Match": `W/` + testETag}, want: true},
+		{name: "续传不带ETag", headers: map[string]string{"Range": "bytes=100-"}},
+		{name: "If-Range不匹配", headers: map[string]string{"Range": "bytes=100-", "If-Range": `"other"`}},
+		{name: "If-Range为日期", headers: map[string]string{"Range": "bytes=100-", "If-Range": "Mon, 19 Oct 2026 00:00:00 GMT"}},
+		{name: "If-None-Match不匹配且无Range", headers: map[string]string{"If-None-Match": `"x"`}},
+		{name: "If-None-Match匹配但无Range", headers: map[string]string{"If-None-Match": testETag}},
+		{name: "后缀范围", headers: map[string]string{"Range": "bytes=-999999999999", "If-Range": testETag}},
+		{name: "多段范围包含第一个字节", headers: map[string]string{"Range": "bytes=100-199,0-10", "If-Range": testETag}},
+		{name: "多段范围都不含第一个字节", headers: map[string]string{"Range": "bytes=100-199,300-", "If-Range": testETag}, want: true},
+		{name: "无效Range", headers: map[string]string{"Range": "items=100-", "If-Range": testETag}},
+		{name: "没有内容哈希", etag: "-", headers: map[string]string{"Range": "bytes=100-", "If-Range": `""`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			etag := tt.etag
+			switch etag {
+			case "":
+				etag = testETag
+			case "-":
+				etag = ""
+			}
+			r := httptest.NewRequest(method, "/api/v1/share/token", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := isResume(r, etag); got != tt.want {
+				t.Errorf("isResume = %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newShareTestRouter 创建分享处理器和一个已完成的任务，返回创建分享链接的函数
+func newShareTestRouter(t *testing.T) (*gin.Engine, func(body string) ShareLinkResponse) {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Share = config.ShareConfig{Enabled: true, Secret: "test-secret", DefaultTTL: 3600, MaxTTL: 7200}
+	cfg.File.DownloadNameTemplate = "{original_name}"
+	deps, _ := newTestDeps(t, cfg)
+
+	output := filepath.Join(t.TempDir(), "output.mp3")
+	if err := os.WriteFile(output, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	task := model.ConversionTask{
+		ID:           "11111111-1111-1111-1111-111111111111",
+		UserID:       "owner",
+		Status:       model.TaskStatusCompleted,
+		OriginalName: "audio.mp4",
+		OutputFormat: "mp3",
+		OutputPath:   output,
+		OutputHash:   "0123456789abcdef",
+	}
+	if err := deps.DB.Create(&task).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewShareHandler(deps)
+	router := gin.New()
+	owner := func(c *gin.Context) { c.Set("user_id", "owner") }
+	router.POST("/api/v1/tasks/:id/share", owner, handler.CreateShare)
+	router.GET("/api/v1/share/:token", handler.Download)
+	router.HEAD("/api/v1/share/:token", handler.Download)
+
+	create := func(body string) ShareLinkResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/tasks/"+task.ID+"/share", nil)
+		if body != "" {
+			r = httptest.NewRequest(http.MethodPost, "/api/v1/tasks/"+task.ID+"/share", stringReader(body))
+			r.Header.Set("Content-Type", "application/json")
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("创建分享链接状态码 = %d，响应: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data ShareLinkResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+	return router, create
+}
+
+func TestShareDownloadLimit(t *testing.T) {
+	router, create := newShareTestRouter(t)
+	link := create(`{"max_downloads":1}`)
+	other := create(`{"max_downloads":1}`)
+
+	get := func(method, path string, grant *http.Cookie, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		for key, value := range headers {
+			r.Header.Set(key, value)
+		}
+		if grant != nil {
+			r.AddCookie(grant)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+	grantOf := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == shareGrantCookie {
+				return cookie
+			}
+		}
+		return nil
+	}
+	resume := map[string]string{"Range": "bytes=5-", "If-Range": testETag}
+
+	if w := get(http.MethodHead, link.Path, nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("HEAD 状态码 = %d", w.Code)
+	}
+	w := get(http.MethodGet, link.Path, nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("首次下载 = %d %q", w.Code, w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag != testETag {
+		t.Fatalf("ETag = %q，应为 %q", etag, testETag)
+	}
+	grant := grantOf(w)
+	if grant == nil || !grant.HttpOnly || grant.Path != link.Path {
+		t.Fatalf("下载凭证 = %+v，应为只发送到该链接路径的HttpOnly Cookie", grant)
+	}
+
+	// 次数用完后，没有凭证的请求（包括只凭公开ETag的续传和HEAD）和可能返回完整文件的请求都被拒绝
+	rejected := []struct {
+		method  string
+		grant   *http.Cookie
+		headers map[string]string
+	}{
+		{method: http.MethodGet},
+		{method: http.MethodHead},
+		{method: http.MethodHead, grant: grant},
+		{method: http.MethodGet, headers: map[string]string{"If-None-Match": `"x"`}},
+		{method: http.MethodGet, headers: map[string]string{"Range": "bytes=1-", "If-Range": testETag}},
+		{method: http.MethodGet, headers: resume},
+		{method: http.MethodGet, grant: grant},
+		{method: http.MethodGet, grant: grant, headers: map[string]string{"Range": "bytes=-999999999999", "If-Range": testETag}},
+		{method: http.MethodGet, grant: grant, headers: map[string]string{"Range": "bytes=0-", "If-Range": testETag}},
+		{method: http.MethodGet, grant: grant, headers: map[string]string{"Range": "bytes=5-", "If-Range": `"stale"`}},
+		{method: http.MethodGet, grant: grant, headers: map[string]string{"Range": "bytes=5-"}},
+		{method: http.MethodGet, grant: &http.Cookie{Name: shareGrantCookie, Value: grant.Value + "x"}, headers: resume},
+	}
+	for _, tt := range rejected {
+		if w := get(tt.method, link.Path, tt.grant, tt.headers); w.Code != http.StatusGone {
+			t.Errorf("次数用完后 %s 请求 %v (凭证 %v) 状态码 = %d，应为 410", tt.method, tt.headers, tt.grant != nil, w.Code)
+		}
+	}
+
+	// 持有凭证的断点续传仍然可以完成，且不计数
+	w = get(http.MethodGet, link.Path, grant, resume)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "56789" {
+		t.Errorf("续传 = %d %q，应为 206 \"56789\"", w.Code, w.Body.String())
+	}
+
+	// 凭证只对发放它的链接有效
+	first := get(http.MethodGet, other.Path, nil, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("另一个链接首次下载 = %d", first.Code)
+	}
+	if w := get(http.MethodGet, other.Path, grant, resume); w.Code != http.StatusGone {
+		t.Errorf("使用其他链接的凭证续传状态码 = %d，应为 410", w.Code)
+	}
+}
+
+func TestShareDownloadRejectsInvalidTokens(t *testing.T) {
+	router, create := newShareTestRouter(t)
+	link := create("")
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "有效", path: link.Path, want: http.StatusOK},
+		{name: "签名被修改", path: link.Path + "x", want: http.StatusNotFound},
+		{name: "格式错误", path: sharePathPrefix + "not-a-token", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("状态码 = %d，应为 %d，响应: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"video-converter/internal/model"
 
@@ -26,7 +27,8 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 	// 获取分页参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
-	status := c.Query("status") // 可选的状态过滤
+	status := c.Query("status")    // 可选的状态过滤
+	batchID := c.Query("batch_id") // 可选的批次过滤
 
 	if page < 1 {
 		page = 1
@@ -38,12 +40,15 @@ func (h *TaskHandler) ListTasks(c *gin.Context) {
 	offset := (page - 1) * perPage
 
 	// 构建查询
-	query := h.db.Model(&model.ConversionTask{})
+	query := h.dbCtx(c).Model(&model.ConversionTask{}).Scopes(h.ownerScope(c))
 
 	// 如果指定了状态，添加状态过滤
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if batchID != "" {
+		query = query.Where("batch_id = ?", batchID)
+	}
 
 	// 查询任务列表
 	var tasks []model.ConversionTask
@@ -85,7 +90,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 	}
 
 	var task model.ConversionTask
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
 		h.NotFoundError(c, "任务不存在")
 		return
 	}
@@ -102,7 +107,7 @@ func (h *TaskHandler) CancelTask(c *gin.Context) {
 	}
 
 	var task model.ConversionTask
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
 		h.NotFoundError(c, "任务不存在")
 		return
 	}
@@ -113,12 +118,23 @@ func (h *TaskHandler) CancelTask(c *gin.Context) {
 		return
 	}
 
-	// 更新任务状态为已取消
-	task.Status = model.TaskStatusCanceled
-	if err := h.db.Save(&task).Error; err != nil {
-		h.InternalError(c, err)
+	// 更新任务状态为已取消，只写入状态相关的列，以读取时的状态为条件，不覆盖并发的修改
+	result := h.dbCtx(c).Model(&task).
+		Where("status = ?", task.Status).
+		Updates(map[string]interface{}{
+			"status":     model.TaskStatusCanceled,
+			"updated_at": time.Now(),
+			"expires_at": nil, // 由保留策略按取消时间重新计算
+		})
+	if result.Error != nil {
+		h.InternalError(c, result.Error)
 		return
 	}
+	if result.RowsAffected == 0 {
+		h.ErrorResponse(c, http.StatusConflict, "任务状态已变化，请刷新后重试", nil)
+		return
+	}
+	task.Status = model.TaskStatusCanceled
 
 	h.SuccessResponse(c, http.StatusOK, "任务已取消", gin.H{
 		"task_id": taskID,
@@ -135,7 +151,7 @@ func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
 	}
 
 	var task model.ConversionTask
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
 		h.NotFoundError(c, "任务不存在")
 		return
 	}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-converter/internal/logger"
+	"video-converter/pkg/filemanager"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// tusVersion 支持的tus协议版本
+	tusVersion = "1.0.0"
+	// tusExtensions 支持的tus扩展
+	tusExtensions = "creation,termination,expiration"
+	// tusContentType PATCH请求要求的内容类型
+	tusContentType = "application/offset+octet-stream"
+	// tusLockTTL 单个上传的写锁有效期，需覆盖一次PATCH请求的最长耗时
+	tusLockTTL = 10 * time.Minute
+)
+
+// TusHandler tus 1.0 断点续传上传处理器
+// 协议说明见 https://tus.io/protocols/resumable-upload
+type TusHandler struct {
+	*UploadHandler
+}
+
+// NewTusHandler 创建断点续传上传处理器
+func NewTusHandler(deps *Dependencies) *TusHandler {
+	return &TusHandler{
+		UploadHandler: NewUploadHandler(deps),
+	}
+}
+
+// Options 返回服务端支持的协议版本、扩展和最大上传大小
+func (h *TusHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.cfg.File.MaxFileSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Create 创建上传（creation扩展），文件名等信息通过 Upload-Metadata 传递
+func (h *TusHandler) Create(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	// 已创建的上传可以继续传完，空间不足时只拒绝新的上传
+	if !h.checkDiskSpace(c) {
+		return
+	}
+
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		h.ValidationError(c, "不支持延迟声明上传长度")
+		return
+	}
+	size, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		h.ValidationError(c, "Upload-Length 无效")
+		return
+	}
+	if size == 0 {
+		h.ValidationError(c, "文件不能为空")
+		return
+	}
+	if size > h.cfg.File.MaxFileSize {
+		h.ErrorResponse(c, http.StatusRequestEntityTooLarge, "文件大小超过限制", nil)
+		return
+	}
+
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		h.ValidationError(c, "Upload-Metadata 格式错误: "+err.Error())
+		return
+	}
+
+	// 文件名、大小和转换参数在创建时即可校验，避免客户端传完才发现格式不支持
+	validationResult := h.fileValidator.ValidateFileName(metadata["filename"], size)
+	if !validationResult.Valid {
+		h.ErrorResponse(c, http.StatusBadRequest, "文件验证失败", fmt.Errorf("验证错误: %v", validationResult.Errors))
+		return
+	}
+	if _, err := h.uploadRequest(metadata); err != nil {
+		h.ValidationError(c, err.Error())
+		return
+	}
+
+	upload := &filemanager.TusUpload{
+		Size:      size,
+		Metadata:  metadata,
+		UserID:    h.currentUserID(c),
+		ExpiresAt: time.Now().Add(h.tusExpiration()),
+	}
+	if c.GetString("user_id") == "" {
+		upload.AnonymousID = c.GetString("anonymous_id")
+	}
+	if err := h.fileManager.CreateTusUpload(upload); err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "创建断点续传上传",
+		"upload_id", upload.ID, "file", metadata["filename"], "size", size)
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	h.SuccessResponse(c, http.StatusCreated, "上传已创建", gin.H{
+		"upload_id":  upload.ID,
+		"size":       upload.Size,
+		"expires_at": upload.ExpiresAt,
+	})
+}
+
+// Head 查询已接收的偏移量，客户端据此从断点继续上传
+func (h *TusHandler) Head(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	upload, ok := h.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.TaskID != "" {
+		c.Header("X-Task-ID", upload.TaskID)
+	}
+	c.Status(http.StatusOK)
+}
+
+// Patch 从 Upload-Offset 处追加数据，数据接收完整后校验文件并创建转换任务
+func (h *TusHandler) Patch(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	if c.ContentType() != tusContentType {
+		h.ErrorResponse(c, http.StatusUnsupportedMediaType, "Content-Type 必须为 "+tusContentType, nil)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.ValidationError(c, "Upload-Offset 无效")
+		return
+	}
+
+	upload, ok := h.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	// 同一上传同时只允许一个请求写入
+	ctx := c.Request.Context()
+	lockToken, err := h.redisManager.AcquireLock(ctx, "tus:"+upload.ID, tusLockTTL)
+	if err != nil {
+		h.InternalError(c, fmt.Errorf("获取上传锁失败: %v", err))
+		return
+	}
+	if lockToken == "" {
+		h.ErrorResponse(c, http.StatusLocked, "上传正在被其他请求写入", nil)
+		return
+	}
+	// 客户端中途断开时请求的context已取消，释放锁不能使用它，否则锁要到过期才释放，续传请求会一直被拒绝
+	defer h.redisManager.ReleaseLock(context.WithoutCancel(ctx), "tus:"+upload.ID, lockToken)
+
+	// 加锁后重新读取状态，期间可能有其他请求写入过数据
+	upload, ok = h.loadUpload(c)
+	if !ok {
+		return
+	}
+	if upload.TaskID != "" || offset != upload.Offset {
+		h.ErrorResponse(c, http.StatusConflict, "上传偏移量不匹配", filemanager.ErrTusOffsetMismatch)
+		return
+	}
+
+	// 每次写入都顺延过期时间，持续上传的大文件不会中途过期
+	upload.ExpiresAt = time.Now().Add(h.tusExpiration())
+	_, err = h.fileManager.WriteTusChunk(upload, offset, c.Request.Body)
+	if err != nil {
+		if errors.Is(err, filemanager.ErrTusSizeExceeded) {
+			// 客户端发送的数据与声明不符，已接收的数据不可信，直接终止上传
+			h.fileManager.DeleteTusUpload(upload.ID)
+			h.ErrorResponse(c, http.StatusRequestEntityTooLarge, "数据超过声明的上传长度", err)
+			return
+		}
+		// 连接中断时已接收的数据已经保存，客户端通过HEAD获取偏移量后继续
+		slog.WarnContext(ctx, "断点续传写入中断", "upload_id", upload.ID, "offset", upload.Offset, "error", err)
+		h.ErrorResponse(c, http.StatusInternalServerError, "写入上传数据失败", err)
+		return
+	}
+
+	if upload.Complete() {
+		if !h.finalize(c, upload) {
+			return
+		}
+		c.Header("X-Task-ID", upload.TaskID)
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// Delete 终止上传并删除已接收的数据（termination扩展）
+func (h *TusHandler) Delete(c *gin.Context) {
+	if !h.checkVersion(c) {
+		return
+	}
+
+	upload, ok := h.loadUpload(c)
+	if !ok {
+		return
+	}
+
+	if err := h.fileManager.DeleteTusUpload(upload.ID); err != nil {
+		h.InternalError(c, err)
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(http.StatusNoContent)
+}
+
+// finalize 校验已接收完整的文件并创建转换任务，校验失败时删除上传
+func (h *TusHandler) finalize(c *gin.Context, upload *filemanager.TusUpload) bool {
+	file, err := h.fileManager.OpenTusData(upload)
+	if err != nil {
+		h.InternalError(c, fmt.Errorf("打开上传数据失败: %v", err))
+		return false
+	}
+	contentValidation := h.fileValidator.ValidateFileContent(file, upload.Metadata["filename"])
+	file.Close()
+	if !contentValidation.Valid {
+		h.fileManager.DeleteTusUpload(upload.ID)
+		h.ErrorResponse(c, http.StatusBadRequest, "文件内容验证失败", fmt.Errorf("内容验证错误: %v", contentValidation.Errors))
+		return false
+	}
+
+	fileInfo, err := h.fileManager.FinalizeTusUpload(upload)
+	if err != nil {
+		h.InternalError(c, err)
+		return false
+	}
+	fileInfo.MimeType = contentValidation.ContentType
+
+	mediaValidation := h.fileValidator.ValidateMedia(c.Request.Context(), fileInfo.FilePath)
+	if !mediaValidation.Valid {
+		h.fileManager.DeleteFile(fileInfo.FilePath)
+		h.fileManager.DeleteTusUpload(upload.ID)
+		h.ErrorResponse(c, http.StatusBadRequest, "文件内容验证失败", fmt.Errorf("内容验证错误: %v", mediaValidation.Errors))
+		return false
+	}
+
+	req, err := h.uploadRequest(upload.Metadata)
+	if err != nil {
+		// 创建时已检查过参数，节点的FFmpeg能力变化时才会走到这里
+		h.fileManager.DeleteFile(fileInfo.FilePath)
+		h.fileManager.DeleteTusUpload(upload.ID)
+		h.ValidationError(c, err.Error())
+		return false
+	}
+	if req.Title == "" {
+		req.Title = fileInfo.OriginalName
+	}
+	task, err := h.createUploadTask(c, fileInfo, req, "")
+	if err != nil {
+		// 数据文件已被移走，无法再续传，直接删除上传
+		h.fileManager.DeleteTusUpload(upload.ID)
+		h.InternalError(c, err)
+		return false
+	}
+
+	// 保留状态文件到过期，客户端重试HEAD时仍能得到任务ID
+	upload.TaskID = task.ID
+	if err := h.fileManager.SaveTusUpload(upload); err != nil {
+		slog.WarnContext(logger.WithTaskID(c.Request.Context(), task.ID), "保存断点续传状态失败",
+			"upload_id", upload.ID, "error", err)
+	}
+	return true
+}
+
+// uploadRequest 从 Upload-Metadata 中读取标题、描述和转换参数，字段与普通上传的表单一致
+func (h *TusHandler) uploadRequest(metadata map[string]string) (*UploadRequest, error) {
+	req := &UploadRequest{}
+	for key, value := range metadata {
+		if err := req.setFormValue(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := req.resolve(&h.cfg.FFmpeg, h.ffmpegConverter.Capabilities()); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// loadUpload 读取当前请求者的上传，不存在、无权访问或已过期时直接写入响应
+func (h *TusHandler) loadUpload(c *gin.Context) (*filemanager.TusUpload, bool) {
+	c.Header("Tus-Resumable", tusVersion)
+
+	upload, err := h.fileManager.GetTusUpload(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, filemanager.ErrTusUploadNotFound) {
+			h.NotFoundError(c, "上传不存在")
+		} else {
+			h.InternalError(c, err)
+		}
+		return nil, false
+	}
+
+	if !h.ownsUpload(c, upload) {
+		h.NotFoundError(c, "上传不存在")
+		return nil, false
+	}
+
+	if upload.Expired() {
+		h.fileManager.DeleteTusUpload(upload.ID)
+		h.ErrorResponse(c, http.StatusGone, "上传已过期", nil)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// ownsUpload 检查上传是否属于当前请求者，规则与 ownerScope 一致
+func (h *TusHandler) ownsUpload(c *gin.Context, upload *filemanager.TusUpload) bool {
+	if userID := c.GetString("user_id"); userID != "" {
+		return upload.UserID == userID
+	}
+	anonymousID := c.GetString("anonymous_id")
+	return anonymousID != "" && upload.UserID == defaultUserID && upload.AnonymousID == anonymousID
+}
+
+// checkVersion 检查客户端的协议版本，不支持时返回412
+func (h *TusHandler) checkVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") == tusVersion {
+		return true
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	h.ErrorResponse(c, http.StatusPreconditionFailed, "不支持的tus协议版本", nil)
+	return false
+}
+
+// tusExpiration 未完成上传的保留时间
+func (h *TusHandler) tusExpiration() time.Duration {
+	return time.Duration(h.cfg.File.TusExpiration) * time.Hour
+}
+
+// parseTusMetadata 解析 Upload-Metadata，格式为逗号分隔的 "键 base64值"，值可以省略
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("键不能为空")
+		}
+		if _, exists := metadata[key]; exists {
+			return nil, fmt.Errorf("键 %s 重复", key)
+		}
+
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("键 %s 的值不是有效的base64", key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
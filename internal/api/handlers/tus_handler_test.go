@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "空", header: "", want: map[string]string{}},
+		{name: "只有空白", header: "  ", want: map[string]string{}},
+		{name: "单个键值", header: "filename dmlkZW8ubXA0", want: map[string]string{"filename": "video.mp4"}},
+		{
+			name:   "多个键值",
+			header: "filename 6KeG6aKRLm1wNA==, output_format bXAz",
+			want:   map[string]string{"filename": "视频.mp4", "output_format": "mp3"},
+		},
+		{name: "没有值的键", header: "is_confidential", want: map[string]string{"is_confidential": ""}},
+		{name: "值不是base64", header: "filename not-base64!", wantErr: true},
+		{name: "键为空", header: "filename dmlkZW8ubXA0,", wantErr: true},
+		{name: "键重复", header: "filename YQ==,filename Yg==", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTusMetadata(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTusMetadata(%q) 应返回错误，实际为 %v", tt.header, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTusMetadata(%q) 失败: %v", tt.header, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTusMetadata(%q) = %v，应为 %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
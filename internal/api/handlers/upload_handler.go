@@ -1,14 +1,24 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	"video-converter/internal/logger"
 	"video-converter/internal/model"
 	"video-converter/internal/storage"
+	"video-converter/internal/tracing"
+	"video-converter/pkg/converter"
 	"video-converter/pkg/filemanager"
 	"video-converter/pkg/validator"
 
@@ -16,18 +26,32 @@ import (
 	"github.com/google/uuid"
 )
 
+// maxFormValueSize 上传表单中普通字段的最大长度
+const maxFormValueSize = 64 << 10
+
+var (
+	// errTooManyFiles 一次上传的文件数超过限制
+	errTooManyFiles = errors.New("文件数量超过限制")
+	// errBatchTooLarge 一次上传的文件总大小超过限制
+	errBatchTooLarge = errors.New("上传总大小超过限制")
+)
+
 // UploadHandler 文件上传处理器
 type UploadHandler struct {
 	*BaseHandler
-	fileManager   *filemanager.FileManager
-	fileValidator *validator.FileValidator
-	redisManager  *storage.RedisManager
+	fileManager     *filemanager.FileManager
+	fileValidator   *validator.FileValidator
+	redisManager    *storage.RedisManager
+	blobStore       *storage.BlobStore
+	ffmpegConverter *converter.FFmpegConverter
 }
 
 // UploadRequest 上传请求
 type UploadRequest struct {
-	Title       string `json:"title"`       // 可选的任务标题
-	Description string `json:"description"` // 可选的任务描述
+	Title       string `json:"title"`        // 可选的任务标题
+	Description string `json:"description"`  // 可选的任务描述
+	AutoConvert bool   `json:"auto_convert"` // 上传后立即排队转换，否则需调用文件转换接口提交
+	ConversionParams
 }
 
 // UploadResponse 上传响应
@@ -40,6 +64,47 @@ type UploadResponse struct {
 	FileInfo     *filemanager.FileInfo `json:"file_info"`
 }
 
+// BatchUploadResponse 多文件或压缩包上传的响应
+type BatchUploadResponse struct {
+	BatchID string           `json:"batch_id"`
+	Tasks   []UploadResponse `json:"tasks"`
+	Skipped []SkippedFile    `json:"skipped,omitempty"` // 压缩包中未被接受的条目
+}
+
+// SkippedFile 压缩包中未被接受的条目及原因
+type SkippedFile struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// uploadedFile 本次请求已保存的文件
+type uploadedFile struct {
+	info  *filemanager.FileInfo
+	entry string // 来自压缩包时为条目路径
+}
+
+// uploadBudget 本次请求剩余可接收的文件数和总大小
+type uploadBudget struct {
+	files int
+	bytes int64
+}
+
+// take 扣除一个已保存的文件
+func (b *uploadBudget) take(size int64) {
+	b.files--
+	b.bytes -= size
+}
+
+// uploadRejection 上传的文件未通过验证
+type uploadRejection struct {
+	message string
+	err     error
+}
+
+func (e *uploadRejection) Error() string {
+	return e.message + ": " + e.err.Error()
+}
+
 // NewUploadHandler 创建上传处理器
 func NewUploadHandler(deps *Dependencies) *UploadHandler {
 	// 创建文件管理器
@@ -54,105 +119,421 @@ func NewUploadHandler(deps *Dependencies) *UploadHandler {
 		deps.Config.File.MaxFileSize,
 		deps.Config.File.AllowedTypes,
 	)
+	ffmpegConverter := deps.Converter
+	if ffmpegConverter == nil {
+		ffmpegConverter = converter.NewFFmpegConverter(&deps.Config.FFmpeg)
+	}
+	if deps.Config.File.DeepValidation {
+		fv.EnableDeepValidation(ffmpegConverter)
+	}
 
 	// 创建Redis管理器
 	rm := storage.NewRedisManager(deps.Redis)
 
 	return &UploadHandler{
-		BaseHandler:   NewBaseHandler(deps),
-		fileManager:   fm,
-		fileValidator: fv,
-		redisManager:  rm,
+		BaseHandler:     NewBaseHandler(deps),
+		fileManager:     fm,
+		fileValidator:   fv,
+		redisManager:    rm,
+		blobStore:       storage.NewBlobStore(deps.DB, deps.Storage),
+		ffmpegConverter: ffmpegConverter,
 	}
 }
 
 // UploadFile 处理文件上传
+// 按顺序读取multipart的各个部分，文件直接写入上传目录，不在内存或临时文件中缓冲整个表单
+// 表单可同时携带转换参数，auto_convert为true时任务直接进入转换队列
+// 可以包含多个file部分或ZIP/TAR压缩包，此时每个文件创建一个任务，以批次ID归组
 func (h *UploadHandler) UploadFile(c *gin.Context) {
-	// 1. 解析multipart表单
-	err := c.Request.ParseMultipartForm(h.cfg.File.MaxFileSize)
+	if !h.checkDiskSpace(c) {
+		return
+	}
+
+	// 1. 以流的方式读取multipart表单
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		h.ErrorResponse(c, http.StatusBadRequest, "解析上传表单失败", err)
 		return
 	}
 
-	// 2. 获取上传的文件
-	file, fileHeader, err := c.Request.FormFile("file")
-	if err != nil {
+	var (
+		files   []uploadedFile
+		skipped []SkippedFile
+		archive bool
+		req     UploadRequest
+	)
+	budget := &uploadBudget{files: h.cfg.File.MaxBatchFiles, bytes: h.cfg.File.MaxBatchSize}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.discardUploads(files)
+			h.uploadError(c, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			if kind, ok := filemanager.DetectArchive(part.FileName()); ok {
+				archive = true
+				var entries []uploadedFile
+				var entriesSkipped []SkippedFile
+				entries, entriesSkipped, err = h.saveArchivePart(c.Request.Context(), part, kind, budget)
+				files = append(files, entries...)
+				skipped = append(skipped, entriesSkipped...)
+			} else {
+				var fileInfo *filemanager.FileInfo
+				if fileInfo, err = h.saveFile(part.FileName(), part, budget); err == nil {
+					files = append(files, uploadedFile{info: fileInfo})
+				}
+			}
+		default:
+			var value string
+			if value, err = readFormValue(part); err == nil {
+				err = req.setFormValue(part.FormName(), value)
+			}
+		}
+		part.Close()
+
+		if err != nil {
+			h.discardUploads(files)
+			h.uploadError(c, err)
+			return
+		}
+	}
+
+	if len(files) == 0 {
+		if archive {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "压缩包中没有可转换的文件",
+				Data:    gin.H{"skipped": skipped},
+			})
+			return
+		}
 		h.ValidationError(c, "未找到上传文件，请确保表单字段名为'file'")
 		return
 	}
-	defer file.Close()
 
-	// 3. 验证文件基本信息
-	validationResult := h.fileValidator.ValidateFile(fileHeader)
-	if !validationResult.Valid {
-		h.ErrorResponse(c, http.StatusBadRequest, "文件验证失败", fmt.Errorf("验证错误: %v", validationResult.Errors))
+	// 5. 检查转换参数，未要求立即转换时也提前检查，避免上传后才发现参数无效
+	if err := req.resolve(&h.cfg.FFmpeg, h.ffmpegConverter.Capabilities()); err != nil {
+		h.discardUploads(files)
+		h.ValidationError(c, err.Error())
 		return
 	}
 
-	// 4. 验证文件内容
-	contentValidation := h.fileValidator.ValidateFileContent(file)
-	if !contentValidation.Valid {
-		h.ErrorResponse(c, http.StatusBadRequest, "文件内容验证失败", fmt.Errorf("内容验证错误: %v", contentValidation.Errors))
+	// 6. 深度验证，确认文件可以被转换；压缩包中的条目验证失败时跳过
+	accepted := make([]uploadedFile, 0, len(files))
+	for _, file := range files {
+		mediaValidation := h.fileValidator.ValidateMedia(c.Request.Context(), file.info.FilePath)
+		if mediaValidation.Valid {
+			accepted = append(accepted, file)
+			continue
+		}
+		h.fileManager.DeleteFile(file.info.FilePath)
+		if file.entry == "" {
+			h.discardUploads(files)
+			h.ErrorResponse(c, http.StatusBadRequest, "文件内容验证失败", fmt.Errorf("内容验证错误: %v", mediaValidation.Errors))
+			return
+		}
+		skipped = append(skipped, SkippedFile{Name: file.entry, Reason: fmt.Sprintf("内容验证错误: %v", mediaValidation.Errors)})
+	}
+	files = accepted
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "压缩包中没有可转换的文件",
+			Data:    gin.H{"skipped": skipped},
+		})
+		return
+	}
+
+	// 单个文件保持原有的响应格式
+	if len(files) == 1 && !archive {
+		h.createSingleUpload(c, files[0].info, &req)
 		return
 	}
+	h.createBatchUpload(c, files, skipped, &req)
+}
 
-	// 5. 保存文件
-	fileInfo, err := h.fileManager.SaveUploadedFile(fileHeader)
+// createSingleUpload 为单个上传文件创建任务并响应
+func (h *UploadHandler) createSingleUpload(c *gin.Context, fileInfo *filemanager.FileInfo, req *UploadRequest) {
+	// 7. 如果没有提供标题，使用原文件名
+	if req.Title == "" {
+		req.Title = fileInfo.OriginalName
+	}
+
+	// 8. 创建任务
+	task, err := h.createUploadTask(c, fileInfo, req, "")
 	if err != nil {
-		h.InternalError(c, fmt.Errorf("保存文件失败: %v", err))
+		h.InternalError(c, err)
 		return
 	}
 
-	// 6. 获取可选的表单参数
-	title := c.PostForm("title")
-	description := c.PostForm("description")
+	// 9. 构造响应
+	h.SuccessResponse(c, http.StatusCreated, "文件上传成功", newUploadResponse(task, fileInfo))
+}
 
-	// 如果没有提供标题，使用原文件名
-	if title == "" {
-		title = fileHeader.Filename
+// createBatchUpload 为多个上传文件创建同一批次的任务并响应
+// 各任务以原文件名为标题，描述和转换参数共用
+func (h *UploadHandler) createBatchUpload(c *gin.Context, files []uploadedFile, skipped []SkippedFile, req *UploadRequest) {
+	batchID := uuid.New().String()
+	response := BatchUploadResponse{
+		BatchID: batchID,
+		Tasks:   make([]UploadResponse, 0, len(files)),
+		Skipped: skipped,
+	}
+
+	for i, file := range files {
+		fileReq := *req
+		fileReq.Title = file.info.OriginalName
+
+		task, err := h.createUploadTask(c, file.info, &fileReq, batchID)
+		if err != nil {
+			// 已创建的任务保留在批次中，可通过批次查询
+			h.discardUploads(files[i+1:])
+			h.InternalError(c, err)
+			return
+		}
+		response.Tasks = append(response.Tasks, newUploadResponse(task, file.info))
+	}
+
+	slog.InfoContext(c.Request.Context(), "批量上传成功", "batch_id", batchID,
+		"tasks", len(response.Tasks), "skipped", len(skipped))
+	h.SuccessResponse(c, http.StatusCreated, "批量上传成功", response)
+}
+
+// newUploadResponse 构造单个文件的上传响应
+func newUploadResponse(task *model.ConversionTask, fileInfo *filemanager.FileInfo) UploadResponse {
+	return UploadResponse{
+		TaskID:       task.ID,
+		OriginalName: fileInfo.OriginalName,
+		FileSize:     fileInfo.Size,
+		Status:       string(task.Status),
+		UploadedAt:   task.CreatedAt,
+		FileInfo:     fileInfo,
+	}
+}
+
+// saveFile 验证文件并直接写入上传目录
+// 超出单个文件大小限制返回 filemanager.ErrFileTooLarge，超出本次上传的总限制返回 errBatchTooLarge
+func (h *UploadHandler) saveFile(filename string, src io.Reader, budget *uploadBudget) (*filemanager.FileInfo, error) {
+	if budget.files <= 0 {
+		return nil, errTooManyFiles
+	}
+	if budget.bytes <= 0 {
+		return nil, errBatchTooLarge
+	}
+
+	// 2. 验证文件基本信息，大小在写入过程中限制
+	validationResult := h.fileValidator.ValidateFileName(filename, 0)
+	if !validationResult.Valid {
+		return nil, &uploadRejection{message: "文件验证失败", err: fmt.Errorf("验证错误: %v", validationResult.Errors)}
+	}
+
+	// 3. 预读文件头验证文件内容，预读的数据仍会写入文件
+	buffered := bufio.NewReaderSize(src, 512)
+	header, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%w: %w", filemanager.ErrUploadRead, err)
+	}
+	contentValidation := h.fileValidator.ValidateFileHeader(header, filename)
+	if !contentValidation.Valid {
+		return nil, &uploadRejection{message: "文件内容验证失败", err: fmt.Errorf("内容验证错误: %v", contentValidation.Errors)}
+	}
+
+	// 4. 边接收边写入并计算哈希
+	maxSize := h.cfg.File.MaxFileSize
+	if budget.bytes < maxSize {
+		maxSize = budget.bytes
+	}
+	fileInfo, err := h.fileManager.SaveUploadStream(filename, buffered, maxSize)
+	if err != nil {
+		if errors.Is(err, filemanager.ErrFileTooLarge) && maxSize < h.cfg.File.MaxFileSize {
+			return nil, errBatchTooLarge
+		}
+		return nil, err
+	}
+	fileInfo.MimeType = contentValidation.ContentType
+	budget.take(fileInfo.Size)
+
+	return fileInfo, nil
+}
+
+// saveArchivePart 逐个验证并保存压缩包中的文件
+// 不支持的文件、验证失败或超过单个文件大小限制的条目跳过，超出本次上传的总限制时整体失败
+func (h *UploadHandler) saveArchivePart(ctx context.Context, part *multipart.Part, kind filemanager.ArchiveKind, budget *uploadBudget) ([]uploadedFile, []SkippedFile, error) {
+	archiveName := part.FileName()
+	var (
+		files   []uploadedFile
+		skipped []SkippedFile
+	)
+	saveEntry := func(entry filemanager.ArchiveEntry, r io.Reader) error {
+		fileInfo, err := h.saveFile(entry.Name(), r, budget)
+		var rejection *uploadRejection
+		switch {
+		case err == nil:
+			files = append(files, uploadedFile{info: fileInfo, entry: entry.Path})
+			return nil
+		case errors.As(err, &rejection):
+			skipped = append(skipped, SkippedFile{Name: entry.Path, Reason: rejection.err.Error()})
+			return nil
+		case errors.Is(err, filemanager.ErrFileTooLarge):
+			skipped = append(skipped, SkippedFile{Name: entry.Path, Reason: "文件大小超过限制"})
+			return nil
+		}
+		return err
+	}
+
+	var err error
+	switch kind {
+	case filemanager.ArchiveZip:
+		// zip的目录位于文件末尾，需要先完整保存再读取
+		var archivePath string
+		archivePath, err = h.fileManager.SaveTempStream("upload-*.zip", part, h.cfg.File.MaxBatchSize)
+		if errors.Is(err, filemanager.ErrFileTooLarge) {
+			err = errBatchTooLarge
+		}
+		if err == nil {
+			err = filemanager.WalkZip(archivePath, saveEntry)
+			os.Remove(archivePath)
+		}
+	default:
+		err = filemanager.WalkTar(part, kind == filemanager.ArchiveTarGz, saveEntry)
+	}
+	if err != nil {
+		return files, skipped, err
+	}
+
+	slog.InfoContext(ctx, "压缩包解析完成", "archive", archiveName, "files", len(files), "skipped", len(skipped))
+	return files, skipped, nil
+}
+
+// uploadError 上传失败时的响应，超出大小限制返回413
+func (h *UploadHandler) uploadError(c *gin.Context, err error) {
+	var (
+		maxBytesErr *http.MaxBytesError
+		rejection   *uploadRejection
+	)
+	switch {
+	case errors.As(err, &rejection):
+		h.ErrorResponse(c, http.StatusBadRequest, rejection.message, rejection.err)
+	case errors.Is(err, errBatchTooLarge):
+		h.ErrorResponse(c, http.StatusRequestEntityTooLarge, "上传总大小超过限制",
+			fmt.Errorf("最大允许 %s", filemanager.FormatFileSize(h.cfg.File.MaxBatchSize)))
+	case errors.Is(err, filemanager.ErrFileTooLarge) || errors.As(err, &maxBytesErr):
+		h.ErrorResponse(c, http.StatusRequestEntityTooLarge, "文件大小超过限制",
+			fmt.Errorf("最大允许 %s", h.fileValidator.GetMaxSizeText()))
+	case errors.Is(err, errTooManyFiles):
+		h.ValidationError(c, fmt.Sprintf("一次最多上传 %d 个文件", h.cfg.File.MaxBatchFiles))
+	case errors.Is(err, filemanager.ErrUnsafeArchivePath), errors.Is(err, filemanager.ErrInvalidArchive):
+		h.ErrorResponse(c, http.StatusBadRequest, "压缩包无效", err)
+	case errors.Is(err, filemanager.ErrUploadRead):
+		h.ErrorResponse(c, http.StatusBadRequest, "读取上传数据失败", err)
+	default:
+		h.InternalError(c, err)
+	}
+}
+
+// discardUploads 请求失败时删除已保存的上传文件
+func (h *UploadHandler) discardUploads(files []uploadedFile) {
+	for _, file := range files {
+		h.fileManager.DeleteFile(file.info.FilePath)
+	}
+}
+
+// setFormValue 设置上传表单字段，未知字段忽略
+func (r *UploadRequest) setFormValue(name, value string) error {
+	switch name {
+	case "title":
+		r.Title = value
+	case "description":
+		r.Description = value
+	case "auto_convert":
+		autoConvert, err := parseFormBool(name, value)
+		if err != nil {
+			return err
+		}
+		r.AutoConvert = autoConvert
+	default:
+		_, err := r.ConversionParams.setFormValue(name, value)
+		return err
+	}
+	return nil
+}
+
+// readFormValue 读取普通表单字段，限制长度避免超大字段占用内存
+func readFormValue(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize+1))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", filemanager.ErrUploadRead, err)
+	}
+	if len(value) > maxFormValueSize {
+		return "", fmt.Errorf("表单字段 %s 过长", part.FormName())
+	}
+	return string(value), nil
+}
+
+// createUploadTask 为已保存的上传文件创建任务，转换参数需已检查
+// 要求立即转换时任务直接排队并交给任务处理器，否则等待提交转换
+// 已有相同内容的文件时任务共享该文件；保存任务失败时释放对文件的引用
+func (h *UploadHandler) createUploadTask(c *gin.Context, fileInfo *filemanager.FileInfo, req *UploadRequest, batchID string) (*model.ConversionTask, error) {
+	inputPath, err := h.blobStore.AcquireInput(c.Request.Context(), fileInfo.SHA256Hash, fileInfo.FilePath, fileInfo.Size)
+	if err != nil {
+		h.fileManager.DeleteFile(fileInfo.FilePath)
+		return nil, err
+	}
+	fileInfo.FilePath = inputPath
+	fileInfo.SavedName = filepath.Base(inputPath)
+
+	status := model.TaskStatusUploaded
+	if req.AutoConvert {
+		status = model.TaskStatusQueued
 	}
 
-	// 7. 创建转换任务记录
 	task := &model.ConversionTask{
 		ID:           uuid.New().String(),
-		UserID:       "5ba6d3f8-4478-11f0-8574-74df036e1f50", // 使用默认用户ID
+		BatchID:      batchID,
 		Type:         model.TaskTypeFileUpload,
-		Status:       model.TaskStatusQueued,
-		Title:        title,
-		Description:  description,
-		InputPath:    fileInfo.FilePath,
+		Status:       status,
+		Title:        req.Title,
+		Description:  req.Description,
+		InputPath:    inputPath,
+		InputHash:    fileInfo.SHA256Hash,
 		OriginalName: fileInfo.OriginalName,
 		FileSize:     fileInfo.Size,
 		Progress:     0,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	req.ConversionParams.apply(task)
 
-	// 8. 保存到数据库
-	if err := h.db.Create(task).Error; err != nil {
-		// 如果数据库保存失败，删除已上传的文件
-		h.fileManager.DeleteFile(fileInfo.FilePath)
-		h.InternalError(c, fmt.Errorf("创建任务记录失败: %v", err))
-		return
+	h.assignOwner(c, task)
+	task.TraceContext = tracing.InjectString(c.Request.Context())
+
+	// 保存到数据库
+	if err := h.dbCtx(c).Create(task).Error; err != nil {
+		h.blobStore.Release(c.Request.Context(), inputPath)
+		return nil, fmt.Errorf("创建任务记录失败: %v", err)
 	}
 
-	// 9. 设置初始状态到Redis
-	ctx := context.Background()
+	// 设置初始状态到Redis
+	ctx := logger.WithTaskID(c.Request.Context(), task.ID)
+	slog.InfoContext(ctx, "文件上传成功", "file", fileInfo.OriginalName, "size", fileInfo.Size,
+		"auto_convert", req.AutoConvert)
 	h.redisManager.SetTaskStatus(ctx, task.ID, string(task.Status))
 	h.redisManager.SetTaskProgress(ctx, task.ID, task.Progress)
 
-	// 10. 构造响应
-	response := UploadResponse{
-		TaskID:       task.ID,
-		OriginalName: fileInfo.OriginalName,
-		FileSize:     fileInfo.Size,
-		Status:       string(task.Status),
-		UploadedAt:   task.CreatedAt,
-		FileInfo:     fileInfo,
+	// 交给任务处理器，队列已满时由扫描器稍后处理
+	// worker会修改任务，传入副本避免与构造响应并发读写
+	if req.AutoConvert && h.processor != nil {
+		queued := *task
+		h.processor.AddTask(context.WithoutCancel(ctx), &queued)
 	}
 
-	h.SuccessResponse(c, http.StatusCreated, "文件上传成功", response)
+	return task, nil
 }
 
 // GetUploadProgress 获取上传进度
@@ -163,28 +544,24 @@ func (h *UploadHandler) GetUploadProgress(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	// 确认任务归属
+	var task model.ConversionTask
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
+		h.NotFoundError(c, "任务不存在")
+		return
+	}
 
-	// 从Redis获取实时进度
+	ctx := c.Request.Context()
+
+	// 优先从Redis获取实时进度，没有则使用数据库中的值
 	progress, err := h.redisManager.GetTaskProgress(ctx, taskID)
 	if err != nil {
-		// 如果Redis中没有，从数据库获取
-		var task model.ConversionTask
-		if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
-			h.NotFoundError(c, "任务不存在")
-			return
-		}
 		progress = task.Progress
 	}
 
 	// 获取任务状态
 	status, err := h.redisManager.GetTaskStatus(ctx, taskID)
 	if err != nil {
-		var task model.ConversionTask
-		if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
-			h.NotFoundError(c, "任务不存在")
-			return
-		}
 		status = string(task.Status)
 	}
 
@@ -214,7 +591,7 @@ func (h *UploadHandler) ListUploads(c *gin.Context) {
 	var tasks []model.ConversionTask
 	var total int64
 
-	query := h.db.Model(&model.ConversionTask{})
+	query := h.dbCtx(c).Model(&model.ConversionTask{}).Scopes(h.ownerScope(c))
 
 	// 计算总数
 	if err := query.Count(&total).Error; err != nil {
@@ -253,7 +630,7 @@ func (h *UploadHandler) DeleteUpload(c *gin.Context) {
 
 	// 查找任务
 	var task model.ConversionTask
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.findOwnedTask(c, taskID, &task); err != nil {
 		h.NotFoundError(c, "任务不存在")
 		return
 	}
@@ -264,25 +641,24 @@ func (h *UploadHandler) DeleteUpload(c *gin.Context) {
 		return
 	}
 
-	// 删除文件
-	if task.InputPath != "" && h.fileManager.FileExists(task.InputPath) {
-		if err := h.fileManager.DeleteFile(task.InputPath); err != nil {
-			fmt.Printf("删除输入文件失败: %v\n", err)
-		}
-	}
+	ctx := logger.WithTaskID(c.Request.Context(), taskID)
 
-	if task.OutputPath != "" && h.fileManager.FileExists(task.OutputPath) {
-		if err := h.fileManager.DeleteFile(task.OutputPath); err != nil {
-			fmt.Printf("删除输出文件失败: %v\n", err)
-		}
+	// 删除文件，文件可能与其他任务共享，最后一个引用释放时才删除
+	if err := h.blobStore.Release(ctx, task.InputPath); err != nil {
+		slog.WarnContext(ctx, "删除输入文件失败", "path", task.InputPath, "error", err)
+	}
+	if err := h.blobStore.Release(ctx, task.OutputPath); err != nil {
+		slog.WarnContext(ctx, "删除输出文件失败", "path", task.OutputPath, "error", err)
 	}
 
 	// 删除Redis中的数据
-	ctx := context.Background()
 	h.redisManager.DeleteTaskData(ctx, taskID)
 
-	// 删除数据库记录
-	if err := h.db.Delete(&task).Error; err != nil {
+	// 删除数据库记录，任务的分享链接一并删除
+	if err := h.dbCtx(c).Where("task_id = ?", taskID).Delete(&model.ShareLink{}).Error; err != nil {
+		slog.WarnContext(ctx, "删除分享链接失败", "error", err)
+	}
+	if err := h.dbCtx(c).Delete(&task).Error; err != nil {
 		h.InternalError(c, fmt.Errorf("删除任务记录失败: %v", err))
 		return
 	}
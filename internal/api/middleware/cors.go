@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"video-converter/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsPolicy 解析后的跨域策略
+type corsPolicy struct {
+	pathPrefix       string
+	origins          []originPattern
+	allowAnyOrigin   bool
+	methods          map[string]bool
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// originPattern 来源匹配规则
+type originPattern struct {
+	scheme   string
+	host     string // 通配规则时为去掉"*."后的父域名
+	port     string
+	wildcard bool
+}
+
+// CORS 跨域中间件
+// 只对白名单中的来源回显 Access-Control-Allow-Origin，并设置 Vary 头避免缓存串用
+func CORS(cfg *config.CORSConfig) gin.HandlerFunc {
+	global := newCORSPolicy("", cfg.AllowedOrigins, cfg.AllowedMethods, cfg.AllowedHeaders,
+		cfg.ExposedHeaders, cfg.AllowCredentials, cfg.MaxAge)
+
+	// 路由覆盖按前缀长度倒序，优先匹配更具体的规则
+	routes := make([]*corsPolicy, 0, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		credentials := cfg.AllowCredentials
+		if route.AllowCredentials != nil {
+			credentials = *route.AllowCredentials
+		}
+		maxAge := cfg.MaxAge
+		if route.MaxAge != nil {
+			maxAge = *route.MaxAge
+		}
+		routes = append(routes, newCORSPolicy(route.PathPrefix,
+			fallback(route.AllowedOrigins, cfg.AllowedOrigins),
+			fallback(route.AllowedMethods, cfg.AllowedMethods),
+			fallback(route.AllowedHeaders, cfg.AllowedHeaders),
+			fallback(route.ExposedHeaders, cfg.ExposedHeaders),
+			credentials, maxAge))
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].pathPrefix) > len(routes[j].pathPrefix)
+	})
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		policy := global
+		for _, route := range routes {
+			if strings.HasPrefix(c.Request.URL.Path, route.pathPrefix) {
+				policy = route
+				break
+			}
+		}
+
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// 响应内容随Origin变化，必须告知缓存
+		c.Writer.Header().Add("Vary", "Origin")
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		// 同源请求或非浏览器请求
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		if !policy.originAllowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// 不设置CORS头，由浏览器拦截跨域读取
+			c.Next()
+			return
+		}
+
+		if policy.allowAnyOrigin && !policy.allowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if policy.allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		// 处理OPTIONS预检请求
+		if preflight {
+			if !policy.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Header("Access-Control-Allow-Methods", policy.allowMethods)
+			c.Header("Access-Control-Allow-Headers", policy.allowHeaders)
+			if policy.maxAge != "" {
+				c.Header("Access-Control-Max-Age", policy.maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if policy.exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", policy.exposeHeaders)
+		}
+
+		c.Next()
+	})
+}
+
+// newCORSPolicy 解析跨域策略
+func newCORSPolicy(pathPrefix string, origins, methods, headers, exposed []string, credentials bool, maxAge int) *corsPolicy {
+	policy := &corsPolicy{
+		pathPrefix:       pathPrefix,
+		methods:          make(map[string]bool, len(methods)),
+		allowHeaders:     strings.Join(headers, ", "),
+		exposeHeaders:    strings.Join(exposed, ", "),
+		allowCredentials: credentials,
+	}
+
+	for _, origin := range origins {
+		if origin == "*" {
+			policy.allowAnyOrigin = true
+			continue
+		}
+		if pattern, ok := parseOriginPattern(origin); ok {
+			policy.origins = append(policy.origins, pattern)
+		}
+	}
+
+	upperMethods := make([]string, 0, len(methods))
+	for _, method := range methods {
+		method = strings.ToUpper(method)
+		policy.methods[method] = true
+		upperMethods = append(upperMethods, method)
+	}
+	policy.allowMethods = strings.Join(upperMethods, ", ")
+
+	if maxAge > 0 {
+		policy.maxAge = strconv.Itoa(maxAge)
+	}
+
+	return policy
+}
+
+// originAllowed 检查来源是否在白名单中
+func (p *corsPolicy) originAllowed(origin string) bool {
+	if p.allowAnyOrigin {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+
+	for _, pattern := range p.origins {
+		if pattern.scheme != scheme || pattern.port != port {
+			continue
+		}
+		if pattern.wildcard {
+			// 只匹配子域名，不匹配父域名本身
+			if strings.HasSuffix(host, "."+pattern.host) {
+				return true
+			}
+			continue
+		}
+		if pattern.host == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseOriginPattern 解析来源规则，支持 https://*.example.com 形式的子域名通配
+func parseOriginPattern(origin string) (originPattern, bool) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(strings.TrimSuffix(origin, "/")), "://")
+	if !ok || scheme == "" || rest == "" {
+		return originPattern{}, false
+	}
+
+	pattern := originPattern{scheme: scheme}
+	if strings.HasPrefix(rest, "*.") {
+		pattern.wildcard = true
+		rest = strings.TrimPrefix(rest, "*.")
+	}
+
+	u, err := url.Parse(scheme + "://" + rest)
+	if err != nil || u.Hostname() == "" {
+		return originPattern{}, false
+	}
+	pattern.host = u.Hostname()
+	pattern.port = u.Port()
+
+	return pattern, true
+}
+
+// fallback 路由未配置时使用全局配置
+func fallback(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
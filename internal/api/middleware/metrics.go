@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"time"
+
+	"video-converter/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics HTTP请求指标中间件
+// 按路由模板而非原始路径统计，避免任务ID等参数导致标签基数爆炸
+func Metrics() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		metrics.ObserveHTTPRequest(c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+	})
+}
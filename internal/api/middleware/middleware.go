@@ -1,38 +1,26 @@
 package middleware
 
 import (
-	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
-	"strconv"
+	"runtime/debug"
+	"strings"
 	"time"
 
+	"video-converter/internal/auth"
+	"video-converter/internal/config"
+	"video-converter/internal/logger"
+	"video-converter/internal/model"
+	"video-converter/internal/storage"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-// CORS 跨域中间件
-func CORS() gin.HandlerFunc {
-	return gin.HandlerFunc(func(c *gin.Context) {
-		method := c.Request.Method
-
-		// 设置CORS头
-		c.Header("Access-Control-Allow-Origin", "*") // 生产环境应该设置具体域名
-		c.Header("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin,Content-Type,Content-Length,Accept-Encoding,X-CSRF-Token,Authorization")
-		c.Header("Access-Control-Expose-Headers", "Content-Length,Access-Control-Allow-Origin,Access-Control-Allow-Headers,Content-Type")
-		c.Header("Access-Control-Allow-Credentials", "true")
-
-		// 处理OPTIONS预检请求
-		if method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-
-		c.Next()
-	})
-}
-
 // Security 安全头中间件
 func Security() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -47,118 +35,217 @@ func Security() gin.HandlerFunc {
 	})
 }
 
-// RateLimit 速率限制中间件
-func RateLimit(redisClient *redis.Client) gin.HandlerFunc {
+// RequestID 请求ID中间件
+func RequestID() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// 生成或获取请求ID，过长的外部ID不予采用
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = generateRequestID()
+		}
+
+		// 设置到context和响应头
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	})
+}
+
+// Logger 结构化访问日志中间件
+func Logger() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// 获取客户端IP
-		clientIP := c.ClientIP()
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
 
-		// 构造Redis键
-		key := fmt.Sprintf("rate_limit:%s", clientIP)
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		// 下游中间件替换过c.Request，此时的context已带上用户ID和trace信息
+		slog.LogAttrs(c.Request.Context(), level, "HTTP请求", attrs...)
+	})
+}
 
-		ctx := context.Background()
+// Auth 认证中间件
+// 请求未携带Authorization头时按匿名访问放行；携带了token则必须有效
+func Auth(db *gorm.DB, redisClient *redis.Client) gin.HandlerFunc {
+	redisManager := storage.NewRedisManager(redisClient)
 
-		// 检查当前请求数
-		current, err := redisClient.Get(ctx, key).Int()
-		if err != nil && err != redis.Nil {
-			// Redis错误，允许请求通过
+	return gin.HandlerFunc(func(c *gin.Context) {
+		// 获取Authorization头
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
 			c.Next()
 			return
 		}
 
-		// 速率限制配置：每分钟100个请求
-		limit := 100
-		window := time.Minute
+		token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		if token == "" || token == authHeader {
+			abortUnauthorized(c, "认证信息格式错误")
+			return
+		}
 
-		if current >= limit {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"success": false,
-				"message": "请求过于频繁，请稍后再试",
-				"error":   "Rate limit exceeded",
-			})
-			c.Abort()
+		// 从Redis查找会话
+		userID, err := redisManager.GetSession(c.Request.Context(), token)
+		if err != nil {
+			abortUnauthorized(c, "登录已失效，请重新登录")
 			return
 		}
 
-		// 增加计数
-		pipe := redisClient.TxPipeline()
-		pipe.Incr(ctx, key)
-		pipe.Expire(ctx, key, window)
-		_, err = pipe.Exec(ctx)
+		var user model.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			abortUnauthorized(c, "用户不存在")
+			return
+		}
 
-		if err != nil {
-			// Redis错误，记录日志但允许请求通过
-			fmt.Printf("Rate limit Redis error: %v\n", err)
+		// 被停用的账号立即失去访问权限
+		if !user.IsActive {
+			redisManager.DeleteSession(c.Request.Context(), token)
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "账号已被停用",
+				"error":   "Account suspended",
+			})
+			c.Abort()
+			return
 		}
 
-		// 设置响应头显示限制信息
-		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
-		c.Header("X-RateLimit-Remaining", strconv.Itoa(limit-current-1))
+		c.Set("session_token", token)
+		c.Set("user_id", user.ID)
+		c.Set("user_role", string(user.Role))
+		c.Set("user", &user)
+		c.Request = c.Request.WithContext(logger.WithUserID(c.Request.Context(), user.ID))
 
 		c.Next()
 	})
 }
 
-// RequestID 请求ID中间件
-func RequestID() gin.HandlerFunc {
+// AnonymousSession 匿名访客会话中间件
+// 未登录的访客会获得一个签名Cookie，用于标识其创建的任务；
+// 不便使用Cookie的客户端可通过 X-Anonymous-Token 头传递同一令牌
+func AnonymousSession(cfg *config.AnonConfig) gin.HandlerFunc {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		// 未配置密钥时使用进程级随机密钥，重启后匿名会话失效
+		slog.Warn("未配置 auth.anonymous.secret，匿名会话将在服务重启后失效")
+		random, err := auth.GenerateToken()
+		if err != nil {
+			panic(fmt.Sprintf("生成匿名会话密钥失败: %v", err))
+		}
+		secret = []byte(random)
+	}
+
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// 生成或获取请求ID
-		requestID := c.GetHeader("X-Request-ID")
-		if requestID == "" {
-			requestID = generateRequestID()
+		// 已登录用户不需要匿名会话，但仍解析令牌以便认领任务
+		token := c.GetHeader("X-Anonymous-Token")
+		if token == "" {
+			token, _ = c.Cookie(cfg.CookieName)
 		}
 
-		// 设置到context和响应头
-		c.Set("request_id", requestID)
-		c.Header("X-Request-ID", requestID)
+		anonymousID, ok := auth.VerifyAnonymousToken(secret, token)
+		if !ok {
+			if c.GetString("user_id") != "" {
+				c.Next()
+				return
+			}
+
+			anonymousID = auth.NewAnonymousID()
+			token = auth.SignAnonymousID(secret, anonymousID)
+
+			secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(cfg.CookieName, token, cfg.MaxAge, "/", "", secure, true)
+		}
+
+		c.Set("anonymous_id", anonymousID)
+		c.Header("X-Anonymous-Token", token)
 
 		c.Next()
 	})
 }
 
-// Logger 自定义日志中间件
-func Logger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("[%s] %s \"%s %s %s\" %d %s \"%s\" \"%s\" %s\n",
-			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
-			param.ClientIP,
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.Request.Referer(),
-			param.ErrorMessage,
-		)
+// RequireAuth 要求请求已登录
+func RequireAuth() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if c.GetString("user_id") == "" {
+			abortUnauthorized(c, "请先登录")
+			return
+		}
+
+		c.Next()
 	})
 }
 
-// Auth 认证中间件（简化版本）
-func Auth() gin.HandlerFunc {
+// RequireRole 要求登录用户具有指定角色
+func RequireRole(role model.UserRole) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// 获取Authorization头
-		authHeader := c.GetHeader("Authorization")
-
-		// 简单的token验证（生产环境应该使用JWT或其他安全方案）
-		if authHeader == "" {
-			// 对于演示项目，我们暂时跳过认证
-			// 在生产环境中，这里应该返回401错误
-			c.Next()
+		if c.GetString("user_id") == "" {
+			abortUnauthorized(c, "请先登录")
 			return
 		}
 
-		// TODO: 实现JWT token验证
-		// 这里可以添加JWT解析和验证逻辑
+		if c.GetString("user_role") != string(role) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "没有权限执行该操作",
+				"error":   "Forbidden",
+			})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	})
 }
 
+// abortUnauthorized 返回401并终止请求
+func abortUnauthorized(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"success": false,
+		"message": message,
+		"error":   "Unauthorized",
+	})
+	c.Abort()
+}
+
 // FileUpload 文件上传中间件
+// 限制请求体大小，声明的Content-Length已超出限制时不读取请求体直接拒绝
 func FileUpload(maxSize int64) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// 设置最大文件大小
+		if c.Request.ContentLength > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"success": false,
+				"message": "文件大小超过限制",
+				"error":   "Request entity too large",
+			})
+			c.Abort()
+			return
+		}
+
+		// 设置最大请求体大小，读取超出时返回 *http.MaxBytesError
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
 
 		c.Next()
@@ -167,16 +254,17 @@ func FileUpload(maxSize int64) gin.HandlerFunc {
 
 // generateRequestID 生成请求ID
 func generateRequestID() string {
-	// 简单的时间戳生成方案
-	// 生产环境建议使用UUID
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	return uuid.New().String()
 }
 
 // Recovery 自定义恢复中间件
 func Recovery() gin.HandlerFunc {
-	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
 		// 记录panic信息
-		fmt.Printf("Panic recovered: %v\n", recovered)
+		slog.ErrorContext(c.Request.Context(), "请求处理发生panic",
+			"panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()),
+		)
 
 		// 返回500错误
 		c.JSON(http.StatusInternalServerError, gin.H{
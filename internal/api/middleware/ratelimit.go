@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-converter/internal/config"
+	"video-converter/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// rateLimitRule 解析后的限流规则
+type rateLimitRule struct {
+	limiter   *ratelimit.Limiter
+	policies  map[string]ratelimit.Policy
+	anonymous string
+	user      string
+	users     map[string]string
+	apiKeys   []config.APIKeyRateLimit
+	routes    map[string]config.RouteRateLimit
+}
+
+// RateLimit 速率限制中间件
+// 令牌桶在Redis中原子执行，按 API Key > 登录用户 > 客户端IP 的顺序识别调用方
+func RateLimit(redisClient *redis.Client, cfg *config.RateLimitConfig) gin.HandlerFunc {
+	if !cfg.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	rule := &rateLimitRule{
+		limiter:   ratelimit.NewLimiter(redisClient, "rate_limit"),
+		policies:  make(map[string]ratelimit.Policy, len(cfg.Policies)),
+		anonymous: cfg.AnonymousPolicy,
+		user:      cfg.UserPolicy,
+		users:     make(map[string]string, len(cfg.Users)),
+		apiKeys:   cfg.APIKeys,
+		routes:    make(map[string]config.RouteRateLimit, len(cfg.Routes)),
+	}
+	for name, policy := range cfg.Policies {
+		rule.policies[name] = ratelimit.Policy{
+			Name:   name,
+			Limit:  policy.Limit,
+			Period: time.Duration(policy.Period) * time.Second,
+			Burst:  policy.Burst,
+		}
+	}
+	for _, user := range cfg.Users {
+		rule.users[user.UserID] = user.Policy
+	}
+	for _, route := range cfg.Routes {
+		rule.routes[strings.ToUpper(route.Method)+" "+route.Path] = route
+	}
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		identity, policyName := rule.identify(c)
+		cost := 1
+
+		// 路由级配置：独立的桶或更高的消耗权重
+		if route, ok := rule.routes[c.Request.Method+" "+c.FullPath()]; ok {
+			if route.Cost > 0 {
+				cost = route.Cost
+			}
+			if route.Policy != "" {
+				policyName = route.Policy
+				identity = identity + ":" + route.Path
+			}
+		}
+
+		policy := rule.policies[policyName]
+		result, err := rule.limiter.Allow(c.Request.Context(), identity, policy, cost)
+		if err != nil {
+			// Redis错误，记录日志但允许请求通过
+			slog.WarnContext(c.Request.Context(), "限流检查失败，放行请求", "error", err)
+			c.Next()
+			return
+		}
+
+		setRateLimitHeaders(c, policy, result)
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": "请求过于频繁，请稍后再试",
+				"error":   "Rate limit exceeded",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// identify 识别调用方，返回桶标识和适用的策略名
+func (r *rateLimitRule) identify(c *gin.Context) (string, string) {
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		for _, key := range r.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key.Key)) == 1 {
+				return "key:" + key.Name, key.Policy
+			}
+		}
+	}
+
+	if userID := c.GetString("user_id"); userID != "" {
+		if policy, ok := r.users[userID]; ok {
+			return "user:" + userID, policy
+		}
+		return "user:" + userID, r.user
+	}
+
+	return "ip:" + c.ClientIP(), r.anonymous
+}
+
+// setRateLimitHeaders 设置 RateLimit-* 标准响应头
+func setRateLimitHeaders(c *gin.Context, policy ratelimit.Policy, result *ratelimit.Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d;policy=%q",
+		policy.Limit, int(policy.Period.Seconds()), result.Limit, policy.Name))
+}
+
+// ceilSeconds 向上取整到秒
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -4,34 +4,62 @@ import (
 	"net/http"
 	"video-converter/internal/api/handlers"
 	"video-converter/internal/api/middleware"
+	"video-converter/internal/auth"
 	"video-converter/internal/config"
+	"video-converter/internal/model"
+	"video-converter/pkg/converter"
+	"video-converter/pkg/disk"
+	"video-converter/pkg/objectstore"
+	"video-converter/pkg/queue"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gorm.io/gorm"
 )
 
+// maxFormOverhead 上传表单中除文件外的边界、字段等数据的余量
+const maxFormOverhead = 1 << 20
+
 // SetupRoutes 设置API路由
-func SetupRoutes(cfg *config.Config, db *gorm.DB, redisClient *redis.Client) *gin.Engine {
+func SetupRoutes(cfg *config.Config, db *gorm.DB, redisClient *redis.Client, store objectstore.Store, diskGuard *disk.Guard, taskProcessor *queue.TaskProcessor, ffmpegConverter *converter.FFmpegConverter) *gin.Engine {
 	// 创建Gin引擎
 	router := gin.New()
 
 	// 添加全局中间件
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-	router.Use(middleware.CORS())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Logger())
+	router.Use(middleware.Recovery())
+	router.Use(middleware.Metrics())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.CORS(&cfg.CORS))
 	router.Use(middleware.Security())
-	router.Use(middleware.RateLimit(redisClient))
+	router.Use(middleware.Auth(db, redisClient))
 
 	// 创建handlers依赖
 	deps := &handlers.Dependencies{
-		Config: cfg,
-		DB:     db,
-		Redis:  redisClient,
+		Config:    cfg,
+		DB:        db,
+		Redis:     redisClient,
+		Storage:   store,
+		DiskGuard: diskGuard,
+		Processor: taskProcessor,
+		Converter: ffmpegConverter,
+	}
+	if cfg.Auth.OIDC.Enabled {
+		deps.OIDC = auth.NewOIDCProvider(&cfg.Auth.OIDC)
 	}
 
-	// 健康检查端点
-	router.GET("/health", handlers.HealthCheck)
+	// 健康检查端点（/health 保留为存活探针的别名）
+	healthHandler := handlers.NewHealthHandler(deps)
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/health", healthHandler.Livez)
+
+	// Prometheus指标（生产环境应在反向代理层限制访问来源）
+	if cfg.Metrics.Enabled {
+		router.GET(cfg.Metrics.Path, gin.WrapH(promhttp.Handler()))
+	}
 
 	// 静态文件服务（前端资源）
 	router.Static("/static", "./web/static")
@@ -43,15 +71,42 @@ func SetupRoutes(cfg *config.Config, db *gorm.DB, redisClient *redis.Client) *gi
 	})
 
 	// API v1 路由组
-	v1 := router.Group("/api/v1")
+	// 限流只作用于API，静态资源不计入
+	v1 := router.Group("/api/v1",
+		middleware.RateLimit(redisClient, &cfg.RateLimit),
+		middleware.AnonymousSession(&cfg.Auth.Anonymous),
+	)
 	{
+		// 账号认证
+		authGroup := v1.Group("/auth")
+		{
+			authGroup.POST("/register", handlers.NewAuthHandler(deps).Register)
+			authGroup.POST("/login", handlers.NewAuthHandler(deps).Login)
+			authGroup.POST("/logout", middleware.RequireAuth(), handlers.NewAuthHandler(deps).Logout)
+			authGroup.GET("/me", middleware.RequireAuth(), handlers.NewAuthHandler(deps).Me)
+			authGroup.POST("/claim", middleware.RequireAuth(), handlers.NewAuthHandler(deps).ClaimTasks)
+			authGroup.GET("/providers", handlers.NewAuthHandler(deps).Providers)
+			authGroup.GET("/oidc/login", handlers.NewAuthHandler(deps).OIDCLogin)
+			authGroup.GET("/oidc/callback", handlers.NewAuthHandler(deps).OIDCCallback)
+		}
+
 		// 文件上传相关
 		upload := v1.Group("/upload")
 		{
-			upload.POST("", handlers.NewUploadHandler(deps).UploadFile)
+			// 请求体上限取单个文件和批量上传总大小中较大的一个
+			upload.POST("", middleware.FileUpload(max(cfg.File.MaxFileSize, cfg.File.MaxBatchSize)+maxFormOverhead), handlers.NewUploadHandler(deps).UploadFile)
 			upload.GET("/progress/:id", handlers.NewUploadHandler(deps).GetUploadProgress)
 			upload.GET("/list", handlers.NewUploadHandler(deps).ListUploads)
 			upload.DELETE("/:id", handlers.NewUploadHandler(deps).DeleteUpload)
+
+			// tus 1.0 断点续传
+			tusHandler := handlers.NewTusHandler(deps)
+			upload.OPTIONS("/tus", tusHandler.Options)
+			upload.POST("/tus", tusHandler.Create)
+			upload.OPTIONS("/tus/:id", tusHandler.Options)
+			upload.HEAD("/tus/:id", tusHandler.Head)
+			upload.PATCH("/tus/:id", tusHandler.Patch)
+			upload.DELETE("/tus/:id", tusHandler.Delete)
 		}
 
 		// 转换相关
@@ -61,6 +116,9 @@ func SetupRoutes(cfg *config.Config, db *gorm.DB, redisClient *redis.Client) *gi
 			convert.POST("/url", handlers.NewConvertHandler(deps).ConvertURL)
 		}
 
+		// 本节点支持的输出格式
+		v1.GET("/formats", handlers.NewConvertHandler(deps).ListFormats)
+
 		// 任务管理
 		tasks := v1.Group("/tasks")
 		{
@@ -70,6 +128,23 @@ func SetupRoutes(cfg *config.Config, db *gorm.DB, redisClient *redis.Client) *gi
 			tasks.GET("/:id/status", handlers.NewTaskHandler(deps).GetTaskStatus)
 		}
 
+		// 分享链接（公开下载接口不需要登录，凭签名令牌访问）
+		if cfg.Share.Enabled {
+			shareHandler := handlers.NewShareHandler(deps)
+			tasks.POST("/:id/share", shareHandler.CreateShare)
+			tasks.GET("/:id/shares", shareHandler.ListShares)
+			tasks.DELETE("/:id/shares/:share_id", shareHandler.RevokeShare)
+			v1.GET("/share/:token", shareHandler.Download)
+			v1.HEAD("/share/:token", shareHandler.Download)
+		}
+
+		// 批量上传的任务
+		batches := v1.Group("/batches")
+		{
+			batches.GET("/:id", handlers.NewBatchHandler(deps).GetBatch)
+			batches.GET("/:id/download", handlers.NewBatchHandler(deps).DownloadBatch)
+		}
+
 		// 文件下载
 		download := v1.Group("/download")
 		{
@@ -77,6 +152,23 @@ func SetupRoutes(cfg *config.Config, db *gorm.DB, redisClient *redis.Client) *gi
 			download.HEAD("/:id", handlers.NewDownloadHandler(deps).CheckFile)
 		}
 
+		// 管理后台（需要管理员角色）
+		admin := v1.Group("/admin", middleware.RequireRole(model.UserRoleAdmin))
+		{
+			adminHandler := handlers.NewAdminHandler(deps)
+			admin.GET("/users", adminHandler.ListUsers)
+			admin.POST("/users/:id/suspend", adminHandler.SuspendUser)
+			admin.POST("/users/:id/activate", adminHandler.ActivateUser)
+			admin.GET("/tasks", adminHandler.ListTasks)
+			admin.POST("/tasks/:id/cancel", adminHandler.CancelTask)
+			admin.POST("/tasks/:id/requeue", adminHandler.RequeueTask)
+			admin.DELETE("/tasks/:id", adminHandler.DeleteTask)
+			admin.GET("/system", adminHandler.SystemStatus)
+			admin.POST("/storage/cleanup", adminHandler.CleanupStorage)
+			admin.POST("/storage/reconcile", adminHandler.ReconcileStorage)
+			admin.GET("/audit-logs", adminHandler.ListAuditLogs)
+		}
+
 		// WebSocket连接（进度推送）
 		// v1.GET("/ws/progress", handlers.NewWebSocketHandler(deps).HandleProgress)
 	}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// NewAnonymousID 生成匿名访客ID
+func NewAnonymousID() string {
+	return uuid.New().String()
+}
+
+// SignAnonymousID 生成带签名的匿名会话令牌，格式为 <id>.<signature>
+func SignAnonymousID(secret []byte, id string) string {
+	return id + "." + anonymousSignature(secret, id)
+}
+
+// VerifyAnonymousToken 校验匿名会话令牌，返回其中的访客ID
+func VerifyAnonymousToken(secret []byte, token string) (string, bool) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "", false
+	}
+
+	expected := anonymousSignature(secret, id)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", false
+	}
+
+	return id, true
+}
+
+// anonymousSignature 计算访客ID的HMAC签名
+func anonymousSignature(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("anonymous:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// HashPassword 生成密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("生成密码哈希失败: %v", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验密码是否与哈希匹配
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// GenerateToken 生成随机会话token
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成token失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SessionTTL 获取会话有效期
+func SessionTTL(cfg *config.AuthConfig) time.Duration {
+	if cfg.SessionTTL <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(cfg.SessionTTL) * time.Second
+}
+
+// EnsureAdmin 确保配置中的初始管理员账号存在
+func EnsureAdmin(db *gorm.DB, cfg *config.AdminConfig) error {
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil
+	}
+
+	var user model.User
+	err := db.Where("username = ?", cfg.Username).First(&user).Error
+	if err == nil {
+		// 账号已存在，只保证其为管理员角色
+		if user.Role != model.UserRoleAdmin {
+			return db.Model(&user).Update("role", model.UserRoleAdmin).Error
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("查询管理员账号失败: %v", err)
+	}
+
+	hash, err := HashPassword(cfg.Password)
+	if err != nil {
+		return err
+	}
+
+	email := cfg.Email
+	if email == "" {
+		email = cfg.Username + "@localhost"
+	}
+
+	admin := &model.User{
+		ID:           uuid.New().String(),
+		Username:     cfg.Username,
+		Email:        email,
+		Password:     hash,
+		IsActive:     true,
+		Role:         model.UserRoleAdmin,
+		AuthProvider: model.AuthProviderLocal,
+	}
+	if err := db.Create(admin).Error; err != nil {
+		return fmt.Errorf("创建管理员账号失败: %v", err)
+	}
+
+	slog.Info("已创建初始管理员账号", "username", cfg.Username)
+	return nil
+}
@@ -0,0 +1,334 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOIDCGroupNotAllowed 用户不在允许登录的用户组中
+	ErrOIDCGroupNotAllowed = errors.New("当前账号所在用户组不允许登录")
+	// ErrOIDCEmailTaken 邮箱已被本地账号使用且未开启自动关联
+	ErrOIDCEmailTaken = errors.New("该邮箱已注册本地账号，请使用账号密码登录")
+)
+
+// OIDCIdentity 从ID Token中解析出的用户身份
+type OIDCIdentity struct {
+	Subject           string   `json:"sub"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Picture           string   `json:"picture"`
+	Groups            []string `json:"-"`
+}
+
+// OIDCProvider OpenID Connect身份提供方客户端
+// 首次使用时才执行discovery，IdP暂时不可用不会影响服务启动
+type OIDCProvider struct {
+	cfg *config.OIDCConfig
+
+	mu           sync.Mutex
+	verifier     *oidc.IDTokenVerifier
+	oauth2Config *oauth2.Config
+}
+
+// NewOIDCProvider 创建OIDC客户端
+func NewOIDCProvider(cfg *config.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{cfg: cfg}
+}
+
+// Name 身份来源标识
+func (p *OIDCProvider) Name() string {
+	return p.cfg.ProviderName
+}
+
+// DisplayName 登录按钮显示名称
+func (p *OIDCProvider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+// PostLoginRedirect 登录成功后的默认跳转地址
+func (p *OIDCProvider) PostLoginRedirect() string {
+	return p.cfg.PostLoginRedirect
+}
+
+// discover 获取IdP元数据并初始化客户端
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2Config != nil {
+		return p.oauth2Config, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OIDC discovery失败: %v", err)
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	p.oauth2Config = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+
+	return p.oauth2Config, p.verifier, nil
+}
+
+// AuthCodeURL 生成授权地址（携带state、nonce和PKCE challenge）
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	oauth2Config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauth2Config.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(codeVerifier),
+	), nil
+}
+
+// Exchange 用授权码换取并校验ID Token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	oauth2Config, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("授权码换取token失败: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("IdP响应中缺少id_token")
+	}
+
+	// 校验签名、issuer、audience和有效期
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("ID Token校验失败: %v", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.New("ID Token nonce不匹配")
+	}
+
+	var identity OIDCIdentity
+	if err := idToken.Claims(&identity); err != nil {
+		return nil, fmt.Errorf("解析ID Token声明失败: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("解析ID Token声明失败: %v", err)
+	}
+	identity.Groups = parseGroupsClaim(claims[p.cfg.GroupsClaim])
+
+	if identity.Subject == "" {
+		return nil, errors.New("ID Token缺少sub声明")
+	}
+
+	return &identity, nil
+}
+
+// ManagesRoles 是否由IdP用户组决定本地角色，未配置角色映射时角色只在本地管理
+func (p *OIDCProvider) ManagesRoles() bool {
+	return len(p.cfg.RoleMappings) > 0
+}
+
+// MapRole 根据用户组映射本地角色，命中多个映射时取权限最高的角色
+func (p *OIDCProvider) MapRole(groups []string) model.UserRole {
+	role := model.UserRoleUser
+	for _, mapping := range p.cfg.RoleMappings {
+		if containsString(groups, mapping.Group) && model.UserRole(mapping.Role) == model.UserRoleAdmin {
+			role = model.UserRoleAdmin
+		}
+	}
+	return role
+}
+
+// GroupAllowed 检查用户组是否允许登录
+func (p *OIDCProvider) GroupAllowed(groups []string) bool {
+	if len(p.cfg.AllowedGroups) == 0 {
+		return true
+	}
+	for _, allowed := range p.cfg.AllowedGroups {
+		if containsString(groups, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProvisionOIDCUser 按外部身份查找或即时创建本地用户，并同步角色
+// 配置了角色映射时，已关联用户的角色随用户组同步；关联已有本地账号时只提升不降低角色
+func ProvisionOIDCUser(db *gorm.DB, p *OIDCProvider, identity *OIDCIdentity) (*model.User, error) {
+	if !p.GroupAllowed(identity.Groups) {
+		return nil, ErrOIDCGroupNotAllowed
+	}
+
+	role := p.MapRole(identity.Groups)
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	var user model.User
+	err := db.Where("auth_provider = ? AND external_id = ?", p.Name(), identity.Subject).First(&user).Error
+	if err == nil {
+		// 已关联的用户：同步资料和角色
+		updates := map[string]interface{}{}
+		if p.ManagesRoles() {
+			updates["role"] = role
+		}
+		if identity.Picture != "" {
+			updates["avatar"] = identity.Picture
+		}
+		if len(updates) > 0 {
+			if err := db.Model(&user).Updates(updates).Error; err != nil {
+				return nil, fmt.Errorf("更新用户信息失败: %v", err)
+			}
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+
+	// 邮箱与本地账号相同时，只有开启自动关联且IdP确认邮箱已验证才关联到该账号，
+	// 否则IdP侧注册同邮箱的账号即可接管本地账号
+	if email != "" {
+		err := db.Where("email = ? AND auth_provider = ?", email, model.AuthProviderLocal).First(&user).Error
+		if err == nil {
+			if !p.cfg.LinkVerifiedEmail || !identity.EmailVerified {
+				return nil, ErrOIDCEmailTaken
+			}
+			updates := map[string]interface{}{
+				"auth_provider": p.Name(),
+				"external_id":   identity.Subject,
+			}
+			if p.ManagesRoles() && role == model.UserRoleAdmin {
+				updates["role"] = role
+			}
+			if err := db.Model(&user).Updates(updates).Error; err != nil {
+				return nil, fmt.Errorf("关联本地账号失败: %v", err)
+			}
+			return &user, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("查询用户失败: %v", err)
+		}
+	}
+
+	// 即时创建用户
+	username, err := uniqueUsername(db, identity)
+	if err != nil {
+		return nil, err
+	}
+	if email == "" {
+		// email列有唯一索引，没有邮箱时使用不可投递的占位地址
+		email = externalIDHash(p.Name(), identity.Subject) + "@oidc.invalid"
+	}
+
+	user = model.User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		Email:        email,
+		Avatar:       identity.Picture,
+		IsActive:     true,
+		Role:         role,
+		AuthProvider: p.Name(),
+		ExternalID:   identity.Subject,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("创建用户失败: %v", err)
+	}
+
+	return &user, nil
+}
+
+// uniqueUsername 为外部用户生成不冲突的用户名
+func uniqueUsername(db *gorm.DB, identity *OIDCIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" && identity.Email != "" {
+		base = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for i := 1; i <= 20; i++ {
+		var count int64
+		if err := db.Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("查询用户名失败: %v", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	return fmt.Sprintf("%s_%s", base, uuid.New().String()[:8]), nil
+}
+
+// parseGroupsClaim 解析用户组声明（兼容数组和单个字符串）
+func parseGroupsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case []interface{}:
+		groups := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	case string:
+		if v == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	default:
+		return nil
+	}
+}
+
+// externalIDHash 外部身份的短哈希
+func externalIDHash(provider, subject string) string {
+	sum := sha256.Sum256([]byte(provider + ":" + subject))
+	return hex.EncodeToString(sum[:8])
+}
+
+// containsString 检查切片中是否包含指定字符串
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
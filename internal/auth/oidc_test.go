@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.User{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestProvisionOIDCUserLinking(t *testing.T) {
+	adminMapping := []config.OIDCRoleMapping{{Group: "video-admins", Role: "admin"}}
+
+	tests := []struct {
+		name          string
+		link          bool
+		mappings      []config.OIDCRoleMapping
+		emailVerified bool
+		groups        []string
+		localRole     model.UserRole
+		wantErr       error
+		wantRole      model.UserRole
+	}{
+		{
+			name:          "未开启关联时拒绝接管本地账号",
+			emailVerified: true,
+			localRole:     model.UserRoleAdmin,
+			wantErr:       ErrOIDCEmailTaken,
+		},
+		{
+			name:      "邮箱未验证时不关联",
+			link:      true,
+			localRole: model.UserRoleUser,
+			wantErr:   ErrOIDCEmailTaken,
+		},
+		{
+			name:          "关联时不降低管理员角色",
+			link:          true,
+			mappings:      adminMapping,
+			emailVerified: true,
+			localRole:     model.UserRoleAdmin,
+			wantRole:      model.UserRoleAdmin,
+		},
+		{
+			name:          "关联时按映射提升角色",
+			link:          true,
+			mappings:      adminMapping,
+			emailVerified: true,
+			groups:        []string{"video-admins"},
+			localRole:     model.UserRoleUser,
+			wantRole:      model.UserRoleAdmin,
+		},
+		{
+			name:          "未配置映射时关联不修改角色",
+			link:          true,
+			emailVerified: true,
+			groups:        []string{"video-admins"},
+			localRole:     model.UserRoleUser,
+			wantRole:      model.UserRoleUser,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			local := model.User{
+				ID:           "local-user",
+				Username:     "alice",
+				Email:        "alice@example.com",
+				IsActive:     true,
+				Role:         tt.localRole,
+				AuthProvider: model.AuthProviderLocal,
+			}
+			if err := db.Create(&local).Error; err != nil {
+				t.Fatalf("创建本地用户失败: %v", err)
+			}
+
+			provider := NewOIDCProvider(&config.OIDCConfig{
+				ProviderName:      "mock",
+				RoleMappings:      tt.mappings,
+				LinkVerifiedEmail: tt.link,
+			})
+			user, err := ProvisionOIDCUser(db, provider, &OIDCIdentity{
+				Subject:       "subject-1",
+				Email:         "Alice@Example.com",
+				EmailVerified: tt.emailVerified,
+				Groups:        tt.groups,
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("错误 = %v，应为 %v", err, tt.wantErr)
+				}
+				var stored model.User
+				db.First(&stored, "id = ?", local.ID)
+				if stored.AuthProvider != model.AuthProviderLocal || stored.Role != tt.localRole {
+					t.Errorf("本地账号被修改: provider=%s role=%s", stored.AuthProvider, stored.Role)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProvisionOIDCUser 失败: %v", err)
+			}
+			if user.ID != local.ID {
+				t.Fatalf("应关联到本地账号 %s，实际为 %s", local.ID, user.ID)
+			}
+
+			var stored model.User
+			db.First(&stored, "id = ?", local.ID)
+			if stored.AuthProvider != "mock" || stored.ExternalID != "subject-1" {
+				t.Errorf("关联后 provider=%s external_id=%s", stored.AuthProvider, stored.ExternalID)
+			}
+			if stored.Role != tt.wantRole {
+				t.Errorf("关联后角色 = %s，应为 %s", stored.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestProvisionOIDCUserRoleSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []config.OIDCRoleMapping
+		groups   []string
+		wantRole model.UserRole
+	}{
+		{
+			name:     "未配置映射时保留本地修改的角色",
+			wantRole: model.UserRoleAdmin,
+		},
+		{
+			name:     "配置映射时按用户组同步角色",
+			mappings: []config.OIDCRoleMapping{{Group: "video-admins", Role: "admin"}},
+			wantRole: model.UserRoleUser,
+		},
+		{
+			name:     "命中映射的用户组保持管理员",
+			mappings: []config.OIDCRoleMapping{{Group: "video-admins", Role: "admin"}},
+			groups:   []string{"video-admins"},
+			wantRole: model.UserRoleAdmin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			provider := NewOIDCProvider(&config.OIDCConfig{ProviderName: "mock", RoleMappings: tt.mappings})
+			identity := &OIDCIdentity{Subject: "subject-1", Email: "bob@example.com", Groups: tt.groups}
+
+			user, err := ProvisionOIDCUser(db, provider, identity)
+			if err != nil {
+				t.Fatalf("首次登录失败: %v", err)
+			}
+			// 管理员在后台提升了该用户的角色
+			if err := db.Model(user).Update("role", model.UserRoleAdmin).Error; err != nil {
+				t.Fatalf("修改角色失败: %v", err)
+			}
+
+			if _, err := ProvisionOIDCUser(db, provider, identity); err != nil {
+				t.Fatalf("再次登录失败: %v", err)
+			}
+			var stored model.User
+			db.First(&stored, "id = ?", user.ID)
+			if stored.Role != tt.wantRole {
+				t.Errorf("再次登录后角色 = %s，应为 %s", stored.Role, tt.wantRole)
+			}
+		})
+	}
+}
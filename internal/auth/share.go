@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SignShareToken 生成分享链接令牌，格式为 <id>.<过期时间戳>.<signature>
+// 过期时间包含在签名中，校验时无需查库即可拒绝过期或伪造的链接
+func SignShareToken(secret []byte, id string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return id + "." + expires + "." + shareSignature(secret, id, expires)
+}
+
+// VerifyShareToken 校验分享链接令牌，返回其中的分享ID和过期时间
+// 签名有效但已过期时 ok 为true，由调用方区分过期和无效
+func VerifyShareToken(secret []byte, token string) (id string, expiresAt time.Time, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, false
+	}
+	id, expires, signature := parts[0], parts[1], parts[2]
+	if _, err := uuid.Parse(id); err != nil {
+		return "", time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	expected := shareSignature(secret, id, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", time.Time{}, false
+	}
+
+	return id, time.Unix(unix, 0), true
+}
+
+// SignShareGrant 生成分享链接的下载凭证，格式为 <过期时间戳>.<signature>
+// 凭证由计数的下载请求发给客户端，有效期内同一链接的断点续传不再计数
+func SignShareGrant(secret []byte, id string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + shareSignature(secret, "grant:"+id, expires)
+}
+
+// VerifyShareGrant 校验下载凭证是否由该分享链接发放且在 now 时仍有效
+func VerifyShareGrant(secret []byte, id, grant string, now time.Time) bool {
+	expires, signature, ok := strings.Cut(grant, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) {
+		return false
+	}
+	expected := shareSignature(secret, "grant:"+id, expires)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// shareSignature 计算分享链接的HMAC签名
+func shareSignature(secret []byte, id, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("share:" + id + ":" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareToken(t *testing.T) {
+	secret := []byte("test-secret")
+	id := "11111111-1111-1111-1111-111111111111"
+	expiresAt := time.Unix(1893456000, 0)
+	token := SignShareToken(secret, id, expiresAt)
+	parts := strings.Split(token, ".")
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		wantOK bool
+	}{
+		{name: "有效", secret: secret, token: token, wantOK: true},
+		{name: "签名被修改", secret: secret, token: token[:len(token)-1] + "A"},
+		{name: "密钥不同", secret: []byte("other-secret"), token: token},
+		{name: "过期时间被修改", secret: secret, token: id + ".1893456001." + parts[2]},
+		{name: "ID被修改", secret: secret, token: "22222222-2222-2222-2222-222222222222." + parts[1] + "." + parts[2]},
+		{name: "ID不是UUID", secret: secret, token: "not-a-uuid." + parts[1] + "." + parts[2]},
+		{name: "过期时间不是数字", secret: secret, token: id + ".soon." + parts[2]},
+		{name: "缺少签名", secret: secret, token: id + "." + parts[1]},
+		{name: "多余的段", secret: secret, token: token + ".extra"},
+		{name: "空令牌", secret: secret, token: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, gotExpires, ok := VerifyShareToken(tt.secret, tt.token)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v，应为 %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if gotID != "" || !gotExpires.IsZero() {
+					t.Errorf("无效令牌返回了 id=%q expires=%v", gotID, gotExpires)
+				}
+				return
+			}
+			if gotID != id || !gotExpires.Equal(expiresAt) {
+				t.Errorf("返回 id=%q expires=%v，应为 id=%q expires=%v", gotID, gotExpires, id, expiresAt)
+			}
+		})
+	}
+}
+
+func TestShareTokenExpiredStillVerifies(t *testing.T) {
+	secret := []byte("test-secret")
+	expiresAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	token := SignShareToken(secret, "11111111-1111-1111-1111-111111111111", expiresAt)
+
+	// 过期由调用方判断，签名有效时返回过期时间
+	_, gotExpires, ok := VerifyShareToken(secret, token)
+	if !ok || !gotExpires.Equal(expiresAt) {
+		t.Errorf("ok=%v expires=%v，应为 true %v", ok, gotExpires, expiresAt)
+	}
+}
+
+func TestShareGrant(t *testing.T) {
+	secret := []byte("test-secret")
+	id := "11111111-1111-1111-1111-111111111111"
+	now := time.Unix(1893456000, 0)
+	grant := SignShareGrant(secret, id, now.Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		secret []byte
+		id     string
+		grant  string
+		now    time.Time
+		want   bool
+	}{
+		{name: "有效", secret: secret, id: id, grant: grant, now: now, want: true},
+		{name: "已过期", secret: secret, id: id, grant: grant, now: now.Add(time.Hour)},
+		{name: "其他链接", secret: secret, id: "22222222-2222-2222-2222-222222222222", grant: grant, now: now},
+		{name: "密钥不同", secret: []byte("other-secret"), id: id, grant: grant, now: now},
+		{name: "延长过期时间", secret: secret, id: id, grant: "1893463200" + grant[strings.Index(grant, "."):], now: now},
+		{name: "签名被修改", secret: secret, id: id, grant: grant + "x", now: now},
+		{name: "分享令牌不能作为凭证", secret: secret, id: id, grant: SignShareToken(secret, id, now.Add(time.Hour)), now: now},
+		{name: "格式错误", secret: secret, id: id, grant: "grant", now: now},
+		{name: "空", secret: secret, id: id, now: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyShareGrant(tt.secret, tt.id, tt.grant, tt.now); got != tt.want {
+				t.Errorf("VerifyShareGrant = %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
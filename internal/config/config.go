@@ -4,18 +4,105 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	File     FileConfig     `mapstructure:"file"`
-	FFmpeg   FFmpegConfig   `mapstructure:"ffmpeg"`
-	Download DownloadConfig `mapstructure:"download"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	File      FileConfig      `mapstructure:"file"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	FFmpeg    FFmpegConfig    `mapstructure:"ffmpeg"`
+	Download  DownloadConfig  `mapstructure:"download"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	CORS      CORSConfig      `mapstructure:"cors"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
+	Tracing   TracingConfig   `mapstructure:"tracing"`
+	Log       LogConfig       `mapstructure:"log"`
+	Health    HealthConfig    `mapstructure:"health"`
+	DiskGuard DiskGuardConfig `mapstructure:"disk_guard"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	Reconcile ReconcileConfig `mapstructure:"reconcile"`
+	Share     ShareConfig     `mapstructure:"share"`
+}
+
+// RetentionConfig 文件保留策略，各项为0表示永久保留
+// 过期的任务状态变为 expired，文件引用释放后由去重的引用计数决定是否删除
+type RetentionConfig struct {
+	Enabled              bool `mapstructure:"enabled"`
+	Interval             int  `mapstructure:"interval"`               // 检查间隔（秒）
+	BatchSize            int  `mapstructure:"batch_size"`             // 每轮每类最多处理的任务数
+	ConvertedInputHours  int  `mapstructure:"converted_input_hours"`  // 转换完成后保留上传文件的时长（小时），任务不过期
+	OutputDays           int  `mapstructure:"output_days"`            // 转换完成后保留输出文件的天数，之后任务过期
+	FailedInputDays      int  `mapstructure:"failed_input_days"`      // 失败或取消的任务保留输入文件的天数，之后任务过期
+	UnconvertedInputDays int  `mapstructure:"unconverted_input_days"` // 上传后一直未提交转换的任务保留天数，之后任务过期
+}
+
+// ReconcileConfig 存储与数据库对账配置
+type ReconcileConfig struct {
+	QuarantineDir string `mapstructure:"quarantine_dir"` // 孤立文件的隔离目录（存储中的键前缀）
+	MinAgeHours   int    `mapstructure:"min_age_hours"`  // 只处理修改时间超过该时长的文件，避免误判正在写入的文件
+}
+
+// ShareConfig 转换结果分享链接配置
+type ShareConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Secret     string `mapstructure:"secret"`      // 链接签名密钥，为空时使用进程级随机密钥，重启后已发出的链接失效
+	BaseURL    string `mapstructure:"base_url"`    // 生成链接使用的外部地址，为空时按请求的Host生成
+	DefaultTTL int    `mapstructure:"default_ttl"` // 未指定有效期时的默认有效期（秒）
+	MaxTTL     int    `mapstructure:"max_ttl"`     // 有效期上限（秒）
+}
+
+// DiskGuardConfig 磁盘空间准入控制配置
+// 任一目录低于低水位时拒绝新的上传和URL任务，低于临界水位时worker暂停领取任务
+type DiskGuardConfig struct {
+	Enabled    bool                     `mapstructure:"enabled"`
+	Interval   int                      `mapstructure:"interval"`   // 检查间隔（秒）
+	Watermarks map[string]DiskWatermark `mapstructure:"watermarks"` // 目录名（upload、output、temp）-> 水位
+}
+
+// DiskWatermark 目录的剩余空间水位（MB）
+type DiskWatermark struct {
+	LowMB      int64 `mapstructure:"low_mb"`
+	CriticalMB int64 `mapstructure:"critical_mb"`
+}
+
+// HealthConfig 健康检查配置
+type HealthConfig struct {
+	Timeout              int   `mapstructure:"timeout"`                // 单项检查超时（秒）
+	MinFreeSpaceMB       int64 `mapstructure:"min_free_space_mb"`      // 上传、输出、临时目录的最低剩余空间
+	CheckDownloadService bool  `mapstructure:"check_download_service"` // 是否检查下载服务可达（非关键组件）
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level      string `mapstructure:"level"`       // debug, info, warn, error
+	FilePath   string `mapstructure:"file_path"`   // 为空时只输出到标准输出
+	MaxSize    int    `mapstructure:"max_size"`    // 单个日志文件最大MB数
+	MaxBackups int    `mapstructure:"max_backups"` // 保留的旧日志文件数
+	MaxAge     int    `mapstructure:"max_age"`     // 旧日志文件保留天数
+	Compress   bool   `mapstructure:"compress"`    // 是否压缩旧日志文件
+}
+
+// MetricsConfig Prometheus指标配置
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+}
+
+// TracingConfig 链路追踪配置
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	ServiceName string  `mapstructure:"service_name"`
+	Endpoint    string  `mapstructure:"endpoint"` // OTLP/HTTP 采集端地址，如 localhost:4318
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"` // 根span采样比例，0-1
 }
 
 // ServerConfig 服务器配置
@@ -47,16 +134,46 @@ type RedisConfig struct {
 
 // FileConfig 文件配置
 type FileConfig struct {
-	UploadDir    string   `mapstructure:"upload_dir"`
-	OutputDir    string   `mapstructure:"output_dir"`
-	TempDir      string   `mapstructure:"temp_dir"`
-	MaxFileSize  int64    `mapstructure:"max_file_size"` // bytes
-	AllowedTypes []string `mapstructure:"allowed_types"`
+	UploadDir      string   `mapstructure:"upload_dir"`
+	OutputDir      string   `mapstructure:"output_dir"`
+	TempDir        string   `mapstructure:"temp_dir"`
+	MaxFileSize    int64    `mapstructure:"max_file_size"` // bytes
+	AllowedTypes   []string `mapstructure:"allowed_types"`
+	TusExpiration  int      `mapstructure:"tus_expiration"`  // 断点续传未完成上传的保留时间（小时）
+	DeepValidation bool     `mapstructure:"deep_validation"` // 接受任务前用ffprobe完整解析上传文件
+	MaxBatchFiles  int      `mapstructure:"max_batch_files"` // 一次上传（多文件或压缩包）最多包含的文件数
+	MaxBatchSize   int64    `mapstructure:"max_batch_size"`  // 一次上传的文件总大小上限（压缩包按解压后计算），bytes
+	// 下载文件名模板，可用 {title} {original_name} {date} {bitrate} {id}，扩展名按输出格式自动添加
+	DownloadNameTemplate string `mapstructure:"download_name_template"`
+	DownloadNamePinyin   bool   `mapstructure:"download_name_pinyin"` // 兼容文件名（不支持 filename* 的客户端使用）中的汉字转写为拼音
+}
+
+// StorageConfig 上传文件和转换输出的存储配置
+// 使用S3存储时上传目录和输出目录只用于暂存，对象键与本地存储的文件路径相同
+type StorageConfig struct {
+	Backend          string   `mapstructure:"backend"`           // local 或 s3
+	PresignDownloads bool     `mapstructure:"presign_downloads"` // S3存储时下载重定向到预签名URL，否则由服务端转发
+	PresignExpiry    int      `mapstructure:"presign_expiry"`    // 预签名URL有效期（秒）
+	S3               S3Config `mapstructure:"s3"`
+}
+
+// S3Config S3兼容对象存储配置（AWS S3、MinIO等）
+type S3Config struct {
+	Endpoint     string `mapstructure:"endpoint"` // 如 s3.amazonaws.com、localhost:9000
+	Region       string `mapstructure:"region"`
+	Bucket       string `mapstructure:"bucket"`
+	AccessKey    string `mapstructure:"access_key"`
+	SecretKey    string `mapstructure:"secret_key"`
+	UseSSL       bool   `mapstructure:"use_ssl"`
+	PathStyle    bool   `mapstructure:"path_style"`    // 使用路径风格的URL，MinIO需要开启
+	Prefix       string `mapstructure:"prefix"`        // 对象键前缀，多个部署共用一个bucket时区分
+	CreateBucket bool   `mapstructure:"create_bucket"` // 启动时bucket不存在则创建
 }
 
 // FFmpegConfig FFmpeg配置
 type FFmpegConfig struct {
 	BinaryPath   string `mapstructure:"binary_path"`
+	ProbePath    string `mapstructure:"ffprobe_path"`
 	AudioCodec   string `mapstructure:"audio_codec"`
 	AudioBitrate string `mapstructure:"audio_bitrate"`
 	SampleRate   string `mapstructure:"sample_rate"`
@@ -70,6 +187,113 @@ type DownloadConfig struct {
 	DisableWatermark bool   `mapstructure:"disable_watermark"`
 }
 
+// AuthConfig 认证配置
+type AuthConfig struct {
+	SessionTTL int         `mapstructure:"session_ttl"` // 会话有效期（秒）
+	Admin      AdminConfig `mapstructure:"admin"`
+	OIDC       OIDCConfig  `mapstructure:"oidc"`
+	Anonymous  AnonConfig  `mapstructure:"anonymous"`
+}
+
+// AnonConfig 匿名访客会话配置
+type AnonConfig struct {
+	Secret     string `mapstructure:"secret"`      // Cookie签名密钥，多实例部署时必须一致
+	CookieName string `mapstructure:"cookie_name"` // Cookie名称
+	MaxAge     int    `mapstructure:"max_age"`     // Cookie有效期（秒）
+}
+
+// AdminConfig 初始管理员账号配置（启动时不存在则自动创建）
+type AdminConfig struct {
+	Username string `mapstructure:"username"`
+	Email    string `mapstructure:"email"`
+	Password string `mapstructure:"password"`
+}
+
+// OIDCConfig OpenID Connect单点登录配置
+type OIDCConfig struct {
+	Enabled           bool              `mapstructure:"enabled"`
+	ProviderName      string            `mapstructure:"provider_name"` // 记录在用户上的身份来源标识
+	DisplayName       string            `mapstructure:"display_name"`  // 登录按钮显示名称
+	IssuerURL         string            `mapstructure:"issuer_url"`
+	ClientID          string            `mapstructure:"client_id"`
+	ClientSecret      string            `mapstructure:"client_secret"`
+	RedirectURL       string            `mapstructure:"redirect_url"` // 回调地址，需指向 /api/v1/auth/oidc/callback
+	Scopes            []string          `mapstructure:"scopes"`
+	GroupsClaim       string            `mapstructure:"groups_claim"`
+	AllowedGroups     []string          `mapstructure:"allowed_groups"`      // 为空时不限制
+	RoleMappings      []OIDCRoleMapping `mapstructure:"role_mappings"`       // 为空时角色只在本地管理，登录不修改角色
+	LinkVerifiedEmail bool              `mapstructure:"link_verified_email"` // 是否将IdP已验证邮箱关联到同邮箱的本地账号
+	PostLoginRedirect string            `mapstructure:"post_login_redirect"` // 登录成功后跳转的前端地址
+}
+
+// OIDCRoleMapping IdP用户组到本地角色的映射
+type OIDCRoleMapping struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
+}
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	Enabled         bool                       `mapstructure:"enabled"`
+	Policies        map[string]RateLimitPolicy `mapstructure:"policies"`         // 策略名 -> 策略
+	AnonymousPolicy string                     `mapstructure:"anonymous_policy"` // 未登录请求（按IP）使用的策略
+	UserPolicy      string                     `mapstructure:"user_policy"`      // 登录用户默认使用的策略
+	Users           []UserRateLimit            `mapstructure:"users"`            // 指定用户的策略
+	APIKeys         []APIKeyRateLimit          `mapstructure:"api_keys"`         // 通过 X-API-Key 识别的调用方策略
+	Routes          []RouteRateLimit           `mapstructure:"routes"`           // 路由的消耗权重或独立策略
+}
+
+// RateLimitPolicy 令牌桶策略：每period秒补充limit个令牌，最多积累burst个
+type RateLimitPolicy struct {
+	Limit  int `mapstructure:"limit"`
+	Period int `mapstructure:"period"` // 秒
+	Burst  int `mapstructure:"burst"`  // 为0时等于limit
+}
+
+// UserRateLimit 指定用户的限流策略
+type UserRateLimit struct {
+	UserID string `mapstructure:"user_id"`
+	Policy string `mapstructure:"policy"`
+}
+
+// APIKeyRateLimit API Key的限流策略
+type APIKeyRateLimit struct {
+	Name   string `mapstructure:"name"`
+	Key    string `mapstructure:"key"`
+	Policy string `mapstructure:"policy"`
+}
+
+// RouteRateLimit 路由限流配置
+// 只配置cost时从调用方的桶中按权重扣减；配置了policy时该路由使用独立的桶
+type RouteRateLimit struct {
+	Method string `mapstructure:"method"`
+	Path   string `mapstructure:"path"` // gin路由模板，如 /api/v1/tasks/:id
+	Cost   int    `mapstructure:"cost"`
+	Policy string `mapstructure:"policy"`
+}
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	AllowedOrigins   []string          `mapstructure:"allowed_origins"` // 精确匹配或子域名通配，如 https://*.example.com
+	AllowedMethods   []string          `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string          `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string          `mapstructure:"exposed_headers"`
+	AllowCredentials bool              `mapstructure:"allow_credentials"`
+	MaxAge           int               `mapstructure:"max_age"` // 预检结果缓存时间（秒）
+	Routes           []CORSRouteConfig `mapstructure:"routes"`  // 按路径前缀覆盖，未设置的字段继承全局配置
+}
+
+// CORSRouteConfig 路由级跨域配置
+type CORSRouteConfig struct {
+	PathPrefix       string   `mapstructure:"path_prefix"`
+	AllowedOrigins   []string `mapstructure:"allowed_origins"`
+	AllowedMethods   []string `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string `mapstructure:"exposed_headers"`
+	AllowCredentials *bool    `mapstructure:"allow_credentials"`
+	MaxAge           *int     `mapstructure:"max_age"`
+}
+
 // LoadConfig 加载配置文件
 func LoadConfig(configPath string) (*Config, error) {
 	config := &Config{}
@@ -137,12 +361,31 @@ func setDefaults() {
 	viper.SetDefault("file.temp_dir", os.TempDir())
 	viper.SetDefault("file.max_file_size", 500*1024*1024) // 500MB
 	viper.SetDefault("file.allowed_types", []string{
-		"video/mp4", "video/avi", "video/mov", "video/wmv", "video/flv",
-		"video/webm", "video/mkv", "video/m4v",
+		"video/mp4", "video/quicktime", "video/3gpp", "video/webm", "video/x-matroska",
+		"video/x-msvideo", "video/x-flv", "video/x-ms-asf", "video/mpeg", "video/mp2t",
+		"application/vnd.rn-realmedia",
+		"audio/mp4", "audio/mpeg", "audio/aac", "audio/wav", "audio/flac", "audio/ogg",
+		"audio/amr", "audio/x-caf",
 	})
+	viper.SetDefault("file.tus_expiration", 24)
+	viper.SetDefault("file.deep_validation", false)
+	viper.SetDefault("file.max_batch_files", 50)
+	viper.SetDefault("file.max_batch_size", 2*1024*1024*1024) // 2GB
+	viper.SetDefault("file.download_name_template", "{original_name}")
+	viper.SetDefault("file.download_name_pinyin", false)
+
+	// 存储默认配置
+	viper.SetDefault("storage.backend", "local")
+	viper.SetDefault("storage.presign_downloads", true)
+	viper.SetDefault("storage.presign_expiry", 300)
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.s3.use_ssl", true)
+	viper.SetDefault("storage.s3.path_style", false)
+	viper.SetDefault("storage.s3.create_bucket", false)
 
 	// FFmpeg默认配置
 	viper.SetDefault("ffmpeg.binary_path", "ffmpeg")
+	viper.SetDefault("ffmpeg.ffprobe_path", "ffprobe")
 	viper.SetDefault("ffmpeg.audio_codec", "libmp3lame")
 	viper.SetDefault("ffmpeg.audio_bitrate", "192k")
 	viper.SetDefault("ffmpeg.sample_rate", "44100")
@@ -152,6 +395,107 @@ func setDefaults() {
 	viper.SetDefault("download.timeout", 300)
 	viper.SetDefault("download.enable_prefix", true)
 	viper.SetDefault("download.disable_watermark", true)
+
+	// 限流默认配置
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.policies", map[string]interface{}{
+		"anonymous": map[string]interface{}{"limit": 120, "period": 60, "burst": 60},
+		"user":      map[string]interface{}{"limit": 300, "period": 60, "burst": 120},
+	})
+	viper.SetDefault("rate_limit.anonymous_policy", "anonymous")
+	viper.SetDefault("rate_limit.user_policy", "user")
+	viper.SetDefault("rate_limit.routes", []map[string]interface{}{
+		{"method": "POST", "path": "/api/v1/upload", "cost": 10},
+		{"method": "POST", "path": "/api/v1/upload/tus", "cost": 10},
+		{"method": "POST", "path": "/api/v1/convert/file", "cost": 5},
+		{"method": "POST", "path": "/api/v1/convert/url", "cost": 5},
+		{"method": "GET", "path": "/api/v1/batches/:id/download", "cost": 5},
+	})
+
+	// 指标默认配置
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("metrics.path", "/metrics")
+
+	// 健康检查默认配置
+	viper.SetDefault("health.timeout", 3)
+	viper.SetDefault("health.min_free_space_mb", 1024)
+	viper.SetDefault("health.check_download_service", true)
+
+	// 磁盘空间准入控制默认配置
+	viper.SetDefault("disk_guard.enabled", true)
+	viper.SetDefault("disk_guard.interval", 10)
+	viper.SetDefault("disk_guard.watermarks", map[string]interface{}{
+		"upload": map[string]interface{}{"low_mb": 2048, "critical_mb": 512},
+		"output": map[string]interface{}{"low_mb": 1024, "critical_mb": 256},
+		"temp":   map[string]interface{}{"low_mb": 2048, "critical_mb": 512},
+	})
+
+	// 文件保留策略默认配置
+	viper.SetDefault("retention.enabled", true)
+	viper.SetDefault("retention.interval", 600)
+	viper.SetDefault("retention.batch_size", 100)
+	viper.SetDefault("retention.converted_input_hours", 24)
+	viper.SetDefault("retention.output_days", 7)
+	viper.SetDefault("retention.failed_input_days", 3)
+	viper.SetDefault("retention.unconverted_input_days", 7)
+
+	// 存储对账默认配置
+	viper.SetDefault("reconcile.quarantine_dir", "./quarantine")
+	viper.SetDefault("reconcile.min_age_hours", 24)
+
+	// 分享链接默认配置
+	viper.SetDefault("share.enabled", true)
+	viper.SetDefault("share.secret", "")
+	viper.SetDefault("share.base_url", "")
+	viper.SetDefault("share.default_ttl", 24*3600) // 1天
+	viper.SetDefault("share.max_ttl", 30*24*3600)  // 30天
+
+	// 日志默认配置
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.file_path", "")
+	viper.SetDefault("log.max_size", 100)
+	viper.SetDefault("log.max_backups", 7)
+	viper.SetDefault("log.max_age", 30)
+	viper.SetDefault("log.compress", true)
+
+	// 链路追踪默认配置
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.service_name", "video-converter")
+	viper.SetDefault("tracing.endpoint", "localhost:4318")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+
+	// 跨域默认配置
+	viper.SetDefault("cors.allowed_origins", []string{"http://localhost:8080"})
+	viper.SetDefault("cors.allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"})
+	viper.SetDefault("cors.allowed_headers", []string{
+		"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID", "X-API-Key", "X-Anonymous-Token",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata",
+	})
+	viper.SetDefault("cors.exposed_headers", []string{
+		"Content-Length", "Content-Disposition", "X-Request-ID", "X-Anonymous-Token",
+		"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Offset", "Upload-Length", "Upload-Expires", "X-Task-ID",
+	})
+	viper.SetDefault("cors.allow_credentials", true)
+	viper.SetDefault("cors.max_age", 600)
+
+	// 认证默认配置
+	viper.SetDefault("auth.session_ttl", 7*24*3600) // 7天
+	viper.SetDefault("auth.admin.username", "")
+	viper.SetDefault("auth.admin.email", "")
+	viper.SetDefault("auth.admin.password", "")
+	viper.SetDefault("auth.anonymous.secret", "")
+	viper.SetDefault("auth.anonymous.cookie_name", "vc_anon")
+	viper.SetDefault("auth.anonymous.max_age", 30*24*3600) // 30天
+	viper.SetDefault("auth.oidc.enabled", false)
+	viper.SetDefault("auth.oidc.provider_name", "oidc")
+	viper.SetDefault("auth.oidc.display_name", "企业账号登录")
+	viper.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("auth.oidc.groups_claim", "groups")
+	viper.SetDefault("auth.oidc.post_login_redirect", "/")
+	viper.SetDefault("auth.oidc.link_verified_email", false)
 }
 
 // GetDatabaseDSN 获取数据库连接字符串 (MySQL格式)
@@ -180,8 +524,224 @@ func (c *Config) ValidateConfig() error {
 		}
 	}
 
-	// 检查FFmpeg是否可用
-	// 这里可以添加FFmpeg可执行文件的检查逻辑
+	if strings.TrimSpace(c.File.DownloadNameTemplate) == "" {
+		return fmt.Errorf("file.download_name_template 不能为空")
+	}
+
+	// 检查存储配置
+	switch c.Storage.Backend {
+	case "local":
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			return fmt.Errorf("使用S3存储时必须配置 storage.s3.endpoint 和 storage.s3.bucket")
+		}
+		if c.Storage.PresignDownloads && c.Storage.PresignExpiry <= 0 {
+			return fmt.Errorf("storage.presign_expiry 必须大于0")
+		}
+	default:
+		return fmt.Errorf("storage.backend 无效: %s", c.Storage.Backend)
+	}
+
+	// 检查OIDC配置
+	if c.Auth.OIDC.Enabled {
+		oidc := c.Auth.OIDC
+		if oidc.IssuerURL == "" || oidc.ClientID == "" || oidc.RedirectURL == "" {
+			return fmt.Errorf("启用OIDC时必须配置 issuer_url、client_id 和 redirect_url")
+		}
+		for _, mapping := range oidc.RoleMappings {
+			if mapping.Role != "user" && mapping.Role != "admin" {
+				return fmt.Errorf("OIDC角色映射无效: 用户组 %s 映射到未知角色 %s", mapping.Group, mapping.Role)
+			}
+		}
+	}
+
+	// 检查跨域配置
+	if err := c.CORS.validate(); err != nil {
+		return err
+	}
+
+	// 检查限流配置
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+
+	// 检查日志配置
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("log.level 无效: %s", c.Log.Level)
+	}
+
+	// 检查磁盘空间准入控制配置
+	if err := c.DiskGuard.validate(); err != nil {
+		return err
+	}
+
+	// 检查文件保留策略配置
+	if c.Retention.Enabled {
+		if c.Retention.Interval <= 0 || c.Retention.BatchSize <= 0 {
+			return fmt.Errorf("retention.interval 和 retention.batch_size 必须大于0")
+		}
+		if c.Retention.ConvertedInputHours < 0 || c.Retention.OutputDays < 0 ||
+			c.Retention.FailedInputDays < 0 || c.Retention.UnconvertedInputDays < 0 {
+			return fmt.Errorf("retention 的保留时长不能为负数")
+		}
+	}
+
+	// 检查存储对账配置
+	if c.Reconcile.QuarantineDir == "" {
+		return fmt.Errorf("reconcile.quarantine_dir 不能为空")
+	}
+	if c.Reconcile.MinAgeHours < 1 {
+		return fmt.Errorf("reconcile.min_age_hours 必须大于0")
+	}
+
+	// 检查分享链接配置
+	if c.Share.Enabled && (c.Share.DefaultTTL <= 0 || c.Share.MaxTTL < c.Share.DefaultTTL) {
+		return fmt.Errorf("share.default_ttl 必须大于0且不超过 share.max_ttl")
+	}
+
+	// 检查链路追踪配置
+	if c.Tracing.Enabled && (c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1) {
+		return fmt.Errorf("tracing.sample_ratio 必须在0到1之间")
+	}
+
+	// 检查FFmpeg可执行文件是否存在，编码器等能力在启动时探测
+	if _, err := exec.LookPath(c.FFmpeg.BinaryPath); err != nil {
+		return fmt.Errorf("找不到ffmpeg可执行文件 %s: %v", c.FFmpeg.BinaryPath, err)
+	}
+	if _, err := exec.LookPath(c.FFmpeg.ProbePath); err != nil {
+		return fmt.Errorf("找不到ffprobe可执行文件 %s: %v", c.FFmpeg.ProbePath, err)
+	}
+
+	return nil
+}
+
+// validate 检查磁盘水位配置的目录名和水位大小
+func (d *DiskGuardConfig) validate() error {
+	if !d.Enabled {
+		return nil
+	}
+	if d.Interval <= 0 {
+		return fmt.Errorf("disk_guard.interval 必须大于0")
+	}
+	for name, wm := range d.Watermarks {
+		switch name {
+		case "upload", "output", "temp":
+		default:
+			return fmt.Errorf("disk_guard.watermarks 中的目录名无效: %s，可选 upload、output、temp", name)
+		}
+		if wm.LowMB < 0 || wm.CriticalMB < 0 {
+			return fmt.Errorf("disk_guard.watermarks.%s 水位不能为负数", name)
+		}
+		if wm.CriticalMB > wm.LowMB {
+			return fmt.Errorf("disk_guard.watermarks.%s 的临界水位不能高于低水位", name)
+		}
+	}
+	return nil
+}
+
+// validate 检查限流配置中引用的策略是否存在且参数合法
+func (r *RateLimitConfig) validate() error {
+	if !r.Enabled {
+		return nil
+	}
+
+	for name, policy := range r.Policies {
+		if policy.Limit <= 0 || policy.Period <= 0 || policy.Burst < 0 {
+			return fmt.Errorf("限流策略 %s 参数无效: limit和period必须大于0", name)
+		}
+	}
+
+	checkPolicy := func(name, owner string) error {
+		if _, ok := r.Policies[name]; !ok {
+			return fmt.Errorf("%s 引用了不存在的限流策略: %s", owner, name)
+		}
+		return nil
+	}
+
+	if err := checkPolicy(r.AnonymousPolicy, "rate_limit.anonymous_policy"); err != nil {
+		return err
+	}
+	if err := checkPolicy(r.UserPolicy, "rate_limit.user_policy"); err != nil {
+		return err
+	}
+	for _, user := range r.Users {
+		if err := checkPolicy(user.Policy, "用户 "+user.UserID); err != nil {
+			return err
+		}
+	}
+	for _, key := range r.APIKeys {
+		if key.Key == "" {
+			return fmt.Errorf("API Key %s 未配置key", key.Name)
+		}
+		if err := checkPolicy(key.Policy, "API Key "+key.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, route := range r.Routes {
+		owner := fmt.Sprintf("路由 %s %s", route.Method, route.Path)
+		if route.Policy != "" {
+			if err := checkPolicy(route.Policy, owner); err != nil {
+				return err
+			}
+		}
+		if route.Cost < 0 {
+			return fmt.Errorf("%s 的cost不能为负数", owner)
+		}
+
+		// 消耗超过桶容量的请求永远无法通过
+		policies := []string{route.Policy}
+		if route.Policy == "" {
+			policies = []string{r.AnonymousPolicy, r.UserPolicy}
+		}
+		for _, name := range policies {
+			policy := r.Policies[name]
+			capacity := policy.Burst
+			if capacity == 0 {
+				capacity = policy.Limit
+			}
+			if route.Cost > capacity {
+				return fmt.Errorf("%s 的cost(%d)超过策略 %s 的桶容量(%d)", owner, route.Cost, name, capacity)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate 检查跨域配置，允许携带凭证时不能使用 * 作为来源
+func (c *CORSConfig) validate() error {
+	check := func(origins []string, credentials bool, owner string) error {
+		for _, origin := range origins {
+			if origin == "*" && credentials {
+				return fmt.Errorf("%s: allow_credentials为true时allowed_origins不能包含*", owner)
+			}
+		}
+		return nil
+	}
+
+	if err := check(c.AllowedOrigins, c.AllowCredentials, "cors"); err != nil {
+		return err
+	}
+
+	for _, route := range c.Routes {
+		if route.PathPrefix == "" {
+			return fmt.Errorf("cors.routes 中存在未配置path_prefix的规则")
+		}
+		origins := route.AllowedOrigins
+		if len(origins) == 0 {
+			origins = c.AllowedOrigins
+		}
+		credentials := c.AllowCredentials
+		if route.AllowCredentials != nil {
+			credentials = *route.AllowCredentials
+		}
+		if err := check(origins, credentials, "cors.routes["+route.PathPrefix+"]"); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
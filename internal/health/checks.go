@@ -0,0 +1,201 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"video-converter/pkg/converter"
+	"video-converter/pkg/disk"
+	"video-converter/pkg/objectstore"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// DatabaseCheck 检查数据库连接
+func DatabaseCheck(db *gorm.DB) Check {
+	return Check{
+		Name:     "database",
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil, err
+			}
+			if err := sqlDB.PingContext(ctx); err != nil {
+				return nil, err
+			}
+
+			stats := sqlDB.Stats()
+			return map[string]interface{}{
+				"open_connections": stats.OpenConnections,
+				"in_use":           stats.InUse,
+				"idle":             stats.Idle,
+			}, nil
+		},
+	}
+}
+
+// RedisCheck 检查Redis连接
+func RedisCheck(client *redis.Client) Check {
+	return Check{
+		Name:     "redis",
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			if err := client.Ping(ctx).Err(); err != nil {
+				return nil, err
+			}
+
+			stats := client.PoolStats()
+			return map[string]interface{}{
+				"total_connections": stats.TotalConns,
+				"idle_connections":  stats.IdleConns,
+			}, nil
+		},
+	}
+}
+
+// FFmpegCheck 检查ffmpeg、ffprobe可执行文件以及转换所需的编码器
+// 可执行文件不会在运行期间变化，结果缓存cacheTTL以避免每次探测都启动子进程
+func FFmpegCheck(conv *converter.FFmpegConverter, audioCodec string, cacheTTL time.Duration) Check {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		details   map[string]interface{}
+		lastErr   error
+	)
+
+	return Check{
+		Name:     "ffmpeg",
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !checkedAt.IsZero() && time.Since(checkedAt) < cacheTTL {
+				return details, lastErr
+			}
+
+			details = map[string]interface{}{"required_encoder": audioCodec}
+			caps, err := conv.DetectCapabilities(ctx)
+			if err == nil {
+				details["ffmpeg_version"] = caps.FFmpegVersion
+				details["ffprobe_version"] = caps.FFprobeVersion
+				err = caps.Require(audioCodec)
+			}
+			lastErr = err
+
+			// 超时等偶发失败不缓存，下次重新探测
+			if ctx.Err() == nil {
+				checkedAt = time.Now()
+			}
+			return details, lastErr
+		},
+	}
+}
+
+// DirectoryCheck 检查目录可写且剩余空间不低于minFree字节
+func DirectoryCheck(name, dir string, minFree uint64) Check {
+	return Check{
+		Name:     "disk:" + name,
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			details := map[string]interface{}{"path": dir}
+
+			// 实际写入一个文件，只读挂载或权限问题都能暴露出来
+			file, err := os.CreateTemp(dir, ".healthcheck-*")
+			if err != nil {
+				return details, fmt.Errorf("目录不可写: %v", err)
+			}
+			file.Close()
+			os.Remove(file.Name())
+
+			usage, err := disk.GetUsage(dir)
+			if err != nil {
+				return details, fmt.Errorf("获取磁盘空间失败: %v", err)
+			}
+			details["available_bytes"] = usage.Available
+			details["total_bytes"] = usage.Total
+			details["min_free_bytes"] = minFree
+
+			if usage.Available < minFree {
+				return details, fmt.Errorf("剩余空间不足: 可用 %d MB，要求至少 %d MB",
+					usage.Available/1024/1024, minFree/1024/1024)
+			}
+			return details, nil
+		},
+	}
+}
+
+// storageProbeKey 检查对象存储时查询的键，不要求存在
+const storageProbeKey = ".healthcheck"
+
+// StorageCheck 检查对象存储可访问：查询一个探测键，返回对象不存在说明存储可达且凭证有效
+func StorageCheck(store objectstore.Store) Check {
+	return Check{
+		Name:     "storage",
+		Critical: true,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			details := map[string]interface{}{"backend": store.Backend()}
+			if _, err := store.Stat(ctx, storageProbeKey); err != nil && !errors.Is(err, objectstore.ErrNotExist) {
+				return details, err
+			}
+			return details, nil
+		},
+	}
+}
+
+// DiskGuardCheck 报告磁盘空间守卫的水位，低于低水位时新任务会被拒绝
+// 作为非关键检查只使整体降级，空间耗尽时由目录检查使实例不再就绪
+func DiskGuardCheck(guard *disk.Guard) Check {
+	return Check{
+		Name:     "disk_guard",
+		Critical: false,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			details := map[string]interface{}{
+				"level":       guard.Level().String(),
+				"directories": guard.Statuses(),
+			}
+			switch guard.Level() {
+			case disk.LevelCritical:
+				return details, errors.New("磁盘剩余空间低于临界水位，已拒绝新任务并暂停转换")
+			case disk.LevelLow:
+				return details, errors.New("磁盘剩余空间低于低水位，已拒绝新的上传和URL任务")
+			}
+			return details, nil
+		},
+	}
+}
+
+// HTTPCheck 检查HTTP服务可达，服务返回5xx或无法连接时视为异常
+func HTTPCheck(name, url string, critical bool) Check {
+	client := &http.Client{}
+
+	return Check{
+		Name:     name,
+		Critical: critical,
+		Run: func(ctx context.Context) (map[string]interface{}, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+
+			details := map[string]interface{}{"status_code": resp.StatusCode}
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return details, fmt.Errorf("服务返回 %s", resp.Status)
+			}
+			return details, nil
+		},
+	}
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status 组件或整体的健康状态
+type Status string
+
+const (
+	StatusUp       Status = "up"       // 正常
+	StatusDegraded Status = "degraded" // 非关键组件异常，仍可对外服务
+	StatusDown     Status = "down"     // 异常
+)
+
+// Check 单个组件的检查
+// 关键组件异常时实例不再就绪；非关键组件异常只会使整体降级
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) (map[string]interface{}, error)
+}
+
+// ComponentResult 单个组件的检查结果
+type ComponentResult struct {
+	Status    Status                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	LatencyMs int64                  `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report 健康检查报告
+type Report struct {
+	Status     Status                     `json:"status"`
+	Timestamp  time.Time                  `json:"timestamp"`
+	Components map[string]ComponentResult `json:"components"`
+}
+
+// Checker 并发执行一组检查
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewChecker 创建检查器，timeout为单个检查的超时时间
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Run 执行所有检查并汇总结果
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{
+		Status:     StatusUp,
+		Timestamp:  time.Now(),
+		Components: make(map[string]ComponentResult, len(c.checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := c.runCheck(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[check.Name] = result
+			if result.Status == StatusDown {
+				if check.Critical {
+					report.Status = StatusDown
+				} else if report.Status == StatusUp {
+					report.Status = StatusDegraded
+				}
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// runCheck 带超时执行单个检查
+func (c *Checker) runCheck(ctx context.Context, check Check) ComponentResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	done := make(chan outcome, 1)
+
+	start := time.Now()
+	go func() {
+		details, err := check.Run(ctx)
+		done <- outcome{details, err}
+	}()
+
+	result := ComponentResult{Status: StatusUp, Critical: check.Critical}
+	select {
+	case out := <-done:
+		result.Details = out.details
+		if out.err != nil {
+			result.Status = StatusDown
+			result.Error = out.err.Error()
+		}
+	case <-ctx.Done():
+		// 检查本身不响应context时也不会阻塞整个报告
+		result.Status = StatusDown
+		result.Error = "检查超时"
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+
+	return result
+}
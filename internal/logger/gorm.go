@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowSQLThreshold 超过该耗时的SQL以warn级别记录
+const slowSQLThreshold = 200 * time.Millisecond
+
+// GormLogger 将GORM日志输出到slog，SQL日志带上context中的请求、任务和用户ID
+// 每条SQL以debug级别记录，慢SQL以warn级别记录，执行失败以error级别记录（不包括记录不存在）
+type GormLogger struct {
+	level slog.Level
+}
+
+// NewGormLogger 创建GORM日志适配器，低于level的日志不输出
+func NewGormLogger(level slog.Level) *GormLogger {
+	return &GormLogger{level: level}
+}
+
+// LogMode 实现gormlogger.Interface，db.Debug() 等调用会借此临时调整级别
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	adjusted := *l
+	switch level {
+	case gormlogger.Silent:
+		adjusted.level = slog.LevelError + 1
+	case gormlogger.Error:
+		adjusted.level = slog.LevelError
+	case gormlogger.Warn:
+		adjusted.level = slog.LevelWarn
+	default:
+		adjusted.level = slog.LevelDebug
+	}
+	return &adjusted
+}
+
+// Info 实现gormlogger.Interface
+func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l.log(ctx, slog.LevelInfo, msg, data...)
+}
+
+// Warn 实现gormlogger.Interface
+func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.log(ctx, slog.LevelWarn, msg, data...)
+}
+
+// Error 实现gormlogger.Interface
+func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l.log(ctx, slog.LevelError, msg, data...)
+}
+
+// Trace 实现gormlogger.Interface，记录每条SQL的耗时和影响行数
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level <= slog.LevelError:
+		sql, rows := fc()
+		slog.ErrorContext(ctx, "SQL执行失败", "sql", sql, "rows", rows, "elapsed_ms", elapsed.Milliseconds(), "error", err)
+	case elapsed > slowSQLThreshold && l.level <= slog.LevelWarn:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "慢SQL", "sql", sql, "rows", rows, "elapsed_ms", elapsed.Milliseconds())
+	case l.level <= slog.LevelDebug:
+		sql, rows := fc()
+		slog.DebugContext(ctx, "SQL", "sql", sql, "rows", rows, "elapsed_ms", elapsed.Milliseconds())
+	}
+}
+
+// log 按级别输出格式化的GORM消息
+func (l *GormLogger) log(ctx context.Context, level slog.Level, msg string, data ...interface{}) {
+	if level < l.level {
+		return
+	}
+	slog.Log(ctx, level, fmt.Sprintf(msg, data...))
+}
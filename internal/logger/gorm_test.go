@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// captureDefault 将全局slog日志临时输出到缓冲区
+func captureDefault(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(&contextHandler{
+		Handler: slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	}))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestGormLoggerTrace(t *testing.T) {
+	sql := func() (string, int64) { return "SELECT 1", 1 }
+	now := time.Now()
+	slow := now.Add(-time.Second)
+
+	tests := []struct {
+		name      string
+		level     slog.Level
+		begin     time.Time
+		err       error
+		wantLevel string // 为空表示不输出
+	}{
+		{name: "debug级别记录每条SQL", level: slog.LevelDebug, begin: now, wantLevel: "DEBUG"},
+		{name: "info级别不记录普通SQL", level: slog.LevelInfo, begin: now},
+		{name: "慢SQL", level: slog.LevelInfo, begin: slow, wantLevel: "WARN"},
+		{name: "执行失败", level: slog.LevelInfo, begin: now, err: errors.New("deadlock"), wantLevel: "ERROR"},
+		{name: "记录不存在不算失败", level: slog.LevelInfo, begin: now, err: gorm.ErrRecordNotFound},
+		{name: "error级别不记录慢SQL", level: slog.LevelError, begin: slow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureDefault(t)
+			ctx := WithTaskID(WithRequestID(context.Background(), "req-1"), "task-1")
+
+			NewGormLogger(tt.level).Trace(ctx, tt.begin, sql, tt.err)
+
+			if tt.wantLevel == "" {
+				if buf.Len() != 0 {
+					t.Fatalf("不应输出日志，实际输出: %s", buf.String())
+				}
+				return
+			}
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("日志不是单条JSON: %q", buf.String())
+			}
+			if entry["level"] != tt.wantLevel || entry["sql"] != "SELECT 1" {
+				t.Errorf("日志 level=%v sql=%v，应为 %s 和 SELECT 1", entry["level"], entry["sql"], tt.wantLevel)
+			}
+			if entry["request_id"] != "req-1" || entry["task_id"] != "task-1" {
+				t.Errorf("日志缺少关联字段: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestGormLoggerLogMode(t *testing.T) {
+	buf := captureDefault(t)
+
+	silent := NewGormLogger(slog.LevelDebug).LogMode(gormlogger.Silent)
+	silent.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT 1", 1 }, errors.New("boom"))
+	silent.Error(context.Background(), "failed %d", 1)
+	if buf.Len() != 0 {
+		t.Fatalf("Silent模式不应输出日志，实际输出: %s", buf.String())
+	}
+
+	NewGormLogger(slog.LevelInfo).LogMode(gormlogger.Info).Info(context.Background(), "migrated %s", "users")
+	if !strings.Contains(buf.String(), "migrated users") {
+		t.Errorf("Info模式应输出格式化消息，实际输出: %s", buf.String())
+	}
+}
@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"video-converter/internal/config"
+
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// ctxKey 日志关联字段在context中的键
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	taskIDKey
+	userIDKey
+)
+
+// Init 根据 log 配置初始化JSON格式的全局slog日志
+// 标准库 log 包的输出也会经由该日志输出，返回值用于关闭日志文件
+func Init(cfg *config.LogConfig) (io.Closer, error) {
+	var (
+		writer io.Writer = os.Stdout
+		closer io.Closer = nopCloser{}
+	)
+
+	if cfg.FilePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.FilePath), 0755); err != nil {
+			return nil, err
+		}
+		rotator := &lumberjack.Logger{
+			Filename:   cfg.FilePath,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+			Compress:   cfg.Compress,
+		}
+		writer = io.MultiWriter(os.Stdout, rotator)
+		closer = rotator
+	}
+
+	handler := &contextHandler{
+		Handler: slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: ParseLevel(cfg.Level)}),
+	}
+	slog.SetDefault(slog.New(handler))
+
+	return closer, nil
+}
+
+// ParseLevel 解析日志级别，无法识别时返回info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithRequestID 在context中记录请求ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// WithTaskID 在context中记录任务ID
+func WithTaskID(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, taskIDKey, taskID)
+}
+
+// WithUserID 在context中记录用户ID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// RequestID 获取context中的请求ID
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// contextHandler 将context中的关联字段附加到每条日志
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle 实现slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestID, ok := ctx.Value(requestIDKey).(string); ok && requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+		if taskID, ok := ctx.Value(taskIDKey).(string); ok && taskID != "" {
+			record.AddAttrs(slog.String("task_id", taskID))
+		}
+		if userID, ok := ctx.Value(userIDKey).(string); ok && userID != "" {
+			record.AddAttrs(slog.String("user_id", userID))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs 实现slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup 实现slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// nopCloser 未写日志文件时的空关闭器
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
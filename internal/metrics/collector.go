@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// ProcessorStatsFunc 获取任务处理器状态（worker总数、忙碌数、内存队列长度）
+type ProcessorStatsFunc func() (workers, busy, channelDepth int)
+
+// StateCollector 在抓取时采集任务状态、队列和磁盘占用
+type StateCollector struct {
+	db             *gorm.DB
+	processorStats ProcessorStatsFunc
+	dirs           map[string]string
+
+	tasksDesc        *prometheus.Desc
+	queueDepthDesc   *prometheus.Desc
+	workersDesc      *prometheus.Desc
+	busyWorkersDesc  *prometheus.Desc
+	channelDepthDesc *prometheus.Desc
+	dirBytesDesc     *prometheus.Desc
+
+	// 目录遍历开销较大，结果缓存一段时间
+	mu          sync.Mutex
+	dirSizes    map[string]int64
+	dirSizesAt  time.Time
+	dirSizesTTL time.Duration
+}
+
+// NewStateCollector 创建状态采集器
+func NewStateCollector(db *gorm.DB, processorStats ProcessorStatsFunc, dirs map[string]string) *StateCollector {
+	return &StateCollector{
+		db:             db,
+		processorStats: processorStats,
+		dirs:           dirs,
+		tasksDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "tasks"),
+			"各状态的任务数", []string{"status"}, nil),
+		queueDepthDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_depth"),
+			"等待处理的任务数", nil, nil),
+		workersDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "workers"),
+			"worker总数", nil, nil),
+		busyWorkersDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "workers_busy"),
+			"正在处理任务的worker数", nil, nil),
+		channelDepthDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_channel_depth"),
+			"已分发到内存队列但尚未开始的任务数", nil, nil),
+		dirBytesDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "storage_directory_bytes"),
+			"存储目录占用的字节数", []string{"directory", "path"}, nil),
+		dirSizesTTL: 30 * time.Second,
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (sc *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.tasksDesc
+	ch <- sc.queueDepthDesc
+	ch <- sc.workersDesc
+	ch <- sc.busyWorkersDesc
+	ch <- sc.channelDepthDesc
+	ch <- sc.dirBytesDesc
+}
+
+// Collect 实现prometheus.Collector
+func (sc *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := sc.db.Table("conversion_tasks").
+		Select("status, COUNT(*) AS count").
+		Where("deleted_at IS NULL").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		slog.Warn("采集任务状态指标失败", "error", err)
+	} else {
+		var queued int64
+		for _, row := range rows {
+			ch <- prometheus.MustNewConstMetric(sc.tasksDesc, prometheus.GaugeValue, float64(row.Count), row.Status)
+			if row.Status == "queued" {
+				queued = row.Count
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(sc.queueDepthDesc, prometheus.GaugeValue, float64(queued))
+	}
+
+	if sc.processorStats != nil {
+		workers, busy, channelDepth := sc.processorStats()
+		ch <- prometheus.MustNewConstMetric(sc.workersDesc, prometheus.GaugeValue, float64(workers))
+		ch <- prometheus.MustNewConstMetric(sc.busyWorkersDesc, prometheus.GaugeValue, float64(busy))
+		ch <- prometheus.MustNewConstMetric(sc.channelDepthDesc, prometheus.GaugeValue, float64(channelDepth))
+	}
+
+	for name, size := range sc.directorySizes() {
+		ch <- prometheus.MustNewConstMetric(sc.dirBytesDesc, prometheus.GaugeValue, float64(size), name, sc.dirs[name])
+	}
+}
+
+// directorySizes 获取（缓存的）目录占用
+func (sc *StateCollector) directorySizes() map[string]int64 {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.dirSizes != nil && time.Since(sc.dirSizesAt) < sc.dirSizesTTL {
+		return sc.dirSizes
+	}
+
+	sizes := make(map[string]int64, len(sc.dirs))
+	for name, dir := range sc.dirs {
+		var size int64
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// 遍历过程中文件被删除等情况直接跳过
+				return nil
+			}
+			if !d.IsDir() {
+				if info, err := d.Info(); err == nil {
+					size += info.Size()
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Warn("统计目录占用失败", "dir", dir, "error", err)
+			continue
+		}
+		sizes[name] = size
+	}
+
+	sc.dirSizes = sizes
+	sc.dirSizesAt = time.Now()
+	return sizes
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// RegisterDBCallbacks 注册GORM回调，统计数据库操作错误
+func RegisterDBCallbacks(db *gorm.DB) error {
+	callback := db.Callback()
+
+	record := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if tx.Error == nil || errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				return
+			}
+			table := ""
+			if tx.Statement != nil {
+				table = tx.Statement.Table
+			}
+			DBErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+
+	if err := callback.Create().After("gorm:create").Register("metrics:create", record("create")); err != nil {
+		return err
+	}
+	if err := callback.Query().After("gorm:query").Register("metrics:query", record("query")); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Register("metrics:update", record("update")); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:delete").Register("metrics:delete", record("delete")); err != nil {
+		return err
+	}
+	if err := callback.Row().After("gorm:row").Register("metrics:row", record("row")); err != nil {
+		return err
+	}
+	return callback.Raw().After("gorm:raw").Register("metrics:raw", record("raw"))
+}
+
+// RedisHook 统计Redis命令错误的go-redis钩子
+type RedisHook struct{}
+
+// BeforeProcess 实现redis.Hook
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcess 实现redis.Hook
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	recordRedisError(cmd)
+	return nil
+}
+
+// BeforeProcessPipeline 实现redis.Hook
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcessPipeline 实现redis.Hook
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		recordRedisError(cmd)
+	}
+	return nil
+}
+
+// recordRedisError 记录命令错误，键不存在不算错误
+func recordRedisError(cmd redis.Cmder) {
+	if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+		RedisErrors.WithLabelValues(cmd.Name()).Inc()
+	}
+}
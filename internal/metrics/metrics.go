@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "video_converter"
+
+var (
+	// HTTPRequestDuration HTTP请求耗时（按路由、方法、状态码）
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP请求处理耗时",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route", "status"})
+
+	// ConversionDuration 转换耗时
+	ConversionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "conversion_duration_seconds",
+		Help:      "单个任务FFmpeg转换耗时",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12), // 1s ~ 34min
+	}, []string{"result"})
+
+	// ConversionRealtimeFactor 转换速度（媒体时长/实际耗时，越大越快）
+	ConversionRealtimeFactor = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "conversion_realtime_factor",
+		Help:      "转换的实时倍率（媒体时长除以转换耗时）",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 50, 100, 200, 500},
+	})
+
+	// TasksFinished 结束的任务数（按最终状态）
+	TasksFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_finished_total",
+		Help:      "处理结束的任务数",
+	}, []string{"status"})
+
+	// FFmpegExits FFmpeg进程退出码
+	FFmpegExits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_exits_total",
+		Help:      "FFmpeg进程退出次数（按退出码）",
+	}, []string{"binary", "code"})
+
+	// DownloadServiceDuration 下载服务调用耗时
+	DownloadServiceDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_service_duration_seconds",
+		Help:      "调用视频下载服务的耗时（含文件传输）",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 12),
+	}, []string{"result"})
+
+	// DownloadServiceErrors 下载服务错误
+	DownloadServiceErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_service_errors_total",
+		Help:      "视频下载服务错误次数",
+	}, []string{"reason"})
+
+	// RedisErrors Redis命令错误
+	RedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Redis命令执行错误次数",
+	}, []string{"command"})
+
+	// DBErrors 数据库操作错误
+	DBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_errors_total",
+		Help:      "数据库操作错误次数（不含记录不存在）",
+	}, []string{"operation", "table"})
+
+	// DedupHits 内容去重命中
+	DedupHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dedup_hits_total",
+		Help:      "复用已有文件的次数（input为相同上传，output为相同转换结果）",
+	}, []string{"kind"})
+
+	// RetentionReleased 保留策略释放的文件引用
+	RetentionReleased = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_released_total",
+		Help:      "按保留策略释放的文件引用次数（input为上传文件，output为转换结果）",
+	}, []string{"artifact"})
+)
+
+// ObserveHTTPRequest 记录一次HTTP请求
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	HTTPRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveConversion 记录一次转换结果
+func ObserveConversion(result string, elapsed time.Duration, mediaDuration float64) {
+	ConversionDuration.WithLabelValues(result).Observe(elapsed.Seconds())
+	if result == "success" && mediaDuration > 0 && elapsed > 0 {
+		ConversionRealtimeFactor.Observe(mediaDuration / elapsed.Seconds())
+	}
+}
+
+// ObserveProcessExit 记录外部进程退出码
+func ObserveProcessExit(binary string, err error) {
+	code := "0"
+	if err != nil {
+		var exitErr interface{ ExitCode() int }
+		if errors.As(err, &exitErr) {
+			if exitCode := exitErr.ExitCode(); exitCode >= 0 {
+				code = strconv.Itoa(exitCode)
+			} else {
+				code = "signal"
+			}
+		} else {
+			code = "start_error"
+		}
+	}
+	FFmpegExits.WithLabelValues(binary, code).Inc()
+}
+
+// ObserveDownload 记录一次下载服务调用
+func ObserveDownload(duration time.Duration, reason string) {
+	result := "success"
+	if reason != "" {
+		result = "error"
+		DownloadServiceErrors.WithLabelValues(reason).Inc()
+	}
+	DownloadServiceDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
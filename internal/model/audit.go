@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// AuditAction 审计操作类型
+type AuditAction string
+
+const (
+	AuditActionUserSuspend      AuditAction = "user.suspend"      // 停用用户
+	AuditActionUserActivate     AuditAction = "user.activate"     // 启用用户
+	AuditActionTaskCancel       AuditAction = "task.cancel"       // 强制取消任务
+	AuditActionTaskRequeue      AuditAction = "task.requeue"      // 重新排队任务
+	AuditActionTaskDelete       AuditAction = "task.delete"       // 删除任务
+	AuditActionStorageCleanup   AuditAction = "storage.cleanup"   // 清理存储
+	AuditActionStorageReconcile AuditAction = "storage.reconcile" // 存储对账
+)
+
+// AuditLog 管理操作审计日志
+type AuditLog struct {
+	ID         uint        `json:"id" gorm:"primaryKey;autoIncrement"`
+	ActorID    string      `json:"actor_id" gorm:"type:varchar(36);index"`
+	ActorName  string      `json:"actor_name" gorm:"type:varchar(50)"`
+	Action     AuditAction `json:"action" gorm:"type:varchar(50);index"`
+	TargetType string      `json:"target_type" gorm:"type:varchar(20)"`
+	TargetID   string      `json:"target_id" gorm:"type:varchar(100);index"`
+	Detail     string      `json:"detail" gorm:"type:text"`
+	ClientIP   string      `json:"client_ip" gorm:"type:varchar(64)"`
+	CreatedAt  time.Time   `json:"created_at" gorm:"index"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// BlobKind 存储文件类型
+type BlobKind string
+
+const (
+	BlobKindInput  BlobKind = "input"  // 上传的输入文件
+	BlobKindOutput BlobKind = "output" // 转换生成的输出文件
+)
+
+// FileBlob 按内容去重的存储文件，多个任务共享同一文件时通过引用计数管理生命周期
+type FileBlob struct {
+	ID          uint     `json:"id" gorm:"primaryKey;autoIncrement"`
+	Kind        BlobKind `json:"kind" gorm:"type:varchar(10);not null;uniqueIndex:idx_file_blobs_key"`
+	Hash        string   `json:"hash" gorm:"type:varchar(64);not null;uniqueIndex:idx_file_blobs_key"` // 输入为内容的SHA-256，输出为任务的 OutputKey
+	Path        string   `json:"path" gorm:"type:varchar(500);not null;uniqueIndex"`
+	Size        int64    `json:"size"`
+	ContentHash string   `json:"content_hash" gorm:"type:varchar(64)"` // 输出文件内容的SHA-256，输入文件的Hash即为内容哈希
+	RefCount    int      `json:"ref_count" gorm:"not null;default:0"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (FileBlob) TableName() string {
+	return "file_blobs"
+}
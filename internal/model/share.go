@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// ShareLink 转换结果的分享链接，持有链接的人无需登录即可下载
+// 链接本身带签名和过期时间，记录用于限制下载次数和撤销
+type ShareLink struct {
+	ID            string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	TaskID        string     `json:"task_id" gorm:"type:varchar(36);not null;index"`
+	UserID        string     `json:"user_id" gorm:"type:varchar(36);index"`
+	AnonymousID   string     `json:"-" gorm:"type:varchar(36)"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"index"`
+	MaxDownloads  int        `json:"max_downloads" gorm:"not null;default:0"` // 0 表示不限次数
+	DownloadCount int        `json:"download_count" gorm:"not null;default:0"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+// Active 链接是否仍可使用
+func (s *ShareLink) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt) &&
+		(s.MaxDownloads == 0 || s.DownloadCount < s.MaxDownloads)
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,11 +13,13 @@ import (
 type TaskStatus string
 
 const (
+	TaskStatusUploaded   TaskStatus = "uploaded"   // 已上传，等待提交转换
 	TaskStatusQueued     TaskStatus = "queued"     // 排队中
 	TaskStatusProcessing TaskStatus = "processing" // 处理中
 	TaskStatusCompleted  TaskStatus = "completed"  // 已完成
 	TaskStatusFailed     TaskStatus = "failed"     // 失败
 	TaskStatusCanceled   TaskStatus = "canceled"   // 已取消
+	TaskStatusExpired    TaskStatus = "expired"    // 已过保留期，文件已释放
 )
 
 // TaskType 任务类型
@@ -27,12 +32,15 @@ const (
 
 // ConversionTask 转换任务模型
 type ConversionTask struct {
-	ID          string     `json:"id" gorm:"type:varchar(36);primaryKey"`
-	UserID      string     `json:"user_id" gorm:"type:varchar(36);index"`
-	Type        TaskType   `json:"type" gorm:"type:varchar(20);not null"`
-	Status      TaskStatus `json:"status" gorm:"type:varchar(20);default:'queued';index"`
-	Title       string     `json:"title" gorm:"type:varchar(255)"`
-	Description string     `json:"description" gorm:"type:text"`
+	ID           string     `json:"id" gorm:"type:varchar(36);primaryKey"`
+	UserID       string     `json:"user_id" gorm:"type:varchar(36);index"`
+	AnonymousID  string     `json:"-" gorm:"type:varchar(36);index"`                  // 未登录访客的匿名会话ID
+	TraceContext string     `json:"-" gorm:"type:varchar(512)"`                       // 创建任务的请求的trace上下文，供worker延续链路
+	BatchID      string     `json:"batch_id,omitempty" gorm:"type:varchar(36);index"` // 同一次多文件或压缩包上传创建的任务共用
+	Type         TaskType   `json:"type" gorm:"type:varchar(20);not null"`
+	Status       TaskStatus `json:"status" gorm:"type:varchar(20);default:'queued';index"`
+	Title        string     `json:"title" gorm:"type:varchar(255)"`
+	Description  string     `json:"description" gorm:"type:text"`
 
 	// 文件路径信息
 	InputPath    string `json:"input_path" gorm:"type:varchar(500)"`
@@ -44,15 +52,21 @@ type ConversionTask struct {
 	OriginalName string `json:"original_name" gorm:"type:varchar(255)"` // 原始文件名
 
 	// 文件信息
-	FileSize   int64   `json:"file_size"`                 // 输入文件大小(bytes)
-	OutputSize int64   `json:"output_size"`               // 输出文件大小(bytes)
-	Duration   float64 `json:"duration"`                  // 视频时长(秒)
-	Progress   float64 `json:"progress" gorm:"default:0"` // 进度(0-100)
+	InputHash  string  `json:"input_hash" gorm:"type:varchar(64);index"` // 输入文件内容的SHA-256，用于去重
+	FileSize   int64   `json:"file_size"`                                // 输入文件大小(bytes)
+	OutputSize int64   `json:"output_size"`                              // 输出文件大小(bytes)
+	OutputHash string  `json:"output_hash" gorm:"type:varchar(64)"`      // 输出文件内容的SHA-256，用作下载的ETag
+	Duration   float64 `json:"duration"`                                 // 视频时长(秒)
+	Progress   float64 `json:"progress" gorm:"default:0"`                // 进度(0-100)
 
 	// 转换参数
-	AudioCodec   string `json:"audio_codec" gorm:"type:varchar(50);default:'libmp3lame'"`
-	AudioBitrate string `json:"audio_bitrate" gorm:"type:varchar(20);default:'192k'"`
-	SampleRate   string `json:"sample_rate" gorm:"type:varchar(20);default:'44100'"`
+	AudioCodec   string  `json:"audio_codec" gorm:"type:varchar(50);default:'libmp3lame'"`
+	AudioBitrate string  `json:"audio_bitrate" gorm:"type:varchar(20);default:'192k'"`
+	SampleRate   string  `json:"sample_rate" gorm:"type:varchar(20);default:'44100'"`
+	OutputFormat string  `json:"output_format" gorm:"type:varchar(10);default:'mp3'"`
+	TrimStart    float64 `json:"trim_start"` // 截取起始时间(秒)
+	TrimEnd      float64 `json:"trim_end"`   // 截取结束时间(秒)，0表示到结尾
+	Normalize    bool    `json:"normalize"`  // 是否做响度标准化
 
 	// 错误信息
 	ErrorMessage string `json:"error_message" gorm:"type:text"`
@@ -60,20 +74,37 @@ type ConversionTask struct {
 	// 时间戳
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty" gorm:"index"` // 按保留策略过期的时间，任务进入已上传或结束状态后设置
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// 关联
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// UserRole 用户角色类型
+type UserRole string
+
+const (
+	UserRoleUser  UserRole = "user"  // 普通用户
+	UserRoleAdmin UserRole = "admin" // 管理员
+)
+
+// AuthProviderLocal 本地账号的身份来源
+const AuthProviderLocal = "local"
+
 // User 用户模型
 type User struct {
-	ID       string `json:"id" gorm:"type:varchar(36);primaryKey"`
-	Username string `json:"username" gorm:"type:varchar(50);uniqueIndex"`
-	Email    string `json:"email" gorm:"type:varchar(100);uniqueIndex"`
-	Password string `json:"-" gorm:"type:varchar(255)"` // 不在JSON中显示
-	Avatar   string `json:"avatar" gorm:"type:varchar(500)"`
-	IsActive bool   `json:"is_active" gorm:"default:true"`
+	ID       string   `json:"id" gorm:"type:varchar(36);primaryKey"`
+	Username string   `json:"username" gorm:"type:varchar(50);uniqueIndex"`
+	Email    string   `json:"email" gorm:"type:varchar(100);uniqueIndex"`
+	Password string   `json:"-" gorm:"type:varchar(255)"` // 不在JSON中显示
+	Avatar   string   `json:"avatar" gorm:"type:varchar(500)"`
+	IsActive bool     `json:"is_active" gorm:"default:true"`
+	Role     UserRole `json:"role" gorm:"type:varchar(20);default:'user';index"`
+
+	// 外部身份（OIDC单点登录），本地账号为 local
+	AuthProvider string `json:"auth_provider" gorm:"type:varchar(50);default:'local';index:idx_users_external"`
+	ExternalID   string `json:"-" gorm:"type:varchar(255);index:idx_users_external"`
 
 	// 统计信息
 	TaskCount      int `json:"task_count" gorm:"default:0"`
@@ -91,6 +122,7 @@ type User struct {
 // TaskSummary 任务摘要（用于列表显示）
 type TaskSummary struct {
 	ID           string     `json:"id"`
+	BatchID      string     `json:"batch_id,omitempty"`
 	Title        string     `json:"title"`
 	Type         TaskType   `json:"type"`
 	Status       TaskStatus `json:"status"`
@@ -99,6 +131,7 @@ type TaskSummary struct {
 	FileSize     int64      `json:"file_size"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
 	ErrorMessage string     `json:"error_message,omitempty"`
 }
 
@@ -106,6 +139,7 @@ type TaskSummary struct {
 func (t *ConversionTask) ToSummary() TaskSummary {
 	return TaskSummary{
 		ID:           t.ID,
+		BatchID:      t.BatchID,
 		Title:        t.Title,
 		Type:         t.Type,
 		Status:       t.Status,
@@ -114,6 +148,7 @@ func (t *ConversionTask) ToSummary() TaskSummary {
 		FileSize:     t.FileSize,
 		CreatedAt:    t.CreatedAt,
 		UpdatedAt:    t.UpdatedAt,
+		ExpiresAt:    t.ExpiresAt,
 		ErrorMessage: t.ErrorMessage,
 	}
 }
@@ -135,7 +170,7 @@ func (t *ConversionTask) IsProcessing() bool {
 
 // CanCancel 检查任务是否可以取消
 func (t *ConversionTask) CanCancel() bool {
-	return t.Status == TaskStatusQueued || t.Status == TaskStatusProcessing
+	return t.Status == TaskStatusUploaded || t.Status == TaskStatusQueued || t.Status == TaskStatusProcessing
 }
 
 // BeforeCreate 创建前钩子
@@ -147,11 +182,28 @@ func (t *ConversionTask) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// OutputKey 输入内容与转换参数的摘要，相同时转换结果相同，可直接复用
+// 输入哈希未知时返回空字符串
+func (t *ConversionTask) OutputKey() string {
+	if t.InputHash == "" {
+		return ""
+	}
+	key := fmt.Sprintf("%s|%s|%s|%s|%s|%.3f|%.3f|%t", t.InputHash, t.OutputFormat, t.AudioCodec,
+		t.AudioBitrate, t.SampleRate, t.TrimStart, t.TrimEnd, t.Normalize)
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
 // TableName 指定表名
 func (ConversionTask) TableName() string {
 	return "conversion_tasks"
 }
 
+// IsAdmin 检查用户是否为管理员
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
 // TableName 指定表名
 func (User) TableName() string {
 	return "users"
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"video-converter/internal/metrics"
+	"video-converter/internal/model"
+	"video-converter/pkg/objectstore"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// blobCreateAttempts 登记文件时并发插入相同哈希会违反唯一索引，重试一次即可读到对方的记录
+const blobCreateAttempts = 2
+
+// BlobStore 按内容去重的文件引用计数
+// 相同内容的上传共享一个输入文件，相同输入和转换参数的任务共享一个输出文件，
+// 最后一个引用释放时才删除文件
+type BlobStore struct {
+	db    *gorm.DB
+	store objectstore.Store
+}
+
+// NewBlobStore 创建文件引用计数管理器
+func NewBlobStore(db *gorm.DB, store objectstore.Store) *BlobStore {
+	return &BlobStore{db: db, store: store}
+}
+
+// AcquireInput 登记新上传的文件并存入存储，返回任务应使用的文件路径（存储键）
+// path为上传目录中的本地文件，同时作为存储键；已有相同内容的文件时增加其引用计数并删除新文件，
+// 已登记的文件丢失时改用新文件
+func (bs *BlobStore) AcquireInput(ctx context.Context, hash, path string, size int64) (string, error) {
+	var acquired string
+	var err error
+	for attempt := 0; attempt < blobCreateAttempts; attempt++ {
+		acquired, err = bs.acquireInput(ctx, hash, path, size)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if acquired != path {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(ctx, "删除重复的上传文件失败", "path", path, "error", err)
+		}
+		metrics.DedupHits.WithLabelValues(string(model.BlobKindInput)).Inc()
+		slog.InfoContext(ctx, "上传内容与已有文件相同，共享存储", "hash", hash, "path", acquired)
+		return acquired, nil
+	}
+
+	// 新内容存入存储，失败时撤销登记
+	if err := bs.store.PutFile(ctx, path, path); err != nil {
+		if releaseErr := bs.Release(ctx, path); releaseErr != nil {
+			slog.WarnContext(ctx, "撤销上传文件登记失败", "path", path, "error", releaseErr)
+		}
+		os.Remove(path)
+		return "", fmt.Errorf("保存上传文件失败: %v", err)
+	}
+	return acquired, nil
+}
+
+// acquireInput 在事务中查找或创建输入文件的登记
+func (bs *BlobStore) acquireInput(ctx context.Context, hash, path string, size int64) (string, error) {
+	acquired := path
+	err := bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var blob model.FileBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&blob, "kind = ? AND hash = ?", model.BlobKindInput, hash).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return tx.Create(&model.FileBlob{
+				Kind:     model.BlobKindInput,
+				Hash:     hash,
+				Path:     path,
+				Size:     size,
+				RefCount: 1,
+			}).Error
+		case err != nil:
+			return err
+		}
+
+		if bs.exists(ctx, blob.Path) {
+			acquired = blob.Path
+			return tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count + 1")).Error
+		}
+
+		// 已登记的文件丢失，原有引用已无法使用，以新文件重新计数
+		slog.WarnContext(ctx, "已登记的文件不存在，使用新上传的文件", "hash", hash, "path", blob.Path)
+		return tx.Model(&blob).Updates(map[string]interface{}{
+			"path":      path,
+			"size":      size,
+			"ref_count": 1,
+		}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("登记上传文件失败: %v", err)
+	}
+	return acquired, nil
+}
+
+// AcquireOutput 查找相同输入和转换参数的已有输出并增加引用计数，没有可用的输出时返回nil
+func (bs *BlobStore) AcquireOutput(ctx context.Context, key string) (*model.FileBlob, error) {
+	var found *model.FileBlob
+	err := bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var blob model.FileBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&blob, "kind = ? AND hash = ?", model.BlobKindOutput, key).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// 输出文件已丢失，删除登记，由本次转换重新生成
+		if !bs.exists(ctx, blob.Path) {
+			return tx.Delete(&blob).Error
+		}
+
+		if err := tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+			return err
+		}
+		found = &blob
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查找已有输出失败: %v", err)
+	}
+	if found != nil {
+		metrics.DedupHits.WithLabelValues(string(model.BlobKindOutput)).Inc()
+	}
+	return found, nil
+}
+
+// RegisterOutput 登记已存入存储的输出文件，供相同输入和转换参数的任务复用
+// 相同参数的任务同时完成时只有一个能登记成功，其余的任务应删除自己的输出，改为复用已登记的输出
+func (bs *BlobStore) RegisterOutput(ctx context.Context, key, path string, size int64, contentHash string) error {
+	return bs.db.WithContext(ctx).Create(&model.FileBlob{
+		Kind:        model.BlobKindOutput,
+		Hash:        key,
+		Path:        path,
+		Size:        size,
+		ContentHash: contentHash,
+		RefCount:    1,
+	}).Error
+}
+
+// Release 释放任务对文件的引用，引用计数归零时删除文件和登记
+// 未登记的文件（去重之前创建的任务、URL下载的文件等）直接删除
+func (bs *BlobStore) Release(ctx context.Context, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	remove := false
+	err := bs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var blob model.FileBlob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, "path = ?", path).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			remove = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if blob.RefCount <= 1 {
+			remove = true
+			return tx.Delete(&blob).Error
+		}
+		return tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count - 1")).Error
+	})
+	if err != nil {
+		return fmt.Errorf("释放文件引用失败: %v", err)
+	}
+
+	if remove {
+		if err := bs.store.Delete(ctx, path); err != nil {
+			return fmt.Errorf("删除文件失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// exists 文件是否仍在存储中，无法确认时按存在处理，避免因存储暂时不可用而丢弃登记
+func (bs *BlobStore) exists(ctx context.Context, path string) bool {
+	_, err := bs.store.Stat(ctx, path)
+	return !errors.Is(err, objectstore.ErrNotExist)
+}
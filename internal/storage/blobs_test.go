@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-converter/internal/model"
+	"video-converter/pkg/objectstore"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestBlobStore(t *testing.T) (*BlobStore, *gorm.DB) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.FileBlob{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewBlobStore(db, objectstore.NewLocalStore()), db
+}
+
+// writeTestFile 在临时目录中创建文件
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func refCount(t *testing.T, db *gorm.DB, path string) int {
+	t.Helper()
+	var blob model.FileBlob
+	if err := db.First(&blob, "path = ?", path).Error; err != nil {
+		return 0
+	}
+	return blob.RefCount
+}
+
+func TestBlobStoreInputRefCount(t *testing.T) {
+	bs, db := newTestBlobStore(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first := writeTestFile(t, dir, "first.mp4", "same")
+	got, err := bs.AcquireInput(ctx, "hash-a", first, 4)
+	if err != nil || got != first {
+		t.Fatalf("首次上传 = %q, %v，应为 %q", got, err, first)
+	}
+
+	// 相同内容共享第一个文件，删除新文件
+	second := writeTestFile(t, dir, "second.mp4", "same")
+	got, err = bs.AcquireInput(ctx, "hash-a", second, 4)
+	if err != nil || got != first {
+		t.Fatalf("重复上传 = %q, %v，应为 %q", got, err, first)
+	}
+	if fileExists(second) {
+		t.Error("重复上传的文件没有删除")
+	}
+	if n := refCount(t, db, first); n != 2 {
+		t.Fatalf("引用计数 = %d，应为 2", n)
+	}
+
+	// 不同内容各自登记
+	other := writeTestFile(t, dir, "other.mp4", "other")
+	if got, err := bs.AcquireInput(ctx, "hash-b", other, 5); err != nil || got != other {
+		t.Fatalf("不同内容 = %q, %v，应为 %q", got, err, other)
+	}
+
+	// 释放一个引用后文件仍在，最后一个引用释放时删除文件和登记
+	if err := bs.Release(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(first) || refCount(t, db, first) != 1 {
+		t.Fatalf("释放一个引用后 exists=%v ref=%d", fileExists(first), refCount(t, db, first))
+	}
+	if err := bs.Release(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(first) {
+		t.Error("最后一个引用释放后文件没有删除")
+	}
+	var count int64
+	db.Model(&model.FileBlob{}).Where("path = ?", first).Count(&count)
+	if count != 0 {
+		t.Error("最后一个引用释放后登记没有删除")
+	}
+	if !fileExists(other) {
+		t.Error("释放时删除了其他内容的文件")
+	}
+}
+
+func TestBlobStoreInputMissingFile(t *testing.T) {
+	bs, db := newTestBlobStore(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first := writeTestFile(t, dir, "first.mp4", "same")
+	if _, err := bs.AcquireInput(ctx, "hash-a", first, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.AcquireInput(ctx, "hash-a", writeTestFile(t, dir, "dup.mp4", "same"), 4); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(first)
+
+	// 已登记的文件丢失时改用新文件，并重新计数
+	second := writeTestFile(t, dir, "second.mp4", "same")
+	got, err := bs.AcquireInput(ctx, "hash-a", second, 4)
+	if err != nil || got != second {
+		t.Fatalf("登记文件丢失后上传 = %q, %v，应为 %q", got, err, second)
+	}
+	if n := refCount(t, db, second); n != 1 {
+		t.Errorf("引用计数 = %d，应为 1", n)
+	}
+}
+
+func TestBlobStoreOutput(t *testing.T) {
+	bs, db := newTestBlobStore(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	if blob, err := bs.AcquireOutput(ctx, "key-a"); err != nil || blob != nil {
+		t.Fatalf("没有已有输出时 = %v, %v，应为 nil", blob, err)
+	}
+
+	output := writeTestFile(t, dir, "out.mp3", "output")
+	if err := bs.RegisterOutput(ctx, "key-a", output, 6, "content-hash"); err != nil {
+		t.Fatal(err)
+	}
+	// 相同参数的任务同时完成时只有一个能登记
+	if err := bs.RegisterOutput(ctx, "key-a", writeTestFile(t, dir, "out2.mp3", "output"), 6, "content-hash"); err == nil {
+		t.Error("重复登记相同的输出应失败")
+	}
+
+	blob, err := bs.AcquireOutput(ctx, "key-a")
+	if err != nil || blob == nil || blob.Path != output || blob.ContentHash != "content-hash" {
+		t.Fatalf("复用输出 = %+v, %v", blob, err)
+	}
+	if n := refCount(t, db, output); n != 2 {
+		t.Fatalf("引用计数 = %d，应为 2", n)
+	}
+
+	// 输出文件丢失时删除登记，由新任务重新生成
+	os.Remove(output)
+	if blob, err := bs.AcquireOutput(ctx, "key-a"); err != nil || blob != nil {
+		t.Fatalf("输出丢失后 = %v, %v，应为 nil", blob, err)
+	}
+	if n := refCount(t, db, output); n != 0 {
+		t.Errorf("输出丢失后登记仍在，引用计数 = %d", n)
+	}
+}
+
+func TestBlobStoreReleaseUnregistered(t *testing.T) {
+	bs, _ := newTestBlobStore(t)
+	ctx := context.Background()
+
+	// 未登记的文件直接删除，空路径和已删除的文件不报错
+	path := writeTestFile(t, t.TempDir(), "legacy.mp4", "legacy")
+	if err := bs.Release(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(path) {
+		t.Error("未登记的文件没有删除")
+	}
+	if err := bs.Release(ctx, path); err != nil {
+		t.Errorf("释放已删除的文件失败: %v", err)
+	}
+	if err := bs.Release(ctx, ""); err != nil {
+		t.Errorf("释放空路径失败: %v", err)
+	}
+}
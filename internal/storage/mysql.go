@@ -1,21 +1,22 @@
 package storage
 
 import (
-	"log"
+	"log/slog"
 	"time"
 
+	"video-converter/internal/logger"
 	"video-converter/internal/model"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 // NewMySQLDB 创建MySQL数据库连接
-func NewMySQLDB(dsn string) (*gorm.DB, error) {
+// SQL日志经由slog输出，logLevel 为 debug 时记录每条SQL，否则只记录慢SQL和执行失败
+func NewMySQLDB(dsn, logLevel string) (*gorm.DB, error) {
 	// 配置GORM
 	config := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: logger.NewGormLogger(logger.ParseLevel(logLevel)),
 	}
 
 	// 连接数据库
@@ -45,7 +46,7 @@ func NewMySQLDB(dsn string) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	log.Println("MySQL数据库连接成功")
+	slog.Info("MySQL数据库连接成功")
 	return db, nil
 }
 
@@ -56,6 +57,9 @@ func autoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&model.ConversionTask{},
 		&model.User{},
+		&model.AuditLog{},
+		&model.FileBlob{},
+		&model.ShareLink{},
 	)
 }
 
@@ -64,14 +68,14 @@ func CloseDB(db *gorm.DB) {
 	if db != nil {
 		sqlDB, err := db.DB()
 		if err != nil {
-			log.Printf("获取数据库连接失败: %v", err)
+			slog.Error("获取数据库连接失败", "error", err)
 			return
 		}
 
 		if err := sqlDB.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
+			slog.Error("关闭数据库连接失败", "error", err)
 		} else {
-			log.Println("数据库连接已关闭")
+			slog.Info("数据库连接已关闭")
 		}
 	}
 }
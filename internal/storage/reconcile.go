@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"video-converter/internal/config"
+	"video-converter/internal/logger"
+	"video-converter/internal/model"
+	"video-converter/pkg/objectstore"
+
+	"gorm.io/gorm"
+)
+
+// 对账发现的问题类型
+const (
+	IssueOrphanFile    = "orphan_file"    // 存储中的文件没有任务引用
+	IssueMissingInput  = "missing_input"  // 任务的输入文件不存在
+	IssueMissingOutput = "missing_output" // 任务的输出文件不存在
+	IssueMissingBlob   = "missing_blob"   // 去重记录指向的文件不存在
+	IssueBlobRefCount  = "blob_ref_count" // 去重记录的引用计数与引用该文件的任务数不一致
+)
+
+// 对账执行的操作
+const (
+	ActionQuarantine   = "quarantine"    // 移到隔离目录
+	ActionMarkFailed   = "mark_failed"   // 清除文件路径并将任务标记为失败
+	ActionClearPath    = "clear_path"    // 清除任务中的文件路径
+	ActionDeleteRecord = "delete_record" // 删除去重记录
+	ActionFixRefCount  = "fix_ref_count" // 按任务引用数修正引用计数
+)
+
+// ReconcileOptions 对账选项，不指定隔离和修复时只报告问题
+type ReconcileOptions struct {
+	DryRun     bool `json:"dry_run"`    // 只报告将要执行的操作，不修改存储和数据库
+	Quarantine bool `json:"quarantine"` // 将孤立文件移到隔离目录
+	Repair     bool `json:"repair"`     // 修复悬空引用和引用计数
+}
+
+// ReconcileIssue 对账发现的问题
+type ReconcileIssue struct {
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	TaskID string `json:"task_id,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Action string `json:"action,omitempty"` // 已执行（dry_run时为将要执行）的操作，为空表示只报告
+	Error  string `json:"error,omitempty"`  // 检查或执行操作失败的原因
+}
+
+// ReconcileReport 对账结果
+type ReconcileReport struct {
+	DryRun       bool             `json:"dry_run"`
+	ScannedFiles int              `json:"scanned_files"`
+	OrphanBytes  int64            `json:"orphan_bytes"`
+	Counts       map[string]int   `json:"counts"` // 各类问题的数量
+	Issues       []ReconcileIssue `json:"issues"`
+	StartedAt    time.Time        `json:"started_at"`
+	FinishedAt   time.Time        `json:"finished_at"`
+}
+
+// add 记录一个问题
+func (r *ReconcileReport) add(issue ReconcileIssue) {
+	r.Counts[issue.Type]++
+	r.Issues = append(r.Issues, issue)
+}
+
+// scannedFile 遍历目录得到的文件
+type scannedFile struct {
+	objectstore.ObjectInfo
+	local bool // 临时目录中的文件，不在存储中
+}
+
+// Reconciler 对比存储中的文件与任务记录，发现孤立文件和悬空引用
+// 上传目录和输出目录通过存储遍历，临时目录总在本地；
+// 隐藏文件（如断点续传暂存目录 .tus）和隔离目录不参与对账
+type Reconciler struct {
+	db           *gorm.DB
+	redisManager *RedisManager
+	store        objectstore.Store
+	fileCfg      *config.FileConfig
+	cfg          *config.ReconcileConfig
+}
+
+// NewReconciler 创建对账器
+func NewReconciler(db *gorm.DB, redisManager *RedisManager, store objectstore.Store, fileCfg *config.FileConfig, cfg *config.ReconcileConfig) *Reconciler {
+	return &Reconciler{
+		db:           db,
+		redisManager: redisManager,
+		store:        store,
+		fileCfg:      fileCfg,
+		cfg:          cfg,
+	}
+}
+
+// Run 执行一次对账
+// 修改时间在 min_age_hours 以内的文件和去重记录视为可能仍在写入，不判定为孤立
+func (r *Reconciler) Run(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		DryRun:    opts.DryRun,
+		Counts:    make(map[string]int),
+		Issues:    []ReconcileIssue{},
+		StartedAt: time.Now(),
+	}
+	cutoff := report.StartedAt.Add(-time.Duration(r.cfg.MinAgeHours) * time.Hour)
+	db := r.db.WithContext(ctx)
+
+	var tasks []model.ConversionTask
+	if err := db.Select("id", "status", "input_path", "output_path").
+		Where("input_path <> '' OR output_path <> ''").
+		Find(&tasks).Error; err != nil {
+		return nil, fmt.Errorf("查询任务失败: %v", err)
+	}
+	var blobs []model.FileBlob
+	if err := db.Find(&blobs).Error; err != nil {
+		return nil, fmt.Errorf("查询去重记录失败: %v", err)
+	}
+
+	// 每个文件被多少个任务引用
+	taskRefs := make(map[string]int)
+	for _, task := range tasks {
+		for _, path := range []string{task.InputPath, task.OutputPath} {
+			if path != "" {
+				taskRefs[objectstore.CleanKey(path)]++
+			}
+		}
+	}
+
+	files, err := r.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report.ScannedFiles = len(files)
+
+	// 去重记录最近有变化的文件可能正在被新任务引用
+	recentBlobs := make(map[string]bool)
+	blobIDs := make(map[string][]uint)
+	for _, blob := range blobs {
+		canonical := objectstore.CleanKey(blob.Path)
+		blobIDs[canonical] = append(blobIDs[canonical], blob.ID)
+		if blob.UpdatedAt.After(cutoff) {
+			recentBlobs[canonical] = true
+		}
+	}
+
+	keys := make([]string, 0, len(files))
+	for canonical := range files {
+		keys = append(keys, canonical)
+	}
+	sort.Strings(keys)
+	for _, canonical := range keys {
+		file := files[canonical]
+		if taskRefs[canonical] > 0 || recentBlobs[canonical] || file.ModTime.After(cutoff) {
+			continue
+		}
+		issue := ReconcileIssue{Type: IssueOrphanFile, Key: file.Key, Size: file.Size}
+		if opts.Quarantine {
+			issue.Action = ActionQuarantine
+			if !opts.DryRun {
+				if err := r.quarantine(ctx, file, blobIDs[canonical], report.StartedAt); err != nil {
+					issue.Error = err.Error()
+				}
+			}
+		}
+		report.OrphanBytes += file.Size
+		report.add(issue)
+	}
+
+	for _, task := range tasks {
+		r.checkTask(ctx, report, task, files, opts)
+	}
+	for _, blob := range blobs {
+		r.checkBlob(ctx, report, blob, files, taskRefs[objectstore.CleanKey(blob.Path)], cutoff, opts)
+	}
+
+	report.FinishedAt = time.Now()
+	slog.InfoContext(ctx, "存储对账完成",
+		"dry_run", opts.DryRun,
+		"scanned_files", report.ScannedFiles,
+		"issues", len(report.Issues),
+		"orphan_bytes", report.OrphanBytes,
+	)
+	return report, nil
+}
+
+// scan 遍历上传、输出和临时目录，按规范化的键索引
+func (r *Reconciler) scan(ctx context.Context) (map[string]scannedFile, error) {
+	files := make(map[string]scannedFile)
+	quarantine := objectstore.CleanKey(r.cfg.QuarantineDir) + "/"
+	collect := func(local bool) func(objectstore.ObjectInfo) error {
+		return func(info objectstore.ObjectInfo) error {
+			canonical := objectstore.CleanKey(info.Key)
+			if strings.HasPrefix(canonical, quarantine) || isHiddenKey(canonical) {
+				return nil
+			}
+			files[canonical] = scannedFile{ObjectInfo: info, local: local}
+			return nil
+		}
+	}
+
+	for _, dir := range []string{r.fileCfg.UploadDir, r.fileCfg.OutputDir} {
+		if err := r.store.List(ctx, dir, collect(false)); err != nil {
+			return nil, fmt.Errorf("遍历目录 %s 失败: %v", dir, err)
+		}
+	}
+	if err := objectstore.NewLocalStore().List(ctx, r.fileCfg.TempDir, collect(true)); err != nil {
+		return nil, fmt.Errorf("遍历目录 %s 失败: %v", r.fileCfg.TempDir, err)
+	}
+	return files, nil
+}
+
+// checkTask 检查任务引用的文件是否存在
+func (r *Reconciler) checkTask(ctx context.Context, report *ReconcileReport, task model.ConversionTask, files map[string]scannedFile, opts ReconcileOptions) {
+	refs := []struct {
+		issueType string
+		column    string
+		path      string
+	}{
+		{IssueMissingInput, "input_path", task.InputPath},
+		{IssueMissingOutput, "output_path", task.OutputPath},
+	}
+
+	for _, ref := range refs {
+		if ref.path == "" {
+			continue
+		}
+		exists, err := r.exists(ctx, ref.path, files)
+		if exists {
+			continue
+		}
+		issue := ReconcileIssue{Type: ref.issueType, Key: ref.path, TaskID: task.ID, Detail: string(task.Status)}
+		if err != nil {
+			issue.Error = err.Error()
+			report.add(issue)
+			continue
+		}
+
+		// 正在处理的任务由worker负责失败处理
+		if opts.Repair && task.Status != model.TaskStatusProcessing {
+			updates := map[string]interface{}{ref.column: ""}
+			issue.Action = ActionClearPath
+			if ref.column == "output_path" {
+				updates["output_size"] = 0
+				updates["output_hash"] = ""
+			}
+			// 已完成的任务没有输出、未开始转换的任务没有输入时无法继续，标记为失败
+			if (ref.column == "output_path" && task.Status == model.TaskStatusCompleted) ||
+				(ref.column == "input_path" && (task.Status == model.TaskStatusUploaded || task.Status == model.TaskStatusQueued)) {
+				updates["status"] = model.TaskStatusFailed
+				updates["error_message"] = "文件丢失: " + ref.path
+				updates["updated_at"] = time.Now()
+				issue.Action = ActionMarkFailed
+			}
+			if !opts.DryRun {
+				if err := r.repairTask(ctx, task, ref.column, ref.path, updates); err != nil {
+					issue.Error = err.Error()
+				}
+			}
+		}
+		report.add(issue)
+	}
+}
+
+// repairTask 以状态和路径为条件更新任务，任务在对账期间发生变化时跳过
+func (r *Reconciler) repairTask(ctx context.Context, task model.ConversionTask, column, path string, updates map[string]interface{}) error {
+	result := r.db.WithContext(ctx).Model(&model.ConversionTask{}).
+		Where("id = ? AND status = ? AND "+column+" = ?", task.ID, task.Status, path).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("任务在对账期间已变化，未修复")
+	}
+
+	taskCtx := logger.WithTaskID(ctx, task.ID)
+	if status, ok := updates["status"].(model.TaskStatus); ok {
+		r.redisManager.SetTaskStatus(taskCtx, task.ID, string(status))
+	}
+	slog.InfoContext(taskCtx, "已修复任务的悬空文件引用", "column", column, "path", path)
+	return nil
+}
+
+// checkBlob 检查去重记录指向的文件是否存在、引用计数是否与任务引用数一致
+func (r *Reconciler) checkBlob(ctx context.Context, report *ReconcileReport, blob model.FileBlob, files map[string]scannedFile, refs int, cutoff time.Time, opts ReconcileOptions) {
+	db := r.db.WithContext(ctx)
+	exists, err := r.exists(ctx, blob.Path, files)
+	if err != nil {
+		report.add(ReconcileIssue{Type: IssueMissingBlob, Key: blob.Path, Size: blob.Size, Error: err.Error()})
+		return
+	}
+
+	if !exists {
+		issue := ReconcileIssue{Type: IssueMissingBlob, Key: blob.Path, Size: blob.Size, Detail: string(blob.Kind)}
+		if opts.Repair {
+			issue.Action = ActionDeleteRecord
+			if !opts.DryRun {
+				if err := db.Delete(&model.FileBlob{}, blob.ID).Error; err != nil {
+					issue.Error = err.Error()
+				}
+			}
+		}
+		report.add(issue)
+		return
+	}
+
+	// 没有任务引用的文件按孤立文件处理，隔离时一并删除记录；最近有变化的记录可能正在被引用
+	if refs == 0 || refs == blob.RefCount || blob.UpdatedAt.After(cutoff) {
+		return
+	}
+	issue := ReconcileIssue{
+		Type:   IssueBlobRefCount,
+		Key:    blob.Path,
+		Size:   blob.Size,
+		Detail: fmt.Sprintf("ref_count=%d tasks=%d", blob.RefCount, refs),
+	}
+	if opts.Repair {
+		issue.Action = ActionFixRefCount
+		if !opts.DryRun {
+			result := db.Model(&model.FileBlob{}).
+				Where("id = ? AND ref_count = ?", blob.ID, blob.RefCount).
+				Update("ref_count", refs)
+			if result.Error != nil {
+				issue.Error = result.Error.Error()
+			} else if result.RowsAffected == 0 {
+				issue.Error = "引用计数在对账期间已变化，未修复"
+			}
+		}
+	}
+	report.add(issue)
+}
+
+// exists 文件是否存在，遍历目录时已找到的文件不再访问存储
+func (r *Reconciler) exists(ctx context.Context, key string, files map[string]scannedFile) (bool, error) {
+	if _, ok := files[objectstore.CleanKey(key)]; ok {
+		return true, nil
+	}
+	_, err := r.store.Stat(ctx, key)
+	if errors.Is(err, objectstore.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// quarantine 将孤立文件移到隔离目录，保留原有的目录结构，并删除指向它的去重记录
+func (r *Reconciler) quarantine(ctx context.Context, file scannedFile, blobIDs []uint, startedAt time.Time) error {
+	dst := filepath.Join(r.cfg.QuarantineDir, startedAt.Format("20060102-150405"), objectstore.CleanKey(file.Key))
+
+	var err error
+	if file.local {
+		err = r.store.PutFile(ctx, dst, file.Key)
+	} else {
+		err = objectstore.Move(ctx, r.store, file.Key, dst, r.fileCfg.TempDir)
+	}
+	if err != nil {
+		return fmt.Errorf("隔离文件失败: %v", err)
+	}
+
+	if len(blobIDs) > 0 {
+		if err := r.db.WithContext(ctx).Delete(&model.FileBlob{}, blobIDs).Error; err != nil {
+			return fmt.Errorf("删除去重记录失败: %v", err)
+		}
+	}
+	slog.InfoContext(ctx, "已隔离孤立文件", "key", file.Key, "quarantine", dst)
+	return nil
+}
+
+// isHiddenKey 键中是否有以 . 开头的路径段（上级目录 .. 除外）
+func isHiddenKey(key string) bool {
+	for _, part := range strings.Split(key, "/") {
+		if strings.HasPrefix(part, ".") && part != ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,11 @@ package storage
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 )
 
 // NewRedisClient 创建Redis客户端
@@ -31,7 +32,7 @@ func NewRedisClient(addr, password string, db int) (*redis.Client, error) {
 		return nil, err
 	}
 
-	log.Println("Redis连接成功")
+	slog.Info("Redis连接成功")
 	return client, nil
 }
 
@@ -91,7 +92,54 @@ func (rm *RedisManager) GetCache(ctx context.Context, key string) (string, error
 	return rm.client.Get(ctx, key).Result()
 }
 
+// PopCache 获取并删除缓存（一次性数据）
+func (rm *RedisManager) PopCache(ctx context.Context, key string) (string, error) {
+	return rm.client.GetDel(ctx, key).Result()
+}
+
 // DeleteCache 删除缓存
 func (rm *RedisManager) DeleteCache(ctx context.Context, key string) error {
 	return rm.client.Del(ctx, key).Err()
 }
+
+// SetSession 保存登录会话（token -> 用户ID）
+func (rm *RedisManager) SetSession(ctx context.Context, token, userID string, ttl time.Duration) error {
+	key := "session:" + token
+	return rm.client.Set(ctx, key, userID, ttl).Err()
+}
+
+// GetSession 根据token获取会话对应的用户ID
+func (rm *RedisManager) GetSession(ctx context.Context, token string) (string, error) {
+	key := "session:" + token
+	return rm.client.Get(ctx, key).Result()
+}
+
+// DeleteSession 删除登录会话
+func (rm *RedisManager) DeleteSession(ctx context.Context, token string) error {
+	key := "session:" + token
+	return rm.client.Del(ctx, key).Err()
+}
+
+// releaseLockScript 只有持有者才能释放锁，避免锁过期后误删其他实例的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock 尝试获取分布式锁，成功时返回用于释放锁的令牌
+// 锁已被占用时返回空令牌且不返回错误
+func (rm *RedisManager) AcquireLock(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	token := uuid.New().String()
+	ok, err := rm.client.SetNX(ctx, "lock:"+name, token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// ReleaseLock 释放分布式锁
+func (rm *RedisManager) ReleaseLock(ctx context.Context, name, token string) error {
+	return releaseLockScript.Run(ctx, rm.client, []string{"lock:" + name}, token).Err()
+}
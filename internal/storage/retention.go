@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"video-converter/internal/config"
+	"video-converter/internal/logger"
+	"video-converter/internal/metrics"
+	"video-converter/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// retentionLockTTL 保留策略清理锁的有效期，超过时其他实例可以接手
+// 每个任务都以状态为条件更新，偶尔两个实例同时清理也不会重复释放文件
+const retentionLockTTL = 10 * time.Minute
+
+// ErrRetentionRunning 其他实例正在执行保留策略清理
+var ErrRetentionRunning = errors.New("保留策略清理正在执行")
+
+// retentionRule 某一状态的任务从何时开始计算保留期
+type retentionRule struct {
+	statuses []model.TaskStatus
+	base     string // 计算过期时间的基准列
+	days     int
+}
+
+// RetentionScheduler 按保留策略释放任务文件
+// 任务进入已上传或结束状态后设置 expires_at，到期后释放文件并将任务标记为 expired；
+// 多实例部署时通过Redis锁保证同一时间只有一个实例执行
+type RetentionScheduler struct {
+	db           *gorm.DB
+	redisManager *RedisManager
+	blobStore    *BlobStore
+	cfg          *config.RetentionConfig
+}
+
+// RetentionResult 一轮保留策略清理的结果
+type RetentionResult struct {
+	ReleasedInputs int `json:"released_inputs"` // 释放了上传文件的已转换任务数
+	ExpiredTasks   int `json:"expired_tasks"`   // 过期并释放全部文件的任务数
+}
+
+// NewRetentionScheduler 创建保留策略调度器
+func NewRetentionScheduler(db *gorm.DB, redisManager *RedisManager, blobStore *BlobStore, cfg *config.RetentionConfig) *RetentionScheduler {
+	return &RetentionScheduler{
+		db:           db,
+		redisManager: redisManager,
+		blobStore:    blobStore,
+		cfg:          cfg,
+	}
+}
+
+// Run 启动时执行一次，之后按配置的间隔执行，直到ctx取消
+func (s *RetentionScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunOnce(ctx); err != nil && !errors.Is(err, ErrRetentionRunning) {
+			slog.WarnContext(ctx, "保留策略清理失败", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce 获取锁后执行一轮清理，其他实例持有锁时返回 ErrRetentionRunning
+// 各步骤的错误只记录日志，不影响后续步骤
+func (s *RetentionScheduler) RunOnce(ctx context.Context) (*RetentionResult, error) {
+	token, err := s.redisManager.AcquireLock(ctx, "retention", retentionLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("获取保留策略清理锁失败: %v", err)
+	}
+	if token == "" {
+		return nil, ErrRetentionRunning
+	}
+	defer s.redisManager.ReleaseLock(context.WithoutCancel(ctx), "retention", token)
+
+	if err := s.stampExpiry(ctx); err != nil {
+		slog.WarnContext(ctx, "设置任务过期时间失败", "error", err)
+	}
+	released, err := s.releaseConvertedInputs(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "释放已转换任务的上传文件失败", "error", err)
+	}
+	expired, err := s.expireTasks(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "清理过期任务失败", "error", err)
+	}
+	if released > 0 || expired > 0 {
+		slog.InfoContext(ctx, "保留策略清理完成", "released_inputs", released, "expired_tasks", expired)
+	}
+	return &RetentionResult{ReleasedInputs: released, ExpiredTasks: expired}, nil
+}
+
+// stampExpiry 为尚未设置过期时间的任务按状态设置过期时间
+// 过期时间在进入该状态时确定，之后修改配置只影响新进入该状态的任务
+func (s *RetentionScheduler) stampExpiry(ctx context.Context) error {
+	rules := []retentionRule{
+		{statuses: []model.TaskStatus{model.TaskStatusCompleted}, base: "updated_at", days: s.cfg.OutputDays},
+		{statuses: []model.TaskStatus{model.TaskStatusFailed, model.TaskStatusCanceled}, base: "updated_at", days: s.cfg.FailedInputDays},
+		{statuses: []model.TaskStatus{model.TaskStatusUploaded}, base: "created_at", days: s.cfg.UnconvertedInputDays},
+	}
+
+	db := s.db.WithContext(ctx)
+	for _, rule := range rules {
+		if rule.days <= 0 {
+			continue
+		}
+		// UpdateColumn 不修改 updated_at，保留期从进入该状态时开始计算
+		err := db.Model(&model.ConversionTask{}).
+			Where("status IN ? AND expires_at IS NULL", rule.statuses).
+			UpdateColumn("expires_at", gorm.Expr("DATE_ADD("+rule.base+", INTERVAL ? DAY)", rule.days)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseConvertedInputs 释放转换完成超过保留时长的任务的上传文件，任务和输出文件不受影响
+func (s *RetentionScheduler) releaseConvertedInputs(ctx context.Context) (int, error) {
+	if s.cfg.ConvertedInputHours <= 0 {
+		return 0, nil
+	}
+
+	db := s.db.WithContext(ctx)
+	cutoff := time.Now().Add(-time.Duration(s.cfg.ConvertedInputHours) * time.Hour)
+	var tasks []model.ConversionTask
+	if err := db.Select("id", "input_path").
+		Where("status = ? AND input_path <> '' AND updated_at < ?", model.TaskStatusCompleted, cutoff).
+		Limit(s.cfg.BatchSize).
+		Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, task := range tasks {
+		taskCtx := logger.WithTaskID(ctx, task.ID)
+		// 以状态和路径为条件，任务在此期间被重新排队时跳过
+		result := db.Model(&model.ConversionTask{}).
+			Where("id = ? AND status = ? AND input_path = ?", task.ID, model.TaskStatusCompleted, task.InputPath).
+			UpdateColumn("input_path", "")
+		if result.Error != nil {
+			slog.WarnContext(taskCtx, "清除任务输入路径失败", "error", result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := s.blobStore.Release(taskCtx, task.InputPath); err != nil {
+			slog.WarnContext(taskCtx, "释放上传文件失败", "path", task.InputPath, "error", err)
+		}
+		metrics.RetentionReleased.WithLabelValues("input").Inc()
+		released++
+	}
+	return released, nil
+}
+
+// expireTasks 释放已过期任务的全部文件，并将任务标记为 expired
+func (s *RetentionScheduler) expireTasks(ctx context.Context) (int, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	var tasks []model.ConversionTask
+	if err := db.Select("id", "status", "input_path", "output_path").
+		Where("status IN ? AND expires_at IS NOT NULL AND expires_at <= ?", []model.TaskStatus{
+			model.TaskStatusUploaded, model.TaskStatusCompleted, model.TaskStatusFailed, model.TaskStatusCanceled,
+		}, now).
+		Limit(s.cfg.BatchSize).
+		Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, task := range tasks {
+		taskCtx := logger.WithTaskID(ctx, task.ID)
+		// 先更新状态再释放文件，任务在此期间被提交转换或重新排队时跳过
+		result := db.Model(&model.ConversionTask{}).
+			Where("id = ? AND status = ? AND expires_at <= ?", task.ID, task.Status, now).
+			Updates(map[string]interface{}{
+				"status":      model.TaskStatusExpired,
+				"input_path":  "",
+				"output_path": "",
+				"updated_at":  time.Now(),
+			})
+		if result.Error != nil {
+			slog.WarnContext(taskCtx, "更新过期任务状态失败", "error", result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		for artifact, path := range map[string]string{"input": task.InputPath, "output": task.OutputPath} {
+			if path == "" {
+				continue
+			}
+			if err := s.blobStore.Release(taskCtx, path); err != nil {
+				slog.WarnContext(taskCtx, "释放过期任务文件失败", "path", path, "error", err)
+			}
+			metrics.RetentionReleased.WithLabelValues(artifact).Inc()
+		}
+		s.redisManager.SetTaskStatus(taskCtx, task.ID, string(model.TaskStatusExpired))
+		expired++
+	}
+	return expired, nil
+}
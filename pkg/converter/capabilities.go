@@ -0,0 +1,250 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutputFormat 输出格式及可用于该格式的编码器（按优先级排列）
+type OutputFormat struct {
+	Name        string   `json:"name"`
+	Extension   string   `json:"extension"`
+	ContentType string   `json:"content_type"` // 下载时的Content-Type
+	Muxer       string   `json:"muxer"`
+	Codec       string   `json:"codec"`    // ffprobe报告的音频编码名称
+	Lossless    bool     `json:"lossless"` // 无损格式不使用比特率参数
+	Encoders    []string `json:"encoders"`
+}
+
+// outputFormats 转换器能生成的输出格式
+var outputFormats = []OutputFormat{
+	{Name: "mp3", Extension: ".mp3", ContentType: "audio/mpeg", Muxer: "mp3", Codec: "mp3", Encoders: []string{"libmp3lame", "libshine"}},
+	{Name: "m4a", Extension: ".m4a", ContentType: "audio/mp4", Muxer: "ipod", Codec: "aac", Encoders: []string{"aac", "libfdk_aac"}},
+	{Name: "flac", Extension: ".flac", ContentType: "audio/flac", Muxer: "flac", Codec: "flac", Lossless: true, Encoders: []string{"flac"}},
+	{Name: "wav", Extension: ".wav", ContentType: "audio/wav", Muxer: "wav", Codec: "pcm_s16le", Lossless: true, Encoders: []string{"pcm_s16le"}},
+}
+
+// LookupOutputFormat 按名称查找输出格式
+func LookupOutputFormat(name string) (*OutputFormat, bool) {
+	for i := range outputFormats {
+		if outputFormats[i].Name == name {
+			return &outputFormats[i], true
+		}
+	}
+	return nil, false
+}
+
+// FormatForEncoder 查找编码器对应的输出格式
+func FormatForEncoder(encoder string) (*OutputFormat, bool) {
+	for i := range outputFormats {
+		if outputFormats[i].HasEncoder(encoder) {
+			return &outputFormats[i], true
+		}
+	}
+	return nil, false
+}
+
+// HasEncoder 编码器是否可用于该输出格式
+func (f *OutputFormat) HasEncoder(encoder string) bool {
+	for _, candidate := range f.Encoders {
+		if candidate == encoder {
+			return true
+		}
+	}
+	return false
+}
+
+// AudioBitrates 可选的音频比特率
+var AudioBitrates = []string{"64k", "96k", "128k", "160k", "192k", "256k", "320k"}
+
+// SampleRates 可选的音频采样率
+var SampleRates = []string{"22050", "32000", "44100", "48000"}
+
+// FormatSupport 当前节点对某个输出格式的支持情况
+type FormatSupport struct {
+	OutputFormat
+	Supported         bool     `json:"supported"`
+	AvailableEncoders []string `json:"available_encoders"`
+}
+
+// Capabilities 探测到的FFmpeg能力
+type Capabilities struct {
+	FFmpegVersion  string          `json:"ffmpeg_version"`
+	FFprobeVersion string          `json:"ffprobe_version"`
+	AudioEncoders  []string        `json:"audio_encoders"`
+	Muxers         map[string]bool `json:"-"`
+	Filters        map[string]bool `json:"-"`
+	DetectedAt     time.Time       `json:"detected_at"`
+
+	encoders map[string]bool
+}
+
+// HasEncoder 是否支持指定编码器
+func (c *Capabilities) HasEncoder(name string) bool {
+	return c.encoders[name]
+}
+
+// HasMuxer 是否支持指定封装格式
+func (c *Capabilities) HasMuxer(name string) bool {
+	return c.Muxers[name]
+}
+
+// HasFilter 是否支持指定滤镜
+func (c *Capabilities) HasFilter(name string) bool {
+	return c.Filters[name]
+}
+
+// Formats 各输出格式在当前节点的支持情况
+func (c *Capabilities) Formats() []FormatSupport {
+	formats := make([]FormatSupport, 0, len(outputFormats))
+	for _, format := range outputFormats {
+		support := FormatSupport{OutputFormat: format, AvailableEncoders: []string{}}
+		for _, encoder := range format.Encoders {
+			if c.HasEncoder(encoder) {
+				support.AvailableEncoders = append(support.AvailableEncoders, encoder)
+			}
+		}
+		support.Supported = c.HasMuxer(format.Muxer) && len(support.AvailableEncoders) > 0
+		formats = append(formats, support)
+	}
+	return formats
+}
+
+// Require 检查转换所需的编码器及其输出格式的封装格式是否可用
+func (c *Capabilities) Require(audioCodec string) error {
+	if !c.HasEncoder(audioCodec) {
+		return fmt.Errorf("ffmpeg不支持编码器 %s", audioCodec)
+	}
+	if format, ok := FormatForEncoder(audioCodec); ok && !c.HasMuxer(format.Muxer) {
+		return fmt.Errorf("ffmpeg不支持封装格式 %s", format.Muxer)
+	}
+	return nil
+}
+
+// DetectCapabilities 探测ffmpeg、ffprobe的版本及可用的编码器、封装格式和滤镜
+// 探测成功后结果会保存在转换器中，可通过 Capabilities 获取
+func (fc *FFmpegConverter) DetectCapabilities(ctx context.Context) (*Capabilities, error) {
+	caps := &Capabilities{DetectedAt: time.Now()}
+
+	output, err := exec.CommandContext(ctx, fc.BinaryPath, "-hide_banner", "-version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("执行ffmpeg失败: %v", err)
+	}
+	caps.FFmpegVersion = firstLine(output)
+
+	output, err = exec.CommandContext(ctx, fc.ProbePath, "-hide_banner", "-version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("执行ffprobe失败: %v", err)
+	}
+	caps.FFprobeVersion = firstLine(output)
+
+	output, err = exec.CommandContext(ctx, fc.BinaryPath, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("获取ffmpeg编码器列表失败: %v", err)
+	}
+	caps.encoders, caps.AudioEncoders = parseEncoders(output)
+
+	output, err = exec.CommandContext(ctx, fc.BinaryPath, "-hide_banner", "-muxers").Output()
+	if err != nil {
+		return nil, fmt.Errorf("获取ffmpeg封装格式列表失败: %v", err)
+	}
+	caps.Muxers = parseMuxers(output)
+
+	output, err = exec.CommandContext(ctx, fc.BinaryPath, "-hide_banner", "-filters").Output()
+	if err != nil {
+		return nil, fmt.Errorf("获取ffmpeg滤镜列表失败: %v", err)
+	}
+	caps.Filters = parseFilters(output)
+
+	fc.capsMu.Lock()
+	fc.caps = caps
+	fc.capsMu.Unlock()
+
+	return caps, nil
+}
+
+// Capabilities 获取最近一次探测到的能力，尚未探测时返回nil
+func (fc *FFmpegConverter) Capabilities() *Capabilities {
+	fc.capsMu.RLock()
+	defer fc.capsMu.RUnlock()
+	return fc.caps
+}
+
+// firstLine 输出的第一行
+func firstLine(output []byte) string {
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+// parseEncoders 解析 ffmpeg -encoders 的输出
+// 列表以 "------" 分隔行开始，每行形如 " A....D libmp3lame  libmp3lame MP3 (MPEG audio layer 3)"
+func parseEncoders(output []byte) (map[string]bool, []string) {
+	encoders := make(map[string]bool)
+	var audio []string
+
+	started := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if !started {
+			started = len(fields) > 0 && strings.HasPrefix(fields[0], "------")
+			continue
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		encoders[fields[1]] = true
+		if strings.HasPrefix(fields[0], "A") {
+			audio = append(audio, fields[1])
+		}
+	}
+
+	sort.Strings(audio)
+	return encoders, audio
+}
+
+// parseMuxers 解析 ffmpeg -muxers 的输出
+// 列表以 "--" 分隔行开始，每行形如 "  E mp3   MP3 (MPEG audio layer 3)"
+func parseMuxers(output []byte) map[string]bool {
+	muxers := make(map[string]bool)
+
+	started := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if !started {
+			started = len(fields) == 1 && fields[0] == "--"
+			continue
+		}
+		if len(fields) < 2 || !strings.Contains(fields[0], "E") {
+			continue
+		}
+		for _, name := range strings.Split(fields[1], ",") {
+			muxers[name] = true
+		}
+	}
+
+	return muxers
+}
+
+// parseFilters 解析 ffmpeg -filters 的输出
+// 每行形如 " TSC acompressor   A->A   Audio compressor."，以第三列的输入输出类型识别
+func parseFilters(output []byte) map[string]bool {
+	filters := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && strings.Contains(fields[2], "->") {
+			filters[fields[1]] = true
+		}
+	}
+
+	return filters
+}
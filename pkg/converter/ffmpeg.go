@@ -4,23 +4,34 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"video-converter/internal/config"
+	"video-converter/internal/metrics"
+	"video-converter/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // FFmpegConverter FFmpeg转换器
 type FFmpegConverter struct {
 	BinaryPath   string
+	ProbePath    string
 	AudioCodec   string
 	AudioBitrate string
 	SampleRate   string
+
+	capsMu sync.RWMutex
+	caps   *Capabilities
 }
 
 // ConversionOptions 转换选项
@@ -30,6 +41,9 @@ type ConversionOptions struct {
 	AudioCodec   string
 	AudioBitrate string
 	SampleRate   string
+	TrimStart    float64                // 截取起始时间（秒）
+	TrimEnd      float64                // 截取结束时间（秒），0表示到结尾
+	Normalize    bool                   // 使用loudnorm做响度标准化
 	OnProgress   func(progress float64) // 进度回调函数
 }
 
@@ -44,6 +58,7 @@ type VideoInfo struct {
 func NewFFmpegConverter(cfg *config.FFmpegConfig) *FFmpegConverter {
 	return &FFmpegConverter{
 		BinaryPath:   cfg.BinaryPath,
+		ProbePath:    cfg.ProbePath,
 		AudioCodec:   cfg.AudioCodec,
 		AudioBitrate: cfg.AudioBitrate,
 		SampleRate:   cfg.SampleRate,
@@ -52,15 +67,25 @@ func NewFFmpegConverter(cfg *config.FFmpegConfig) *FFmpegConverter {
 
 // GetVideoInfo 获取视频信息
 func (fc *FFmpegConverter) GetVideoInfo(inputPath string) (*VideoInfo, error) {
+	return fc.GetVideoInfoContext(context.Background(), inputPath)
+}
+
+// GetVideoInfoContext 获取视频信息，ctx用于取消和链路追踪
+func (fc *FFmpegConverter) GetVideoInfoContext(ctx context.Context, inputPath string) (*VideoInfo, error) {
+	ctx, span := tracing.Start(ctx, "ffprobe", trace.WithAttributes(attribute.String("file.path", inputPath)))
+	defer span.End()
+
 	// 使用ffprobe获取视频信息
-	cmd := exec.Command("ffprobe",
+	cmd := exec.CommandContext(ctx, fc.ProbePath,
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		inputPath)
 
 	output, err := cmd.Output()
+	metrics.ObserveProcessExit("ffprobe", err)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return nil, fmt.Errorf("ffprobe执行失败: %v", err)
 	}
 
@@ -88,8 +113,8 @@ func (fc *FFmpegConverter) GetVideoInfo(inputPath string) (*VideoInfo, error) {
 	}, nil
 }
 
-// ConvertToMP3 转换视频为MP3
-func (fc *FFmpegConverter) ConvertToMP3(ctx context.Context, options *ConversionOptions) error {
+// Convert 提取音频并转换为编码器对应的输出格式
+func (fc *FFmpegConverter) Convert(ctx context.Context, options *ConversionOptions) error {
 	// 确保输出目录存在
 	outputDir := filepath.Dir(options.OutputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -112,17 +137,63 @@ func (fc *FFmpegConverter) ConvertToMP3(ctx context.Context, options *Conversion
 		sampleRate = fc.SampleRate
 	}
 
+	// 探测输入文件，获取总时长用于计算进度
+	var totalDuration float64
+	probe, err := fc.Probe(ctx, options.InputPath)
+	if err != nil {
+		slog.WarnContext(ctx, "探测输入文件失败", "error", err)
+	} else {
+		totalDuration = trimmedDuration(probe.Duration, options.TrimStart, options.TrimEnd)
+	}
+
 	// 构建FFmpeg命令
-	args := []string{
-		"-i", options.InputPath, // 输入文件
-		"-vn",                 // 不包含视频
-		"-acodec", audioCodec, // 音频编码器
-		"-ab", audioBitrate, // 音频比特率
-		"-ar", sampleRate, // 音频采样率
+	// 输入已经是目标格式且参数不高于目标时直接复制音频流，避免再做一次有损编码
+	// 截取和响度标准化需要解码，不能复制
+	trimmed := options.TrimStart > 0 || options.TrimEnd > 0
+	copyAudio := probe != nil && !trimmed && !options.Normalize &&
+		canCopyAudio(probe, audioCodec, audioBitrate, sampleRate)
+
+	var args []string
+	if options.TrimStart > 0 {
+		// 放在输入之前按关键帧快速定位，输出时间戳从0开始
+		args = append(args, "-ss", formatSeconds(options.TrimStart))
+	}
+	args = append(args, "-i", options.InputPath) // 输入文件
+	if options.TrimEnd > 0 {
+		args = append(args, "-t", formatSeconds(options.TrimEnd-options.TrimStart))
+	}
+	if copyAudio {
+		args = append(args,
+			"-map", "0:a:0", // 只保留第一个音频流（去掉封面等）
+			"-c:a", "copy", // 直接复制音频流
+		)
+	} else {
+		args = append(args,
+			"-vn",                 // 不包含视频
+			"-acodec", audioCodec, // 音频编码器
+			"-ar", sampleRate, // 音频采样率
+		)
+		if format, ok := FormatForEncoder(audioCodec); !ok || !format.Lossless {
+			args = append(args, "-ab", audioBitrate) // 音频比特率
+		}
+		if options.Normalize {
+			args = append(args, "-af", "loudnorm") // EBU R128响度标准化
+		}
+	}
+	args = append(args,
 		"-y",                  // 覆盖输出文件
 		"-progress", "pipe:1", // 输出进度到标准输出
 		options.OutputPath, // 输出文件
-	}
+	)
+
+	ctx, span := tracing.Start(ctx, "ffmpeg", trace.WithAttributes(
+		attribute.String("ffmpeg.audio_codec", audioCodec),
+		attribute.String("ffmpeg.audio_bitrate", audioBitrate),
+		attribute.String("ffmpeg.sample_rate", sampleRate),
+		attribute.Bool("ffmpeg.audio_copy", copyAudio),
+		attribute.Bool("ffmpeg.normalize", options.Normalize),
+	))
+	defer span.End()
 
 	cmd := exec.CommandContext(ctx, fc.BinaryPath, args...)
 
@@ -139,13 +210,11 @@ func (fc *FFmpegConverter) ConvertToMP3(ctx context.Context, options *Conversion
 
 	// 启动命令
 	if err := cmd.Start(); err != nil {
+		metrics.ObserveProcessExit("ffmpeg", err)
+		tracing.RecordError(span, err)
 		return fmt.Errorf("启动FFmpeg失败: %v", err)
 	}
 
-	// 获取视频总时长用于计算进度
-	videoInfo, _ := fc.GetVideoInfo(options.InputPath)
-	totalDuration := videoInfo.Duration
-
 	// 读取进度信息
 	go func() {
 		scanner := bufio.NewScanner(stdout)
@@ -179,13 +248,15 @@ func (fc *FFmpegConverter) ConvertToMP3(ctx context.Context, options *Conversion
 	go func() {
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
-			// 这里可以记录错误日志
-			fmt.Printf("FFmpeg stderr: %s\n", scanner.Text())
+			slog.DebugContext(ctx, "ffmpeg输出", "line", scanner.Text())
 		}
 	}()
 
 	// 等待命令完成
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	metrics.ObserveProcessExit("ffmpeg", err)
+	if err != nil {
+		tracing.RecordError(span, err)
 		return fmt.Errorf("FFmpeg转换失败: %v", err)
 	}
 
@@ -197,6 +268,72 @@ func (fc *FFmpegConverter) ConvertToMP3(ctx context.Context, options *Conversion
 	return nil
 }
 
+// trimmedDuration 截取后的时长，用于计算进度
+func trimmedDuration(duration, trimStart, trimEnd float64) float64 {
+	if trimEnd > 0 && trimEnd < duration {
+		duration = trimEnd
+	}
+	if duration -= trimStart; duration < 0 {
+		return 0
+	}
+	return duration
+}
+
+// formatSeconds 格式化为ffmpeg的时间参数，保留毫秒
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// canCopyAudio 输入的第一个音频流已是目标编码、比特率不高于目标且采样率一致时可以直接复制
+// 比特率更高的输入仍然重新编码，保证输出大小符合预期；无损格式不比较比特率
+func canCopyAudio(probe *ProbeResult, audioCodec, audioBitrate, sampleRate string) bool {
+	stream := probe.FirstAudioStream()
+	if stream == nil || !producesCodec(audioCodec, stream.CodecName) {
+		return false
+	}
+	if stream.SampleRate != sampleRate {
+		return false
+	}
+	if format, ok := FormatForEncoder(audioCodec); ok && format.Lossless {
+		return true
+	}
+
+	inputBitrate, err := strconv.ParseInt(stream.BitRate, 10, 64)
+	if err != nil {
+		return false
+	}
+	targetBitrate, err := parseBitrate(audioBitrate)
+	if err != nil {
+		return false
+	}
+	return inputBitrate <= targetBitrate
+}
+
+// producesCodec 编码器输出的是否为指定编码，如 libmp3lame 输出 mp3
+func producesCodec(encoder, codecName string) bool {
+	format, ok := FormatForEncoder(encoder)
+	return ok && format.Codec == codecName
+}
+
+// parseBitrate 解析 "192k" 形式的比特率为bps
+func parseBitrate(bitrate string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(bitrate, "k"):
+		multiplier = 1000
+		bitrate = strings.TrimSuffix(bitrate, "k")
+	case strings.HasSuffix(bitrate, "M"):
+		multiplier = 1000 * 1000
+		bitrate = strings.TrimSuffix(bitrate, "M")
+	}
+
+	value, err := strconv.ParseInt(bitrate, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的比特率: %s", bitrate)
+	}
+	return value * multiplier, nil
+}
+
 // ValidateInput 验证输入文件
 func (fc *FFmpegConverter) ValidateInput(inputPath string) error {
 	// 检查文件是否存在
@@ -206,7 +343,11 @@ func (fc *FFmpegConverter) ValidateInput(inputPath string) error {
 
 	// 检查是否为支持的格式
 	ext := strings.ToLower(filepath.Ext(inputPath))
-	supportedFormats := []string{".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm", ".mkv", ".m4v"}
+	supportedFormats := []string{
+		".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm", ".mkv", ".m4v",
+		".3gp", ".asf", ".rm", ".rmvb", ".ts", ".mts", ".m2ts", ".mpg", ".mpeg", ".vob",
+		".wav", ".flac", ".m4a", ".ogg", ".oga", ".opus", ".amr", ".mp3", ".aac", ".wma", ".caf",
+	}
 
 	for _, format := range supportedFormats {
 		if ext == format {
@@ -217,10 +358,11 @@ func (fc *FFmpegConverter) ValidateInput(inputPath string) error {
 	return fmt.Errorf("不支持的文件格式: %s", ext)
 }
 
-// GenerateOutputPath 生成输出文件路径
-func (fc *FFmpegConverter) GenerateOutputPath(inputPath, outputDir string) string {
-	baseName := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+// GenerateOutputPath 生成任务的输出文件路径，extension为输出格式的扩展名（如 ".mp3"）
+// 文件名由任务ID和时间戳组成：共享同一输入的任务输出互不覆盖，重新排队的任务也不会覆盖
+// 已被其他任务复用的旧输出
+func (fc *FFmpegConverter) GenerateOutputPath(taskID, outputDir, extension string) string {
 	timestamp := time.Now().Format("20060102_150405")
-	fileName := fmt.Sprintf("%s_%s.mp3", baseName, timestamp)
+	fileName := fmt.Sprintf("%s_%s%s", taskID, timestamp, extension)
 	return filepath.Join(outputDir, fileName)
 }
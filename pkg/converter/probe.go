@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"video-converter/internal/metrics"
+	"video-converter/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MediaStream 媒体流信息
+type MediaStream struct {
+	Index      int    `json:"index"`
+	CodecType  string `json:"codec_type"` // audio、video、subtitle等
+	CodecName  string `json:"codec_name"`
+	BitRate    string `json:"bit_rate,omitempty"`    // 比特率（bps），部分格式没有
+	SampleRate string `json:"sample_rate,omitempty"` // 音频采样率
+}
+
+// ProbeResult ffprobe解析出的媒体信息
+type ProbeResult struct {
+	FormatName string        `json:"format_name"` // 如 "mov,mp4,m4a,3gp,3g2,mj2"
+	Duration   float64       `json:"duration"`    // 时长（秒），无法获取时为0
+	Streams    []MediaStream `json:"streams"`
+}
+
+// AudioStreams 音频流数量
+func (pr *ProbeResult) AudioStreams() int {
+	count := 0
+	for _, stream := range pr.Streams {
+		if stream.CodecType == "audio" {
+			count++
+		}
+	}
+	return count
+}
+
+// FirstAudioStream 第一个音频流，没有音频流时返回nil
+func (pr *ProbeResult) FirstAudioStream() *MediaStream {
+	for i := range pr.Streams {
+		if pr.Streams[i].CodecType == "audio" {
+			return &pr.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Probe 使用ffprobe完整解析文件的封装格式和媒体流，文件损坏或不是媒体文件时返回错误
+func (fc *FFmpegConverter) Probe(ctx context.Context, inputPath string) (*ProbeResult, error) {
+	ctx, span := tracing.Start(ctx, "ffprobe", trace.WithAttributes(attribute.String("file.path", inputPath)))
+	defer span.End()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, fc.ProbePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	metrics.ObserveProcessExit("ffprobe", err)
+	if err != nil {
+		tracing.RecordError(span, err)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ffprobe无法解析文件: %s", firstLine([]byte(msg)))
+		}
+		return nil, fmt.Errorf("ffprobe执行失败: %v", err)
+	}
+
+	var parsed struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+		} `json:"format"`
+		Streams []MediaStream `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("解析ffprobe输出失败: %v", err)
+	}
+
+	result := &ProbeResult{
+		FormatName: parsed.Format.FormatName,
+		Streams:    parsed.Streams,
+	}
+	if duration, err := strconv.ParseFloat(parsed.Format.Duration, 64); err == nil {
+		result.Duration = duration
+	}
+
+	return result, nil
+}
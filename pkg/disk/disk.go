@@ -0,0 +1,16 @@
+package disk
+
+// Usage 磁盘空间使用情况（字节）
+type Usage struct {
+	Total     uint64 `json:"total"`
+	Free      uint64 `json:"free"`
+	Available uint64 `json:"available"` // 非特权进程可用的空间
+}
+
+// UsedPercent 已用空间百分比
+func (u Usage) UsedPercent() float64 {
+	if u.Total == 0 {
+		return 0
+	}
+	return float64(u.Total-u.Free) / float64(u.Total) * 100
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package disk
+
+import "syscall"
+
+// GetUsage 获取path所在文件系统的空间使用情况
+func GetUsage(path string) (Usage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Usage{}, err
+	}
+
+	blockSize := uint64(stat.Bsize)
+	return Usage{
+		Total:     uint64(stat.Blocks) * blockSize,
+		Free:      uint64(stat.Bfree) * blockSize,
+		Available: uint64(stat.Bavail) * blockSize,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package disk
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Level 剩余空间水位
+type Level int
+
+const (
+	LevelOK       Level = iota // 空间充足
+	LevelLow                   // 低于低水位：拒绝新的上传和URL任务
+	LevelCritical              // 低于临界水位：worker暂停领取任务
+)
+
+// String 水位名称
+func (l Level) String() string {
+	switch l {
+	case LevelLow:
+		return "low"
+	case LevelCritical:
+		return "critical"
+	default:
+		return "ok"
+	}
+}
+
+// Watermark 目录的水位配置（字节）
+type Watermark struct {
+	Name     string // 目录名称，如 upload、output、temp
+	Path     string
+	Low      uint64
+	Critical uint64
+}
+
+// DirStatus 目录最近一次检查的结果
+type DirStatus struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Level     string    `json:"level"`
+	Available uint64    `json:"available_bytes"`
+	Low       uint64    `json:"low_watermark_bytes"`
+	Critical  uint64    `json:"critical_watermark_bytes"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Guard 定期检查目录剩余空间，供上传准入和worker领取任务时判断
+// 每次请求都statfs开销不大，但按间隔缓存结果可以避免水位附近的频繁抖动
+type Guard struct {
+	watermarks []Watermark
+
+	mu       sync.RWMutex
+	level    Level
+	statuses []DirStatus
+}
+
+// NewGuard 创建磁盘空间守卫并立即检查一次
+func NewGuard(watermarks []Watermark) *Guard {
+	g := &Guard{watermarks: watermarks}
+	g.Check()
+	return g
+}
+
+// Check 检查所有目录的剩余空间并更新水位
+// 无法获取空间的目录不影响水位，只记录错误，由健康检查的目录检查负责报告
+func (g *Guard) Check() Level {
+	level := LevelOK
+	statuses := make([]DirStatus, len(g.watermarks))
+	for i, wm := range g.watermarks {
+		status := DirStatus{
+			Name:      wm.Name,
+			Path:      wm.Path,
+			Level:     LevelOK.String(),
+			Low:       wm.Low,
+			Critical:  wm.Critical,
+			CheckedAt: time.Now(),
+		}
+
+		usage, err := GetUsage(wm.Path)
+		if err != nil {
+			status.Error = err.Error()
+			statuses[i] = status
+			continue
+		}
+		status.Available = usage.Available
+
+		dirLevel := LevelOK
+		switch {
+		case usage.Available < wm.Critical:
+			dirLevel = LevelCritical
+		case usage.Available < wm.Low:
+			dirLevel = LevelLow
+		}
+		status.Level = dirLevel.String()
+		statuses[i] = status
+		level = max(level, dirLevel)
+	}
+
+	g.mu.Lock()
+	previous := g.level
+	g.level = level
+	g.statuses = statuses
+	g.mu.Unlock()
+
+	if level != previous {
+		if level > previous {
+			slog.Warn("磁盘剩余空间低于水位", "level", level.String(), "previous", previous.String())
+		} else {
+			slog.Info("磁盘剩余空间已恢复", "level", level.String(), "previous", previous.String())
+		}
+	}
+	return level
+}
+
+// Run 按固定间隔检查，直到ctx取消
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.Check()
+		}
+	}
+}
+
+// Level 最近一次检查时所有目录中最差的水位，未启用（nil）时总是返回 LevelOK
+func (g *Guard) Level() Level {
+	if g == nil {
+		return LevelOK
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.level
+}
+
+// Statuses 最近一次检查时各目录的状态
+func (g *Guard) Statuses() []DirStatus {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]DirStatus(nil), g.statuses...)
+}
@@ -0,0 +1,192 @@
+package filemanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ArchiveKind 压缩包类型
+type ArchiveKind string
+
+const (
+	ArchiveZip   ArchiveKind = "zip"
+	ArchiveTar   ArchiveKind = "tar"
+	ArchiveTarGz ArchiveKind = "tar.gz"
+)
+
+var (
+	// ErrUnsafeArchivePath 条目路径为绝对路径或试图跳出压缩包目录（zip slip）
+	ErrUnsafeArchivePath = errors.New("压缩包条目路径不安全")
+	// ErrInvalidArchive 压缩包损坏或格式不正确
+	ErrInvalidArchive = errors.New("压缩包格式错误")
+)
+
+// ArchiveEntry 压缩包中的普通文件条目
+type ArchiveEntry struct {
+	Path string // 清理后的相对路径
+	Size int64  // 条目声明的大小，不可信，写入时仍需限制
+}
+
+// Name 条目的文件名
+func (e ArchiveEntry) Name() string {
+	return path.Base(e.Path)
+}
+
+// DetectArchive 根据文件名判断是否为支持的压缩包
+func DetectArchive(filename string) (ArchiveKind, bool) {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, true
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar, true
+	}
+	return "", false
+}
+
+// CleanArchivePath 检查并清理条目路径，拒绝绝对路径和跳出压缩包目录的路径
+// 条目内容只会以生成的文件名保存，这里的检查是为了拒绝恶意构造的压缩包
+func CleanArchivePath(name string) (string, error) {
+	// Windows下创建的zip可能使用反斜杠分隔
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+	}
+	return cleaned, nil
+}
+
+// isIgnoredArchivePath 系统生成的隐藏文件（.DS_Store、__MACOSX等）不作为上传内容
+func isIgnoredArchivePath(cleaned string) bool {
+	for _, part := range strings.Split(cleaned, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// WalkZip 依次读取zip中的普通文件，目录、链接和隐藏文件跳过
+// fn返回错误时停止遍历并返回该错误
+func WalkZip(archivePath string, fn func(entry ArchiveEntry, r io.Reader) error) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		cleaned, err := CleanArchivePath(file.Name)
+		if err != nil {
+			return err
+		}
+		if isIgnoredArchivePath(cleaned) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		err = fn(ArchiveEntry{Path: cleaned, Size: int64(file.UncompressedSize64)}, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkTar 以流的方式依次读取tar（可选gzip压缩）中的普通文件，目录、链接和隐藏文件跳过
+// fn返回错误时停止遍历并返回该错误；读取上传数据失败返回 ErrUploadRead，头部损坏返回 ErrInvalidArchive
+func WalkTar(src io.Reader, gzipped bool, fn func(entry ArchiveEntry, r io.Reader) error) error {
+	upload := &uploadReader{r: src}
+	src = upload
+	if gzipped {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return tarError(upload, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	reader := tar.NewReader(src)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return tarError(upload, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		cleaned, err := CleanArchivePath(header.Name)
+		if err != nil {
+			return err
+		}
+		if isIgnoredArchivePath(cleaned) {
+			continue
+		}
+
+		if err := fn(ArchiveEntry{Path: cleaned, Size: header.Size}, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// tarError 区分连接中断等读取失败和压缩包本身损坏
+func tarError(upload *uploadReader, err error) error {
+	if upload.err != nil {
+		return fmt.Errorf("%w: %w", ErrUploadRead, upload.err)
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+}
+
+// SaveTempStream 将数据流写入临时目录，用于需要随机读取的压缩包（如zip）
+// maxSize大于0时，超出限制会删除已写入的部分并返回 ErrFileTooLarge
+func (fm *FileManager) SaveTempStream(pattern string, src io.Reader, maxSize int64) (string, error) {
+	dst, err := os.CreateTemp(fm.TempDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer dst.Close()
+
+	reader := &uploadReader{r: src}
+	if maxSize > 0 {
+		reader.r = io.LimitReader(src, maxSize+1)
+	}
+
+	written, err := io.Copy(dst, reader)
+	if err != nil {
+		os.Remove(dst.Name())
+		if reader.err != nil {
+			return "", fmt.Errorf("%w: %w", ErrUploadRead, reader.err)
+		}
+		return "", fmt.Errorf("保存临时文件失败: %w", err)
+	}
+	if maxSize > 0 && written > maxSize {
+		os.Remove(dst.Name())
+		return "", ErrFileTooLarge
+	}
+	return dst.Name(), nil
+}
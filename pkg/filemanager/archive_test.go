@@ -0,0 +1,209 @@
+package filemanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCleanArchivePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "a.mp4", want: "a.mp4"},
+		{name: "dir/sub/a.mp4", want: "dir/sub/a.mp4"},
+		{name: "./dir//a.mp4", want: "dir/a.mp4"},
+		{name: "dir/../a.mp4", want: "a.mp4"},
+		{name: `dir\a.mp4`, want: "dir/a.mp4"},
+		{name: "", wantErr: true},
+		{name: "/etc/passwd", wantErr: true},
+		{name: `\windows\a.mp4`, wantErr: true},
+		{name: "C:/a.mp4", wantErr: true},
+		{name: `C:\a.mp4`, wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "../a.mp4", wantErr: true},
+		{name: "dir/../../a.mp4", wantErr: true},
+		{name: `..\..\a.mp4`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CleanArchivePath(tt.name)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsafeArchivePath) {
+					t.Fatalf("CleanArchivePath(%q) = %q, %v，应返回 ErrUnsafeArchivePath", tt.name, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("CleanArchivePath(%q) = %q, %v，应为 %q", tt.name, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestZip 创建包含指定条目的zip，以 / 结尾的条目为目录
+func writeTestZip(t *testing.T, entries []string) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for _, name := range entries {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("content of " + name))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestWalkZip(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []string
+		wantPaths []string
+		wantErr   error
+	}{
+		{
+			name:      "跳过目录和隐藏文件",
+			entries:   []string{"a.mp4", "dir/", "dir/b.mp3", ".DS_Store", "__MACOSX/._a.mp4", "dir/.hidden.mp4"},
+			wantPaths: []string{"a.mp4", "dir/b.mp3"},
+		},
+		{
+			name:    "上级目录",
+			entries: []string{"a.mp4", "../evil.mp4"},
+			wantErr: ErrUnsafeArchivePath,
+		},
+		{
+			name:    "绝对路径",
+			entries: []string{"/tmp/evil.mp4"},
+			wantErr: ErrUnsafeArchivePath,
+		},
+		{
+			name:    "反斜杠上级目录",
+			entries: []string{`dir\..\..\evil.mp4`},
+			wantErr: ErrUnsafeArchivePath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archivePath := writeTestZip(t, tt.entries)
+
+			var paths []string
+			err := WalkZip(archivePath, func(entry ArchiveEntry, r io.Reader) error {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				if string(data) != "content of "+entry.Path {
+					t.Errorf("条目 %s 的内容为 %q", entry.Path, data)
+				}
+				paths = append(paths, entry.Path)
+				return nil
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("WalkZip 错误 = %v，应为 %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WalkZip 失败: %v", err)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("WalkZip 读取的条目 = %v，应为 %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestWalkZipInvalidArchive(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "broken.zip")
+	os.WriteFile(archivePath, []byte("not a zip file"), 0644)
+
+	err := WalkZip(archivePath, func(ArchiveEntry, io.Reader) error { return nil })
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("WalkZip 错误 = %v，应为 ErrInvalidArchive", err)
+	}
+}
+
+// buildTestTar 创建包含指定普通文件的tar
+func buildTestTar(t *testing.T, names ...string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, name := range names {
+		content := []byte("content of " + name)
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWalkTarErrors(t *testing.T) {
+	valid := buildTestTar(t, "a.mp4")
+	corrupt := append([]byte(nil), valid...)
+	// 破坏头部校验和
+	copy(corrupt[148:156], "xxxxxxx\x00")
+
+	tests := []struct {
+		name    string
+		src     io.Reader
+		gzipped bool
+		wantErr error
+	}{
+		{name: "正常", src: bytes.NewReader(valid)},
+		{name: "头部损坏", src: bytes.NewReader(corrupt), wantErr: ErrInvalidArchive},
+		{name: "不是gzip", src: bytes.NewReader(valid), gzipped: true, wantErr: ErrInvalidArchive},
+		{name: "读取上传数据失败", src: iotest.ErrReader(errors.New("connection reset")), wantErr: ErrUploadRead},
+		{name: "上级目录", src: bytes.NewReader(buildTestTar(t, "../evil.mp4")), wantErr: ErrUnsafeArchivePath},
+		{name: "绝对路径", src: bytes.NewReader(buildTestTar(t, "/tmp/evil.mp4")), wantErr: ErrUnsafeArchivePath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WalkTar(tt.src, tt.gzipped, func(entry ArchiveEntry, r io.Reader) error {
+				_, err := io.Copy(io.Discard, r)
+				return err
+			})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("WalkTar 失败: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WalkTar 错误 = %v，应为 %v", err, tt.wantErr)
+			}
+			if tt.wantErr == ErrInvalidArchive && errors.Is(err, ErrUploadRead) {
+				t.Errorf("压缩包损坏不应报告为读取上传数据失败: %v", err)
+			}
+		})
+	}
+}
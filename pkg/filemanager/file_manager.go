@@ -2,8 +2,11 @@ package filemanager
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"os"
 	"path/filepath"
@@ -13,6 +16,13 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrFileTooLarge 上传的数据超过大小限制
+	ErrFileTooLarge = errors.New("文件大小超过限制")
+	// ErrUploadRead 读取客户端上传的数据失败（连接中断、请求体过大等）
+	ErrUploadRead = errors.New("读取上传数据失败")
+)
+
 // FileManager 文件管理器
 type FileManager struct {
 	UploadDir string // 上传目录
@@ -30,6 +40,7 @@ type FileInfo struct {
 	MimeType     string    `json:"mime_type"`
 	Extension    string    `json:"extension"`
 	MD5Hash      string    `json:"md5_hash"`
+	SHA256Hash   string    `json:"sha256_hash"` // 用于内容去重
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -55,12 +66,17 @@ func (fm *FileManager) SaveUploadedFile(fileHeader *multipart.FileHeader) (*File
 	}
 	defer src.Close()
 
+	return fm.SaveUploadStream(fileHeader.Filename, src, 0)
+}
+
+// SaveUploadStream 将上传的数据流直接写入上传目录，边写边计算MD5和SHA-256
+// maxSize大于0时，超出限制会中止写入、删除已写入的部分并返回 ErrFileTooLarge
+func (fm *FileManager) SaveUploadStream(filename string, src io.Reader, maxSize int64) (*FileInfo, error) {
 	// 生成文件信息
 	fileInfo := &FileInfo{
 		ID:           uuid.New().String(),
-		OriginalName: fileHeader.Filename,
-		Size:         fileHeader.Size,
-		Extension:    strings.ToLower(filepath.Ext(fileHeader.Filename)),
+		OriginalName: filename,
+		Extension:    strings.ToLower(filepath.Ext(filename)),
 		CreatedAt:    time.Now(),
 	}
 
@@ -75,23 +91,50 @@ func (fm *FileManager) SaveUploadedFile(fileHeader *multipart.FileHeader) (*File
 	}
 	defer dst.Close()
 
-	// 创建MD5哈希计算器
-	hash := md5.New()
+	// 多读一个字节用于判断是否超出限制
+	reader := &uploadReader{r: src}
+	if maxSize > 0 {
+		reader.r = io.LimitReader(src, maxSize+1)
+	}
 
 	// 复制文件内容并计算哈希
-	_, err = io.Copy(dst, io.TeeReader(src, hash))
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	written, err := io.Copy(dst, io.TeeReader(reader, io.MultiWriter(md5Hash, sha256Hash)))
 	if err != nil {
 		// 如果复制失败，删除已创建的文件
 		os.Remove(fileInfo.FilePath)
-		return nil, fmt.Errorf("保存文件失败: %v", err)
+		if reader.err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUploadRead, reader.err)
+		}
+		return nil, fmt.Errorf("保存文件失败: %w", err)
+	}
+	if maxSize > 0 && written > maxSize {
+		os.Remove(fileInfo.FilePath)
+		return nil, ErrFileTooLarge
 	}
 
-	// 设置MD5哈希
-	fileInfo.MD5Hash = fmt.Sprintf("%x", hash.Sum(nil))
+	// 设置大小和哈希
+	fileInfo.Size = written
+	fileInfo.MD5Hash = fmt.Sprintf("%x", md5Hash.Sum(nil))
+	fileInfo.SHA256Hash = fmt.Sprintf("%x", sha256Hash.Sum(nil))
 
 	return fileInfo, nil
 }
 
+// uploadReader 记录读取上传数据时的错误，用于区分客户端中断与磁盘写入失败
+type uploadReader struct {
+	r   io.Reader
+	err error
+}
+
+func (ur *uploadReader) Read(p []byte) (int, error) {
+	n, err := ur.r.Read(p)
+	if err != nil && err != io.EOF {
+		ur.err = err
+	}
+	return n, err
+}
+
 // MoveToTemp 将文件移动到临时目录
 func (fm *FileManager) MoveToTemp(filePath string) (string, error) {
 	// 生成临时文件路径
@@ -150,6 +193,22 @@ func (fm *FileManager) FileExists(filePath string) bool {
 	return !os.IsNotExist(err)
 }
 
+// HashFile 计算文件内容的SHA-256和大小
+func HashFile(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), size, nil
+}
+
 // GetFileSize 获取文件大小
 func (fm *FileManager) GetFileSize(filePath string) (int64, error) {
 	stat, err := os.Stat(filePath)
@@ -176,9 +235,9 @@ func (fm *FileManager) CleanupExpiredFiles(directory string, expiry time.Duratio
 		// 删除过期文件
 		if info.ModTime().Before(cutoff) {
 			if err := os.Remove(path); err != nil {
-				fmt.Printf("删除过期文件失败 %s: %v\n", path, err)
+				slog.Warn("删除过期文件失败", "path", path, "error", err)
 			} else {
-				fmt.Printf("已删除过期文件: %s\n", path)
+				slog.Info("已删除过期文件", "path", path)
 			}
 		}
 
@@ -255,7 +314,7 @@ func (fm *FileManager) ensureDirectories() {
 
 	for _, dir := range directories {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			fmt.Printf("创建目录失败 %s: %v\n", dir, err)
+			slog.Error("创建目录失败", "dir", dir, "error", err)
 		}
 	}
 }
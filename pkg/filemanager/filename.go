@@ -0,0 +1,186 @@
+package filemanager
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+// maxFilenameBytes 文件名的最大字节数，多数文件系统限制为255字节，留出余量
+const maxFilenameBytes = 200
+
+var (
+	// 下载服务返回的头不一定符合规范，无法按标准解析时用正则兜底
+	extFilenameRegex   = regexp.MustCompile(`(?i)filename\*\s*=\s*([^;]+)`)
+	plainFilenameRegex = regexp.MustCompile(`(?i)filename\s*=\s*(?:"([^"]*)"|([^;]+))`)
+)
+
+// FilenameFromContentDisposition 从Content-Disposition头中取出文件名并清理
+// 优先使用 RFC 5987 的 filename*（形如 filename*=UTF-8'zh-CN'%E8%A7%86%E9%A2%91.mp4），没有时使用 filename；
+// 取不到时返回空字符串
+func FilenameFromContentDisposition(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	// 标准库会解码 filename* 并以 filename 返回
+	if _, params, err := mime.ParseMediaType(header); err == nil {
+		return SanitizeFilename(params["filename"])
+	}
+
+	if matches := extFilenameRegex.FindStringSubmatch(header); matches != nil {
+		if name := decodeExtValue(strings.TrimSpace(matches[1])); name != "" {
+			return SanitizeFilename(name)
+		}
+	}
+	if matches := plainFilenameRegex.FindStringSubmatch(header); matches != nil {
+		return SanitizeFilename(matches[1] + strings.TrimSpace(matches[2]))
+	}
+	return ""
+}
+
+// decodeExtValue 解码 RFC 5987 的扩展参数值 charset'language'percent-encoded
+// 只支持UTF-8和ASCII，其他字符集返回空字符串
+func decodeExtValue(value string) string {
+	parts := strings.SplitN(strings.Trim(value, `"`), "'", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8", "us-ascii":
+	default:
+		return ""
+	}
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return ""
+	}
+	return decoded
+}
+
+// SanitizeFilename 将外部提供的文件名清理为可以安全用于本地路径的文件名
+// 去掉目录部分、控制字符和Windows不允许的字符，去掉首尾的空格和点（避免 .. 和隐藏文件），
+// 过长时保留扩展名截断；清理后为空时返回空字符串
+func SanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "_")
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return ""
+	}
+
+	if len(name) > maxFilenameBytes {
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		stem := truncateUTF8(strings.TrimSuffix(name, ext), maxFilenameBytes-len(ext))
+		name = strings.TrimRight(stem, " .") + ext
+	}
+	return name
+}
+
+// truncateUTF8 按字节数截断字符串，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ContentDisposition 按 RFC 6266 生成附件下载的Content-Disposition
+// filename 参数使用只含ASCII的兼容文件名，文件名含非ASCII字符时另加 RFC 5987 编码的 filename*，
+// 支持的浏览器优先使用 filename*；transliterate 为true时兼容文件名中的汉字转写为拼音
+func ContentDisposition(name string, transliterate bool) string {
+	fallback := ASCIIFilename(name, transliterate)
+	value := `attachment; filename="` + fallback + `"`
+	if fallback != name {
+		value += "; filename*=UTF-8''" + encodeExtValue(name)
+	}
+	return value
+}
+
+// ASCIIFilename 将文件名转换为只含可打印ASCII字符的兼容文件名
+// 非ASCII字符和引号、反斜杠替换为下划线（连续的只保留一个），transliterate 为true时汉字转写为拼音；
+// 转换后文件名主体为空时使用 download
+func ASCIIFilename(name string, transliterate bool) string {
+	ext := path.Ext(name)
+	if !isPlainASCII(ext) {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+
+	var b strings.Builder
+	args := pinyin.NewArgs()
+	last := byte(0) // 上一个写入的字符
+	write := func(part string) {
+		b.WriteString(part)
+		last = part[len(part)-1]
+	}
+	for _, r := range stem {
+		switch {
+		case r < utf8.RuneSelf && isPlainASCII(string(r)):
+			write(string(r))
+		case transliterate && unicode.Is(unicode.Han, r) && len(pinyin.SinglePinyin(r, args)) > 0:
+			// 音节首字母大写并以空格分隔，避免连在一起难以辨认
+			syllable := pinyin.SinglePinyin(r, args)[0]
+			if last != 0 && last != ' ' && last != '_' {
+				write(" ")
+			}
+			write(strings.ToUpper(syllable[:1]) + syllable[1:])
+		case last != '_':
+			write("_")
+		}
+	}
+
+	result := strings.Trim(b.String(), " _.")
+	if result == "" {
+		result = "download"
+	}
+	return result + ext
+}
+
+// isPlainASCII 是否只含可打印ASCII字符且不含引号和反斜杠
+func isPlainASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] >= 0x7f || s[i] == '"' || s[i] == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeExtValue 按 RFC 5987 对参数值做百分号编码，attr-char 以外的字节都编码
+func encodeExtValue(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
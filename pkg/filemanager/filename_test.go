@@ -0,0 +1,117 @@
+package filemanager
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestASCIIFilename(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		transliterate bool
+		want          string
+	}{
+		{name: "纯ASCII不变", input: "movie 01.mp3", want: "movie 01.mp3"},
+		{name: "汉字替换为下划线", input: "视频.mp3", want: "download.mp3"},
+		{name: "连续非ASCII只保留一个下划线", input: "my视频file.mp3", want: "my_file.mp3"},
+		{name: "汉字转写为拼音", input: "视频.mp3", transliterate: true, want: "Shi Pin.mp3"},
+		{name: "拼音与ASCII之间加空格", input: "my视频.mp3", transliterate: true, want: "my Shi Pin.mp3"},
+		{name: "无法转写的字符仍替换", input: "こんにちは.mp3", transliterate: true, want: "download.mp3"},
+		{name: "引号和反斜杠替换", input: `a"b\c.mp3`, want: "a_b_c.mp3"},
+		{name: "非ASCII扩展名去掉", input: "file.视频", want: "file"},
+		{name: "空文件名", input: "", want: "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ASCIIFilename(tt.input, tt.transliterate); got != tt.want {
+				t.Errorf("ASCIIFilename(%q, %v) = %q，应为 %q", tt.input, tt.transliterate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		transliterate bool
+		want          string
+	}{
+		{
+			name:  "纯ASCII只有filename",
+			input: "movie.mp3",
+			want:  `attachment; filename="movie.mp3"`,
+		},
+		{
+			name:  "非ASCII同时带filename*",
+			input: "视频.mp3",
+			want:  `attachment; filename="download.mp3"; filename*=UTF-8''%E8%A7%86%E9%A2%91.mp3`,
+		},
+		{
+			name:          "兼容文件名使用拼音",
+			input:         "视频.mp3",
+			transliterate: true,
+			want:          `attachment; filename="Shi Pin.mp3"; filename*=UTF-8''%E8%A7%86%E9%A2%91.mp3`,
+		},
+		{
+			name:  "引号编码到filename*中",
+			input: `a"b.mp3`,
+			want:  `attachment; filename="a_b.mp3"; filename*=UTF-8''a%22b.mp3`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContentDisposition(tt.input, tt.transliterate)
+			if got != tt.want {
+				t.Fatalf("ContentDisposition(%q) = %q，应为 %q", tt.input, got, tt.want)
+			}
+			// 生成的头能解析回原文件名
+			if parsed := FilenameFromContentDisposition(got); parsed != SanitizeFilename(tt.input) {
+				t.Errorf("解析回的文件名 = %q，应为 %q", parsed, SanitizeFilename(tt.input))
+			}
+		})
+	}
+}
+
+func TestFilenameFromContentDisposition(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "空", header: "", want: ""},
+		{name: "带引号的filename", header: `attachment; filename="movie.mp4"`, want: "movie.mp4"},
+		{name: "不带引号的filename", header: "attachment; filename=movie.mp4", want: "movie.mp4"},
+		{name: "filename*优先", header: `attachment; filename="fallback.mp4"; filename*=UTF-8''%E8%A7%86%E9%A2%91.mp4`, want: "视频.mp4"},
+		{name: "只有filename*", header: `attachment; filename*=UTF-8'zh-CN'%E8%A7%86%E9%A2%91.mp4`, want: "视频.mp4"},
+		{name: "不规范的头使用正则兜底", header: `attachment; filename=my movie.mp4; size=10`, want: "my movie.mp4"},
+		{name: "不规范的头中的filename*", header: `attachment;; filename*=utf-8''%E8%A7%86%E9%A2%91.mp4`, want: "视频.mp4"},
+		{name: "不支持的字符集退回filename", header: `attachment;; filename*=gbk''%CA%D3.mp4; filename="fallback.mp4"`, want: "fallback.mp4"},
+		{name: "去掉目录部分", header: `attachment; filename="../../etc/passwd"`, want: "passwd"},
+		{name: "去掉Windows目录部分", header: `attachment; filename="..\\..\\evil.exe"`, want: "evil.exe"},
+		{name: "只有点", header: `attachment; filename=".."`, want: ""},
+		{name: "没有文件名", header: "inline", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilenameFromContentDisposition(tt.header); got != tt.want {
+				t.Errorf("FilenameFromContentDisposition(%q) = %q，应为 %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilenameTruncates(t *testing.T) {
+	long := strings.Repeat("视", 100) + ".mp4"
+	got := SanitizeFilename(long)
+	if len(got) > maxFilenameBytes {
+		t.Fatalf("截断后长度 = %d，超过 %d", len(got), maxFilenameBytes)
+	}
+	if !strings.HasSuffix(got, ".mp4") || !strings.HasPrefix(got, "视") {
+		t.Errorf("截断后 = %q，应保留扩展名且不截断多字节字符", got)
+	}
+}
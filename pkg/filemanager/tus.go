@@ -0,0 +1,268 @@
+package filemanager
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tusDirName 断点续传的暂存目录，位于上传目录下，完成后可直接重命名到上传目录
+const tusDirName = ".tus"
+
+var (
+	// ErrTusUploadNotFound 上传不存在或已被删除
+	ErrTusUploadNotFound = errors.New("上传不存在")
+	// ErrTusOffsetMismatch 客户端的偏移量与服务端已接收的数据量不一致
+	ErrTusOffsetMismatch = errors.New("上传偏移量不匹配")
+	// ErrTusSizeExceeded 写入的数据超过声明的上传长度
+	ErrTusSizeExceeded = errors.New("数据超过声明的上传长度")
+)
+
+// TusUpload 断点续传上传的状态
+// 数据保存在 <id>.bin，状态保存在 <id>.info
+type TusUpload struct {
+	ID          string            `json:"id"`
+	Size        int64             `json:"size"`
+	Offset      int64             `json:"offset"`
+	Metadata    map[string]string `json:"metadata"`
+	UserID      string            `json:"user_id"`
+	AnonymousID string            `json:"anonymous_id,omitempty"`
+	TaskID      string            `json:"task_id,omitempty"` // 上传完成后创建的转换任务
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+}
+
+// Complete 数据是否已全部接收
+func (u *TusUpload) Complete() bool {
+	return u.Offset >= u.Size
+}
+
+// Expired 上传是否已过期
+func (u *TusUpload) Expired() bool {
+	return time.Now().After(u.ExpiresAt)
+}
+
+// CreateTusUpload 创建断点续传上传，生成ID并创建空的数据文件
+func (fm *FileManager) CreateTusUpload(upload *TusUpload) error {
+	if err := os.MkdirAll(fm.tusDir(), 0755); err != nil {
+		return fmt.Errorf("创建断点续传目录失败: %v", err)
+	}
+
+	upload.ID = uuid.New().String()
+	upload.Offset = 0
+	upload.CreatedAt = time.Now()
+
+	file, err := os.OpenFile(fm.tusDataPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建上传数据文件失败: %v", err)
+	}
+	file.Close()
+
+	if err := fm.SaveTusUpload(upload); err != nil {
+		os.Remove(fm.tusDataPath(upload.ID))
+		return err
+	}
+	return nil
+}
+
+// GetTusUpload 读取断点续传上传的状态
+func (fm *FileManager) GetTusUpload(id string) (*TusUpload, error) {
+	// ID会拼接到路径中，只接受UUID
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrTusUploadNotFound
+	}
+
+	data, err := os.ReadFile(fm.tusInfoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrTusUploadNotFound
+		}
+		return nil, fmt.Errorf("读取上传状态失败: %v", err)
+	}
+
+	var upload TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("解析上传状态失败: %v", err)
+	}
+	return &upload, nil
+}
+
+// SaveTusUpload 保存断点续传上传的状态，先写临时文件再重命名，避免写到一半时进程退出
+func (fm *FileManager) SaveTusUpload(upload *TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("序列化上传状态失败: %v", err)
+	}
+
+	tmpPath := fm.tusInfoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("保存上传状态失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, fm.tusInfoPath(upload.ID)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("保存上传状态失败: %v", err)
+	}
+	return nil
+}
+
+// WriteTusChunk 从offset处追加数据，返回本次写入的字节数
+// 读取中断时已写入的数据仍会计入偏移量，客户端可从新的偏移量继续上传
+func (fm *FileManager) WriteTusChunk(upload *TusUpload, offset int64, src io.Reader) (int64, error) {
+	if offset != upload.Offset {
+		return 0, ErrTusOffsetMismatch
+	}
+
+	file, err := os.OpenFile(fm.tusDataPath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrTusUploadNotFound
+		}
+		return 0, fmt.Errorf("打开上传数据文件失败: %v", err)
+	}
+	defer file.Close()
+
+	// 上次写入后若未来得及保存状态，文件中可能有多余的数据，以状态中的偏移量为准
+	if err := file.Truncate(upload.Offset); err != nil {
+		return 0, fmt.Errorf("截断上传数据文件失败: %v", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("定位上传数据文件失败: %v", err)
+	}
+
+	remaining := upload.Size - upload.Offset
+	written, copyErr := io.CopyN(file, src, remaining)
+	if copyErr == io.EOF {
+		copyErr = nil
+	}
+
+	// 数据已写满时再读一个字节，确认客户端没有发送超出长度的数据
+	if copyErr == nil && written == remaining {
+		if n, _ := src.Read(make([]byte, 1)); n > 0 {
+			copyErr = ErrTusSizeExceeded
+		}
+	}
+
+	upload.Offset += written
+	if err := fm.SaveTusUpload(upload); err != nil {
+		return written, err
+	}
+	return written, copyErr
+}
+
+// OpenTusData 以只读方式打开上传的数据文件
+func (fm *FileManager) OpenTusData(upload *TusUpload) (*os.File, error) {
+	return os.Open(fm.tusDataPath(upload.ID))
+}
+
+// FinalizeTusUpload 将已接收完整的数据移动到上传目录，返回与普通上传一致的文件信息
+func (fm *FileManager) FinalizeTusUpload(upload *TusUpload) (*FileInfo, error) {
+	if !upload.Complete() {
+		return nil, fmt.Errorf("上传尚未完成: %d/%d", upload.Offset, upload.Size)
+	}
+
+	originalName := upload.Metadata["filename"]
+	fileInfo := &FileInfo{
+		ID:           upload.ID,
+		OriginalName: originalName,
+		Size:         upload.Size,
+		Extension:    strings.ToLower(filepath.Ext(originalName)),
+		CreatedAt:    time.Now(),
+	}
+	fileInfo.SavedName = fm.generateSavedName(fileInfo.ID, fileInfo.Extension)
+	fileInfo.FilePath = filepath.Join(fm.UploadDir, fileInfo.SavedName)
+
+	// 计算哈希
+	src, err := fm.OpenTusData(upload)
+	if err != nil {
+		return nil, fmt.Errorf("打开上传数据文件失败: %v", err)
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	_, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), src)
+	src.Close()
+	if err != nil {
+		return nil, fmt.Errorf("计算文件哈希失败: %v", err)
+	}
+	fileInfo.MD5Hash = fmt.Sprintf("%x", md5Hash.Sum(nil))
+	fileInfo.SHA256Hash = fmt.Sprintf("%x", sha256Hash.Sum(nil))
+
+	if err := fm.moveFile(fm.tusDataPath(upload.ID), fileInfo.FilePath); err != nil {
+		return nil, fmt.Errorf("保存文件失败: %v", err)
+	}
+
+	return fileInfo, nil
+}
+
+// DeleteTusUpload 删除断点续传上传的数据和状态
+func (fm *FileManager) DeleteTusUpload(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrTusUploadNotFound
+	}
+
+	for _, path := range []string{fm.tusDataPath(id), fm.tusInfoPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除上传文件失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// CleanupExpiredTusUploads 删除已过期的断点续传上传，返回删除的数量
+func (fm *FileManager) CleanupExpiredTusUploads() (int, error) {
+	entries, err := os.ReadDir(fm.tusDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("读取断点续传目录失败: %v", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok {
+			continue
+		}
+
+		upload, err := fm.GetTusUpload(id)
+		if err != nil {
+			slog.Warn("读取断点续传状态失败", "upload_id", id, "error", err)
+			continue
+		}
+		if !upload.Expired() {
+			continue
+		}
+
+		if err := fm.DeleteTusUpload(id); err != nil {
+			slog.Warn("删除过期的断点续传上传失败", "upload_id", id, "error", err)
+			continue
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// tusDir 断点续传暂存目录
+func (fm *FileManager) tusDir() string {
+	return filepath.Join(fm.UploadDir, tusDirName)
+}
+
+// tusDataPath 上传数据文件路径
+func (fm *FileManager) tusDataPath(id string) string {
+	return filepath.Join(fm.tusDir(), id+".bin")
+}
+
+// tusInfoPath 上传状态文件路径
+func (fm *FileManager) tusInfoPath(id string) string {
+	return filepath.Join(fm.tusDir(), id+".info")
+}
@@ -0,0 +1,149 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore 本地文件系统存储，键即文件路径
+type LocalStore struct{}
+
+// NewLocalStore 创建本地文件系统存储
+func NewLocalStore() *LocalStore {
+	return &LocalStore{}
+}
+
+// Backend 存储类型名称
+func (s *LocalStore) Backend() string {
+	return "local"
+}
+
+// PutFile 将文件移动到键对应的路径，文件已在该路径时不做任何操作
+func (s *LocalStore) PutFile(ctx context.Context, key, localPath string) error {
+	if filepath.Clean(key) == filepath.Clean(localPath) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(key), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	// 先尝试重命名，跨文件系统时复制后删除
+	if err := os.Rename(localPath, key); err == nil {
+		return nil
+	}
+	if err := copyFile(localPath, key); err != nil {
+		return fmt.Errorf("保存文件失败: %v", err)
+	}
+	return os.Remove(localPath)
+}
+
+// Open 打开文件用于读取
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	file, err := os.Open(key)
+	if err != nil {
+		return nil, nil, localError(key, err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, localError(key, err)
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	return file, &ObjectInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+// Stat 获取文件信息
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	stat, err := os.Stat(key)
+	if err != nil {
+		return nil, localError(key, err)
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	return &ObjectInfo{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+// Delete 删除文件
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(key); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// LocalPath 本地存储的键即文件路径
+func (s *LocalStore) LocalPath(key string) (string, bool) {
+	return key, true
+}
+
+// PresignGet 本地存储不支持预签名URL，由服务端直接发送文件
+func (s *LocalStore) PresignGet(ctx context.Context, key string, opts PresignOptions) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+// List 遍历目录下的所有文件，返回的键为文件路径
+func (s *LocalStore) List(ctx context.Context, dir string, fn func(ObjectInfo) error) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		// 目录不存在或遍历期间被删除时跳过
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		return fn(ObjectInfo{Key: path, Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+// localError 将文件不存在的错误转换为 ErrNotExist
+func localError(key string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	return err
+}
+
+// copyFile 复制文件，失败时删除不完整的目标文件
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
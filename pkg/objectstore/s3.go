@@ -0,0 +1,183 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"video-converter/internal/config"
+	"video-converter/internal/tracing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store S3兼容的对象存储（AWS S3、MinIO等）
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store 创建S3存储，配置了 create_bucket 时bucket不存在则创建
+func NewS3Store(ctx context.Context, cfg *config.S3Config) (*S3Store, error) {
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err != nil {
+		return nil, fmt.Errorf("创建S3客户端失败: %v", err)
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+		Transport:    &tracing.Transport{Base: transport},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建S3客户端失败: %v", err)
+	}
+
+	store := &S3Store{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: strings.Trim(cfg.Prefix, "/"),
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("访问bucket %s 失败: %v", cfg.Bucket, err)
+	}
+	if !exists {
+		if !cfg.CreateBucket {
+			return nil, fmt.Errorf("bucket %s 不存在", cfg.Bucket)
+		}
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("创建bucket %s 失败: %v", cfg.Bucket, err)
+		}
+		slog.Info("已创建S3 bucket", "bucket", cfg.Bucket)
+	}
+	return store, nil
+}
+
+// Backend 存储类型名称
+func (s *S3Store) Backend() string {
+	return "s3"
+}
+
+// PutFile 上传本地文件，成功后删除本地文件
+func (s *S3Store) PutFile(ctx context.Context, key, localPath string) error {
+	opts := minio.PutObjectOptions{ContentType: mime.TypeByExtension(filepath.Ext(key))}
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+	if _, err := s.client.FPutObject(ctx, s.bucket, s.objectName(key), localPath, opts); err != nil {
+		return fmt.Errorf("上传对象 %s 失败: %v", key, err)
+	}
+
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		slog.WarnContext(ctx, "删除已上传的本地文件失败", "path", localPath, "error", err)
+	}
+	return nil
+}
+
+// Open 打开对象用于读取，返回的对象支持Seek，按需发起范围请求
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s.wrapError(key, err)
+	}
+
+	// GetObject不会立即发起请求，通过Stat确认对象存在
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, s.wrapError(key, err)
+	}
+	return object, &ObjectInfo{Key: key, Size: stat.Size, ModTime: stat.LastModified}, nil
+}
+
+// Stat 获取对象信息
+func (s *S3Store) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	stat, err := s.client.StatObject(ctx, s.bucket, s.objectName(key), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.wrapError(key, err)
+	}
+	return &ObjectInfo{Key: key, Size: stat.Size, ModTime: stat.LastModified}, nil
+}
+
+// Delete 删除对象，S3删除不存在的对象同样返回成功
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, s.objectName(key), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("删除对象 %s 失败: %v", key, err)
+	}
+	return nil
+}
+
+// LocalPath 对象不在本地
+func (s *S3Store) LocalPath(key string) (string, bool) {
+	return "", false
+}
+
+// PresignGet 生成预签名的下载URL，通过响应头覆盖参数指定下载文件名和类型
+func (s *S3Store) PresignGet(ctx context.Context, key string, opts PresignOptions) (string, error) {
+	params := url.Values{}
+	if opts.ContentType != "" {
+		params.Set("response-content-type", opts.ContentType)
+	}
+	if opts.ContentDisposition != "" {
+		params.Set("response-content-disposition", opts.ContentDisposition)
+	}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, s.objectName(key), opts.Expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("生成预签名URL失败: %v", err)
+	}
+	return u.String(), nil
+}
+
+// List 遍历目录下的所有对象，返回的键为去掉前缀后的规范形式
+func (s *S3Store) List(ctx context.Context, dir string, fn func(ObjectInfo) error) error {
+	prefix := s.objectName(dir) + "/"
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("列出对象 %s 失败: %v", dir, object.Err)
+		}
+		key := object.Key
+		if s.prefix != "" {
+			key = strings.TrimPrefix(key, s.prefix+"/")
+		}
+		if err := fn(ObjectInfo{Key: key, Size: object.Size, ModTime: object.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectName 键转换为对象名：规范化后加上前缀
+func (s *S3Store) objectName(key string) string {
+	name := CleanKey(key)
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+// wrapError 将对象不存在的错误转换为 ErrNotExist
+func (s *S3Store) wrapError(key string, err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == http.StatusNotFound || resp.Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	return fmt.Errorf("访问对象 %s 失败: %v", key, err)
+}
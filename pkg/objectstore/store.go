@@ -0,0 +1,130 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"video-converter/internal/config"
+)
+
+var (
+	// ErrNotExist 对象不存在
+	ErrNotExist = errors.New("对象不存在")
+	// ErrPresignUnsupported 存储不支持生成预签名URL（本地存储）
+	ErrPresignUnsupported = errors.New("存储不支持预签名URL")
+)
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// PresignOptions 预签名下载URL的响应头覆盖
+type PresignOptions struct {
+	ContentType        string
+	ContentDisposition string
+	Expiry             time.Duration
+}
+
+// Store 保存上传文件和转换输出的存储
+// 键与本地存储时的文件路径相同（如 uploads/xxx.mp4），任务记录中的路径即为键，
+// 切换存储类型不需要修改任务记录的格式
+type Store interface {
+	// Backend 存储类型名称
+	Backend() string
+	// PutFile 将本地文件存入存储，成功后本地文件归存储所有：本地存储移动文件，其他存储上传后删除本地文件
+	PutFile(ctx context.Context, key, localPath string) error
+	// Open 打开对象用于读取，对象不存在时返回 ErrNotExist
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error)
+	// Stat 获取对象信息，对象不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// LocalPath 对象在本地文件系统中的路径，对象不在本地时返回false
+	LocalPath(key string) (string, bool)
+	// PresignGet 生成临时的下载URL，不支持时返回 ErrPresignUnsupported
+	PresignGet(ctx context.Context, key string, opts PresignOptions) (string, error)
+	// List 遍历目录（键前缀）下的所有对象，目录不存在时不返回错误
+	List(ctx context.Context, dir string, fn func(ObjectInfo) error) error
+}
+
+// New 根据配置创建存储
+func New(ctx context.Context, cfg *config.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalStore(), nil
+	case "s3":
+		return NewS3Store(ctx, &cfg.S3)
+	default:
+		return nil, fmt.Errorf("不支持的存储类型: %s", cfg.Backend)
+	}
+}
+
+// Fetch 获取对象的本地路径供ffmpeg等本地程序读取
+// 对象不在本地时下载到tempDir，返回的cleanup用于删除临时文件；对象在本地时cleanup不做任何操作
+func Fetch(ctx context.Context, store Store, key, tempDir string) (string, func(), error) {
+	if path, ok := store.LocalPath(key); ok {
+		return path, func() {}, nil
+	}
+
+	reader, _, err := store.Open(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+
+	// 保留扩展名，ffmpeg和格式检查依赖扩展名
+	file, err := os.CreateTemp(tempDir, "fetch-*"+filepath.Ext(key))
+	if err != nil {
+		return "", nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("下载对象 %s 失败: %v", key, err)
+	}
+	return file.Name(), cleanup, nil
+}
+
+// Move 将对象移动到新的键，不在本地的对象先下载到tempDir再上传
+func Move(ctx context.Context, store Store, src, dst, tempDir string) error {
+	localPath, cleanup, err := Fetch(ctx, store, src, tempDir)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := store.PutFile(ctx, dst, localPath); err != nil {
+		return err
+	}
+	// 本地存储的PutFile已移动文件，删除原键不做任何操作
+	return store.Delete(ctx, src)
+}
+
+// CleanKey 键的规范形式：统一使用斜杠分隔，去掉 ./ 和开头的 /
+// 本地路径 ./uploads/a.mp4 与 uploads/a.mp4 指向同一个对象，比较键时应先规范化
+func CleanKey(key string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(key)), "/")
+}
+
+// StagingPath 写入对象前使用的本地路径：本地存储直接写到最终位置，其他存储先写到tempDir
+func StagingPath(store Store, key, tempDir string) string {
+	if path, ok := store.LocalPath(key); ok {
+		return path
+	}
+	return filepath.Join(tempDir, filepath.Base(key))
+}
@@ -2,16 +2,25 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
 
+	"video-converter/internal/logger"
+	"video-converter/internal/metrics"
 	"video-converter/internal/model"
 	"video-converter/internal/storage"
+	"video-converter/internal/tracing"
 	"video-converter/pkg/converter"
+	"video-converter/pkg/disk"
+	"video-converter/pkg/filemanager"
+	"video-converter/pkg/objectstore"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -19,26 +28,60 @@ import (
 type TaskProcessor struct {
 	db              *gorm.DB
 	redisManager    *storage.RedisManager
+	blobStore       *storage.BlobStore
+	store           objectstore.Store
 	ffmpegConverter *converter.FFmpegConverter
 	outputDir       string
+	tempDir         string      // 对象存储中的输入和输出在本地暂存的目录
+	diskGuard       *disk.Guard // 剩余空间低于临界水位时暂停领取任务，为nil时不检查
 	workers         int
 	taskChan        chan *model.ConversionTask
 	stopChan        chan struct{}
 	wg              sync.WaitGroup
 	running         bool
 	mu              sync.RWMutex
+
+	// 运行中任务的取消函数与worker状态
+	activeMu      sync.Mutex
+	activeCancels map[string]context.CancelFunc
+	workerStates  []WorkerStatus
+	queuedAt      map[string]time.Time // 任务进入队列的时间，用于补记排队span
+}
+
+// WorkerStatus worker运行状态
+type WorkerStatus struct {
+	ID        int        `json:"id"`
+	Busy      bool       `json:"busy"`
+	TaskID    string     `json:"task_id,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// ProcessorStats 任务处理器状态
+type ProcessorStats struct {
+	Running        bool           `json:"running"`
+	Workers        int            `json:"workers"`
+	BusyWorkers    int            `json:"busy_workers"`
+	ChannelDepth   int            `json:"channel_depth"`
+	ChannelCap     int            `json:"channel_capacity"`
+	WorkerStatuses []WorkerStatus `json:"worker_statuses"`
 }
 
 // NewTaskProcessor 创建任务处理器
-func NewTaskProcessor(db *gorm.DB, redisManager *storage.RedisManager, ffmpegConverter *converter.FFmpegConverter, outputDir string, workers int) *TaskProcessor {
+func NewTaskProcessor(db *gorm.DB, redisManager *storage.RedisManager, ffmpegConverter *converter.FFmpegConverter, store objectstore.Store, outputDir, tempDir string, workers int) *TaskProcessor {
 	return &TaskProcessor{
 		db:              db,
 		redisManager:    redisManager,
+		blobStore:       storage.NewBlobStore(db, store),
+		store:           store,
 		ffmpegConverter: ffmpegConverter,
 		outputDir:       outputDir,
+		tempDir:         tempDir,
 		workers:         workers,
 		taskChan:        make(chan *model.ConversionTask, 100),
 		stopChan:        make(chan struct{}),
+		activeCancels:   make(map[string]context.CancelFunc),
+		workerStates:    make([]WorkerStatus, workers),
+		queuedAt:        make(map[string]time.Time),
 	}
 }
 
@@ -52,7 +95,7 @@ func (tp *TaskProcessor) Start() {
 	}
 
 	tp.running = true
-	log.Printf("启动 %d 个任务处理器worker", tp.workers)
+	slog.Info("启动任务处理器", "workers", tp.workers)
 
 	// 启动worker goroutines
 	for i := 0; i < tp.workers; i++ {
@@ -74,34 +117,102 @@ func (tp *TaskProcessor) Stop() {
 		return
 	}
 
-	log.Println("正在停止任务处理器...")
+	slog.Info("正在停止任务处理器")
 	close(tp.stopChan)
 	tp.wg.Wait()
 	tp.running = false
-	log.Println("任务处理器已停止")
+	slog.Info("任务处理器已停止")
 }
 
-// AddTask 添加任务到队列
-func (tp *TaskProcessor) AddTask(task *model.ConversionTask) {
-	select {
-	case tp.taskChan <- task:
-		log.Printf("任务 %s 已添加到队列", task.ID)
-	default:
-		log.Printf("任务队列已满，任务 %s 添加失败", task.ID)
+// SetDiskGuard 设置磁盘空间守卫，需在 Start 之前调用
+func (tp *TaskProcessor) SetDiskGuard(guard *disk.Guard) {
+	tp.diskGuard = guard
+}
+
+// AddTask 将排队中的任务直接交给worker，不必等待下一次扫描
+// 任务已被其他节点或扫描器领取、队列已满或磁盘空间不足时返回false，未领取的任务仍由扫描器稍后处理
+func (tp *TaskProcessor) AddTask(ctx context.Context, task *model.ConversionTask) bool {
+	if !tp.dispatch(ctx, task) {
+		return false
+	}
+	slog.InfoContext(ctx, "任务已添加到队列", "task_id", task.ID)
+	return true
+}
+
+// CancelTask 强制取消正在处理的任务（终止FFmpeg进程，中断输入获取和输出保存）
+// 调用前应先将任务记录改为已取消，worker不会再写入任务的最终状态；返回任务是否正在被某个worker处理
+func (tp *TaskProcessor) CancelTask(taskID string) bool {
+	tp.activeMu.Lock()
+	defer tp.activeMu.Unlock()
+
+	cancel, ok := tp.activeCancels[taskID]
+	if !ok {
+		return false
+	}
+
+	cancel()
+	return true
+}
+
+// Stats 获取任务处理器运行状态
+func (tp *TaskProcessor) Stats() ProcessorStats {
+	tp.mu.RLock()
+	running := tp.running
+	tp.mu.RUnlock()
+
+	tp.activeMu.Lock()
+	defer tp.activeMu.Unlock()
+
+	statuses := make([]WorkerStatus, len(tp.workerStates))
+	busy := 0
+	for i, state := range tp.workerStates {
+		state.ID = i
+		statuses[i] = state
+		if state.Busy {
+			busy++
+		}
+	}
+
+	return ProcessorStats{
+		Running:        running,
+		Workers:        tp.workers,
+		BusyWorkers:    busy,
+		ChannelDepth:   len(tp.taskChan),
+		ChannelCap:     cap(tp.taskChan),
+		WorkerStatuses: statuses,
 	}
 }
 
+// beginTask 登记worker正在处理的任务
+func (tp *TaskProcessor) beginTask(workerID int, taskID string, cancel context.CancelFunc) {
+	tp.activeMu.Lock()
+	defer tp.activeMu.Unlock()
+
+	now := time.Now()
+	tp.activeCancels[taskID] = cancel
+	tp.workerStates[workerID] = WorkerStatus{ID: workerID, Busy: true, TaskID: taskID, StartedAt: &now}
+}
+
+// endTask 清除worker的任务登记
+func (tp *TaskProcessor) endTask(workerID int, taskID string) {
+	tp.activeMu.Lock()
+	defer tp.activeMu.Unlock()
+
+	delete(tp.activeCancels, taskID)
+	tp.workerStates[workerID] = WorkerStatus{ID: workerID}
+}
+
 // worker 处理任务的worker goroutine
 func (tp *TaskProcessor) worker(workerID int) {
 	defer tp.wg.Done()
-	log.Printf("Worker %d 启动", workerID)
+	slog.Debug("worker启动", "worker_id", workerID)
 
 	for {
 		select {
 		case task := <-tp.taskChan:
 			tp.processTask(workerID, task)
 		case <-tp.stopChan:
-			log.Printf("Worker %d 收到停止信号", workerID)
+			slog.Debug("worker收到停止信号", "worker_id", workerID)
 			return
 		}
 	}
@@ -113,14 +224,14 @@ func (tp *TaskProcessor) taskScanner() {
 	ticker := time.NewTicker(10 * time.Second) // 每10秒扫描一次
 	defer ticker.Stop()
 
-	log.Println("任务扫描器启动")
+	slog.Debug("任务扫描器启动")
 
 	for {
 		select {
 		case <-ticker.C:
 			tp.scanQueuedTasks()
 		case <-tp.stopChan:
-			log.Println("任务扫描器收到停止信号")
+			slog.Debug("任务扫描器收到停止信号")
 			return
 		}
 	}
@@ -128,6 +239,11 @@ func (tp *TaskProcessor) taskScanner() {
 
 // scanQueuedTasks 扫描排队中的任务
 func (tp *TaskProcessor) scanQueuedTasks() {
+	// 磁盘空间不足时暂停领取，任务保持排队，清理出空间后的下一次扫描继续处理
+	if tp.diskGuard.Level() >= disk.LevelCritical {
+		return
+	}
+
 	var tasks []model.ConversionTask
 
 	// 查找状态为排队的任务
@@ -137,59 +253,152 @@ func (tp *TaskProcessor) scanQueuedTasks() {
 		Find(&tasks).Error
 
 	if err != nil {
-		log.Printf("扫描排队任务失败: %v", err)
+		slog.Error("扫描排队任务失败", "error", err)
 		return
 	}
 
-	for _, task := range tasks {
-		// 尝试添加到处理队列
-		select {
-		case tp.taskChan <- &task:
-			// 更新任务状态为处理中
-			tp.updateTaskStatus(&task, model.TaskStatusProcessing)
-		default:
-			// 队列已满，跳过
-			break
+	for i := range tasks {
+		if !tp.dispatch(context.Background(), &tasks[i]) && len(tp.taskChan) == cap(tp.taskChan) {
+			// 队列已满，剩余任务留到下次扫描
+			return
 		}
 	}
 }
 
+// dispatch 领取排队中的任务并放入处理队列
+// 以 queued -> processing 的条件更新领取任务，保证扫描器和 AddTask 不会重复处理同一任务
+func (tp *TaskProcessor) dispatch(ctx context.Context, task *model.ConversionTask) bool {
+	if tp.diskGuard.Level() >= disk.LevelCritical {
+		slog.WarnContext(ctx, "磁盘空间不足，任务保持排队", "task_id", task.ID)
+		return false
+	}
+
+	queuedAt := task.UpdatedAt
+	now := time.Now()
+	result := tp.db.WithContext(ctx).Model(&model.ConversionTask{}).
+		Where("id = ? AND status = ?", task.ID, model.TaskStatusQueued).
+		Updates(map[string]interface{}{
+			"status":     model.TaskStatusProcessing,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		slog.ErrorContext(ctx, "领取排队任务失败", "task_id", task.ID, "error", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	task.Status = model.TaskStatusProcessing
+	task.UpdatedAt = now
+
+	tp.activeMu.Lock()
+	tp.queuedAt[task.ID] = queuedAt
+	tp.activeMu.Unlock()
+
+	select {
+	case tp.taskChan <- task:
+		tp.redisManager.SetTaskStatus(ctx, task.ID, string(model.TaskStatusProcessing))
+		return true
+	default:
+		// 队列已满，退回排队状态
+		tp.activeMu.Lock()
+		delete(tp.queuedAt, task.ID)
+		tp.activeMu.Unlock()
+		tp.updateTaskStatus(ctx, task, model.TaskStatusQueued)
+		slog.WarnContext(ctx, "任务队列已满，等待下次扫描", "task_id", task.ID)
+		return false
+	}
+}
+
 // processTask 处理具体的转换任务
+// 管理员强制取消时先将任务记录改为已取消再中断处理，任务的最终状态只在仍处于处理中时写入，
+// 处理期间任何阶段的取消都不会被覆盖
 func (tp *TaskProcessor) processTask(workerID int, task *model.ConversionTask) {
-	log.Printf("Worker %d 开始处理任务 %s", workerID, task.ID)
+	// 延续创建任务的请求链路，并补记排队等待的时间
+	ctx := logger.WithUserID(logger.WithTaskID(context.Background(), task.ID), task.UserID)
+	ctx = tracing.ExtractString(ctx, task.TraceContext)
+	tracing.RecordQueueWait(ctx, task.ID, tp.takeQueuedAt(task.ID))
+	ctx, span := tracing.Start(ctx, "task.process", trace.WithAttributes(
+		attribute.String("task.id", task.ID),
+		attribute.String("task.type", string(task.Type)),
+		attribute.Int("worker.id", workerID),
+	))
+	defer span.End()
+	db := tp.db.WithContext(ctx)
+
+	// 整个处理过程都登记取消函数，获取输入、转换和保存输出时都可以被强制取消
+	// taskCtx 只用于可中断的操作，写入任务状态和清理仍使用 ctx
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tp.beginTask(workerID, task.ID, cancel)
+	defer tp.endTask(workerID, task.ID)
+
+	slog.InfoContext(ctx, "开始处理任务", "worker_id", workerID, "type", task.Type)
 
-	ctx := context.Background()
+	// 任务可能在领取后、登记取消函数前已被取消
+	var current model.ConversionTask
+	if err := db.Select("status").First(&current, "id = ?", task.ID).Error; err == nil &&
+		current.Status != model.TaskStatusProcessing {
+		slog.InfoContext(ctx, "跳过已取消的任务", "worker_id", workerID, "status", current.Status)
+		return
+	}
 
-	// 更新任务状态为处理中
-	tp.updateTaskStatus(task, model.TaskStatusProcessing)
+	// 领取时已将任务改为处理中
 	tp.updateTaskProgress(ctx, task, 0)
 
+	// 相同输入和转换参数已有输出时直接复用，不再运行ffmpeg
+	if tp.reuseOutput(ctx, task) {
+		return
+	}
+
+	// 输入文件不在本地时暂存到临时目录供ffmpeg读取
+	inputPath, cleanupInput, err := objectstore.Fetch(taskCtx, tp.store, task.InputPath, tp.tempDir)
+	if err != nil {
+		tp.failTask(ctx, task, fmt.Sprintf("获取输入文件失败: %v", err))
+		return
+	}
+	defer cleanupInput()
+
 	// 验证输入文件
-	if err := tp.ffmpegConverter.ValidateInput(task.InputPath); err != nil {
+	if err := tp.ffmpegConverter.ValidateInput(inputPath); err != nil {
 		tp.failTask(ctx, task, fmt.Sprintf("输入文件验证失败: %v", err))
 		return
 	}
 
-	// 生成输出文件路径
-	outputPath := tp.ffmpegConverter.GenerateOutputPath(task.InputPath, tp.outputDir)
+	// 根据输出格式生成输出文件路径，早期任务没有记录格式时按编码器推断
+	format, ok := converter.LookupOutputFormat(task.OutputFormat)
+	if !ok {
+		format, ok = converter.FormatForEncoder(task.AudioCodec)
+	}
+	if !ok {
+		tp.failTask(ctx, task, fmt.Sprintf("不支持的输出格式: %s", task.OutputFormat))
+		return
+	}
+	// ffmpeg先写到本地暂存路径，转换成功后再存入存储
+	// 去重后多个任务可能共享同一输入，输出文件名由任务ID生成，互不覆盖
+	outputKey := tp.ffmpegConverter.GenerateOutputPath(task.ID, tp.outputDir, format.Extension)
+	outputPath := objectstore.StagingPath(tp.store, outputKey, tp.tempDir)
 
 	// 获取视频信息
-	videoInfo, err := tp.ffmpegConverter.GetVideoInfo(task.InputPath)
+	videoInfo, err := tp.ffmpegConverter.GetVideoInfoContext(taskCtx, inputPath)
 	if err != nil {
-		log.Printf("获取视频信息失败: %v", err)
+		slog.WarnContext(ctx, "获取视频信息失败", "error", err)
 	} else {
 		// 更新数据库中的视频时长
 		task.Duration = videoInfo.Duration
-		tp.db.Model(task).Update("duration", videoInfo.Duration)
+		db.Model(task).Update("duration", videoInfo.Duration)
 	}
 
 	// 设置转换选项
 	options := &converter.ConversionOptions{
-		InputPath:    task.InputPath,
+		InputPath:    inputPath,
 		OutputPath:   outputPath,
 		AudioCodec:   task.AudioCodec,
 		AudioBitrate: task.AudioBitrate,
 		SampleRate:   task.SampleRate,
+		TrimStart:    task.TrimStart,
+		TrimEnd:      task.TrimEnd,
+		Normalize:    task.Normalize,
 		OnProgress: func(progress float64) {
 			// 更新进度
 			tp.updateTaskProgress(ctx, task, progress)
@@ -197,51 +406,155 @@ func (tp *TaskProcessor) processTask(workerID int, task *model.ConversionTask) {
 	}
 
 	// 执行转换
-	conversionCtx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	defer cancel()
-
-	err = tp.ffmpegConverter.ConvertToMP3(conversionCtx, options)
+	conversionCtx, cancelConversion := context.WithTimeout(taskCtx, 30*time.Minute)
+	defer cancelConversion()
+
+	startedAt := time.Now()
+	err = tp.ffmpegConverter.Convert(conversionCtx, options)
+	elapsed := time.Since(startedAt)
+	if taskCtx.Err() != nil {
+		// 被管理员强制取消，清理不完整的输出文件
+		metrics.ObserveConversion("canceled", elapsed, task.Duration)
+		os.Remove(outputPath)
+		tp.abandonTask(ctx, task, "")
+		return
+	}
 	if err != nil {
+		metrics.ObserveConversion("failed", elapsed, task.Duration)
+		os.Remove(outputPath)
 		tp.failTask(ctx, task, fmt.Sprintf("视频转换失败: %v", err))
 		return
 	}
+	metrics.ObserveConversion("success", elapsed, task.Duration)
+
+	// 获取输出文件大小和内容哈希，哈希用作下载的ETag
+	outputHash, outputSize, err := filemanager.HashFile(outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		tp.failTask(ctx, task, fmt.Sprintf("读取输出文件失败: %v", err))
+		return
+	}
+
+	// 输出存入存储
+	if err := tp.store.PutFile(taskCtx, outputKey, outputPath); err != nil {
+		os.Remove(outputPath)
+		tp.failTask(ctx, task, fmt.Sprintf("保存输出文件失败: %v", err))
+		return
+	}
 
 	// 转换成功，更新任务
-	task.OutputPath = outputPath
+	task.OutputPath = outputKey
+	task.OutputSize = outputSize
+	task.OutputHash = outputHash
 	task.Progress = 100
 	task.Status = model.TaskStatusCompleted
-	task.UpdatedAt = time.Now()
 
-	// 获取输出文件大小
-	if outputFileInfo, err := os.Stat(outputPath); err == nil {
-		task.OutputSize = outputFileInfo.Size()
+	// 登记输出文件，供相同输入和转换参数的任务复用
+	if !tp.registerOutput(ctx, task) {
+		return
 	}
 
-	if err := tp.db.Save(task).Error; err != nil {
-		log.Printf("更新任务状态失败: %v", err)
+	if err := tp.finishTask(ctx, task); errors.Is(err, errTaskNotProcessing) {
+		// 保存输出期间被取消，释放已保存的输出
+		tp.abandonTask(ctx, task, outputKey)
+		return
+	} else if err != nil {
+		slog.ErrorContext(ctx, "更新任务状态失败", "error", err)
 	}
+	metrics.TasksFinished.WithLabelValues(string(model.TaskStatusCompleted)).Inc()
+	tp.redisManager.SetTaskProgress(ctx, task.ID, 100)
 
-	// 更新Redis状态
-	tp.redisManager.SetTaskStatus(ctx, task.ID, string(model.TaskStatusCompleted))
+	slog.InfoContext(ctx, "任务转换完成", "worker_id", workerID,
+		"elapsed_ms", elapsed.Milliseconds(), "output_size", task.OutputSize)
+}
+
+// reuseOutput 复用相同输入和转换参数的已有输出，返回任务是否已处理完毕
+func (tp *TaskProcessor) reuseOutput(ctx context.Context, task *model.ConversionTask) bool {
+	key := task.OutputKey()
+	if key == "" {
+		return false
+	}
+
+	blob, err := tp.blobStore.AcquireOutput(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "查找可复用的输出失败", "error", err)
+		return false
+	}
+	if blob == nil {
+		return false
+	}
+
+	task.OutputPath = blob.Path
+	task.OutputSize = blob.Size
+	task.OutputHash = blob.ContentHash
+	task.Progress = 100
+	task.Status = model.TaskStatusCompleted
+	if err := tp.finishTask(ctx, task); errors.Is(err, errTaskNotProcessing) {
+		tp.abandonTask(ctx, task, blob.Path)
+		return true
+	} else if err != nil {
+		slog.ErrorContext(ctx, "更新任务状态失败", "error", err)
+	}
+
+	metrics.TasksFinished.WithLabelValues(string(model.TaskStatusCompleted)).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("task.output_reused", true))
 	tp.redisManager.SetTaskProgress(ctx, task.ID, 100)
 
-	log.Printf("Worker %d 完成任务 %s", workerID, task.ID)
+	slog.InfoContext(ctx, "复用已有的转换结果", "output", blob.Path)
+	return true
+}
+
+// registerOutput 登记任务的输出文件，返回任务是否继续写入本次的转换结果
+// 未登记的输出释放时会被直接删除，不能与其他任务共享；相同参数的任务同时完成时只有一个能登记成功，
+// 其余的删除自己的输出，改为复用已登记的输出，仍无法复用时任务失败
+func (tp *TaskProcessor) registerOutput(ctx context.Context, task *model.ConversionTask) bool {
+	key := task.OutputKey()
+	if key == "" {
+		return true
+	}
+	err := tp.blobStore.RegisterOutput(ctx, key, task.OutputPath, task.OutputSize, task.OutputHash)
+	if err == nil {
+		return true
+	}
+
+	slog.WarnContext(ctx, "登记输出文件失败，删除本次的输出", "path", task.OutputPath, "error", err)
+	if err := tp.store.Delete(ctx, task.OutputPath); err != nil {
+		slog.WarnContext(ctx, "删除未登记的输出失败", "path", task.OutputPath, "error", err)
+	}
+	task.OutputPath = ""
+	task.OutputSize = 0
+	task.OutputHash = ""
+	task.Progress = 0
+
+	if !tp.reuseOutput(ctx, task) {
+		tp.failTask(ctx, task, fmt.Sprintf("登记输出文件失败: %v", err))
+	}
+	return false
+}
+
+// takeQueuedAt 取出并清除任务进入队列的时间
+func (tp *TaskProcessor) takeQueuedAt(taskID string) time.Time {
+	tp.activeMu.Lock()
+	defer tp.activeMu.Unlock()
+
+	queuedAt := tp.queuedAt[taskID]
+	delete(tp.queuedAt, taskID)
+	return queuedAt
 }
 
 // updateTaskStatus 更新任务状态
-func (tp *TaskProcessor) updateTaskStatus(task *model.ConversionTask, status model.TaskStatus) {
+func (tp *TaskProcessor) updateTaskStatus(ctx context.Context, task *model.ConversionTask, status model.TaskStatus) {
 	task.Status = status
 	task.UpdatedAt = time.Now()
 
-	if err := tp.db.Model(task).Updates(map[string]interface{}{
+	if err := tp.db.WithContext(ctx).Model(task).Updates(map[string]interface{}{
 		"status":     status,
 		"updated_at": task.UpdatedAt,
 	}).Error; err != nil {
-		log.Printf("更新任务状态失败: %v", err)
+		slog.ErrorContext(ctx, "更新任务状态失败", "status", status, "error", err)
 	}
 
 	// 同时更新Redis
-	ctx := context.Background()
 	tp.redisManager.SetTaskStatus(ctx, task.ID, string(status))
 }
 
@@ -254,25 +567,70 @@ func (tp *TaskProcessor) updateTaskProgress(ctx context.Context, task *model.Con
 	if int(progress)%10 == 0 || progress >= 100 {
 		task.Progress = progress
 		task.UpdatedAt = time.Now()
-		tp.db.Model(task).Updates(map[string]interface{}{
+		tp.db.WithContext(ctx).Model(task).Updates(map[string]interface{}{
 			"progress":   progress,
 			"updated_at": task.UpdatedAt,
 		})
 	}
 }
 
-// failTask 标记任务失败
-func (tp *TaskProcessor) failTask(ctx context.Context, task *model.ConversionTask, errorMsg string) {
-	log.Printf("任务 %s 失败: %s", task.ID, errorMsg)
+// errTaskNotProcessing 任务已不在处理中（处理期间被取消或删除），不再写入处理结果
+var errTaskNotProcessing = errors.New("任务已不在处理中")
 
+// finishTask 写入任务的最终状态和结果，只在任务仍处于处理中时生效
+// 任务已被取消或删除时返回 errTaskNotProcessing
+func (tp *TaskProcessor) finishTask(ctx context.Context, task *model.ConversionTask) error {
+	task.UpdatedAt = time.Now()
+	result := tp.db.WithContext(ctx).Model(&model.ConversionTask{}).
+		Where("id = ? AND status = ?", task.ID, model.TaskStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":        task.Status,
+			"progress":      task.Progress,
+			"output_path":   task.OutputPath,
+			"output_size":   task.OutputSize,
+			"output_hash":   task.OutputHash,
+			"error_message": task.ErrorMessage,
+			"updated_at":    task.UpdatedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTaskNotProcessing
+	}
+
+	// 更新Redis状态
+	tp.redisManager.SetTaskStatus(ctx, task.ID, string(task.Status))
+	return nil
+}
+
+// abandonTask 放弃已被取消或删除的任务，释放已保存的输出，不再修改任务记录
+func (tp *TaskProcessor) abandonTask(ctx context.Context, task *model.ConversionTask, outputPath string) {
+	metrics.TasksFinished.WithLabelValues(string(model.TaskStatusCanceled)).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("task.canceled", true))
+
+	if err := tp.blobStore.Release(ctx, outputPath); err != nil {
+		slog.WarnContext(ctx, "释放已取消任务的输出失败", "path", outputPath, "error", err)
+	}
+	slog.InfoContext(ctx, "任务已被取消，放弃处理结果")
+}
+
+// failTask 标记任务失败，任务已被取消时放弃处理
+func (tp *TaskProcessor) failTask(ctx context.Context, task *model.ConversionTask, errorMsg string) {
 	task.Status = model.TaskStatusFailed
 	task.ErrorMessage = errorMsg
-	task.UpdatedAt = time.Now()
 
-	if err := tp.db.Save(task).Error; err != nil {
-		log.Printf("更新失败任务状态失败: %v", err)
+	err := tp.finishTask(ctx, task)
+	if errors.Is(err, errTaskNotProcessing) {
+		// 取消会中断正在进行的操作，由此产生的错误不记为失败
+		tp.abandonTask(ctx, task, "")
+		return
 	}
 
-	// 更新Redis状态
-	tp.redisManager.SetTaskStatus(ctx, task.ID, string(model.TaskStatusFailed))
+	slog.ErrorContext(ctx, "任务失败", "error", errorMsg)
+	metrics.TasksFinished.WithLabelValues(string(model.TaskStatusFailed)).Inc()
+	tracing.RecordError(trace.SpanFromContext(ctx), errors.New(errorMsg))
+	if err != nil {
+		slog.ErrorContext(ctx, "更新失败任务状态失败", "error", err)
+	}
 }
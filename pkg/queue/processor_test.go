@@ -0,0 +1,285 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-converter/internal/config"
+	"video-converter/internal/model"
+	"video-converter/internal/storage"
+	"video-converter/pkg/converter"
+	"video-converter/pkg/objectstore"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// newTestProcessor 创建使用SQLite、miniredis和本地存储的任务处理器，不启动worker
+func newTestProcessor(t *testing.T) (*TaskProcessor, *gorm.DB) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.ConversionTask{}, &model.FileBlob{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	dir := t.TempDir()
+	tp := NewTaskProcessor(db, storage.NewRedisManager(client), converter.NewFFmpegConverter(&config.FFmpegConfig{}), objectstore.NewLocalStore(),
+		filepath.Join(dir, "outputs"), filepath.Join(dir, "temp"), 1)
+	return tp, db
+}
+
+// createTestTask 创建任务记录
+func createTestTask(t *testing.T, db *gorm.DB, task *model.ConversionTask) {
+	t.Helper()
+	if task.UserID == "" {
+		task.UserID = "user"
+	}
+	if err := db.Create(task).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func taskStatus(t *testing.T, db *gorm.DB, id string) model.TaskStatus {
+	t.Helper()
+	var task model.ConversionTask
+	if err := db.First(&task, "id = ?", id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return task.Status
+}
+
+func TestFailTaskKeepsCancel(t *testing.T) {
+	tp, db := newTestProcessor(t)
+	ctx := context.Background()
+
+	processing := &model.ConversionTask{ID: "processing", Status: model.TaskStatusProcessing}
+	canceled := &model.ConversionTask{ID: "canceled", Status: model.TaskStatusCanceled}
+	createTestTask(t, db, processing)
+	createTestTask(t, db, canceled)
+
+	// worker持有的是领取时的任务记录，取消后状态仍为处理中
+	stale := *canceled
+	stale.Status = model.TaskStatusProcessing
+
+	tp.failTask(ctx, processing, "失败")
+	tp.failTask(ctx, &stale, "获取输入文件失败: context canceled")
+
+	if got := taskStatus(t, db, processing.ID); got != model.TaskStatusFailed {
+		t.Errorf("处理中的任务状态 = %s，应为 failed", got)
+	}
+	if got := taskStatus(t, db, canceled.ID); got != model.TaskStatusCanceled {
+		t.Errorf("已取消的任务状态 = %s，应保持 canceled", got)
+	}
+}
+
+func TestReuseOutputAfterCancel(t *testing.T) {
+	tp, db := newTestProcessor(t)
+	ctx := context.Background()
+
+	output := filepath.Join(t.TempDir(), "shared.mp3")
+	if err := os.WriteFile(output, []byte("output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := &model.ConversionTask{ID: "owner", Status: model.TaskStatusCompleted, InputHash: "input", OutputFormat: "mp3", OutputPath: output}
+	createTestTask(t, db, owner)
+	if err := tp.blobStore.RegisterOutput(ctx, owner.OutputKey(), output, 6, "content"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 相同参数的任务在复用输出前被取消
+	task := &model.ConversionTask{ID: "reuser", Status: model.TaskStatusCanceled, InputHash: "input", OutputFormat: "mp3"}
+	createTestTask(t, db, task)
+	task.Status = model.TaskStatusProcessing
+
+	if !tp.reuseOutput(ctx, task) {
+		t.Fatal("应找到可复用的输出")
+	}
+	if got := taskStatus(t, db, task.ID); got != model.TaskStatusCanceled {
+		t.Errorf("任务状态 = %s，应保持 canceled", got)
+	}
+
+	// 取消的任务不持有引用，原任务释放后文件被删除
+	var blob model.FileBlob
+	if err := db.First(&blob, "path = ?", output).Error; err != nil || blob.RefCount != 1 {
+		t.Fatalf("引用计数 = %d (%v)，应为 1", blob.RefCount, err)
+	}
+	if err := tp.blobStore.Release(ctx, output); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("最后一个引用释放后输出文件仍存在")
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	tp, _ := newTestProcessor(t)
+
+	if tp.CancelTask("idle") {
+		t.Error("没有在处理的任务不应返回true")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tp.beginTask(0, "running", cancel)
+	if !tp.CancelTask("running") {
+		t.Error("正在处理的任务应返回true")
+	}
+	if ctx.Err() == nil {
+		t.Error("取消函数没有被调用")
+	}
+	tp.endTask(0, "running")
+	if tp.CancelTask("running") || tp.Stats().BusyWorkers != 0 {
+		t.Error("任务结束后登记没有清除")
+	}
+}
+
+func TestFinishTaskKeepsOwner(t *testing.T) {
+	tp, db := newTestProcessor(t)
+
+	task := &model.ConversionTask{ID: "claimed", Status: model.TaskStatusProcessing, UserID: "anonymous", AnonymousID: "visitor"}
+	createTestTask(t, db, task)
+
+	// 转换期间访客登录并认领了任务，worker持有的记录仍是匿名用户
+	if err := db.Model(&model.ConversionTask{}).Where("id = ?", task.ID).
+		Updates(map[string]interface{}{"user_id": "member", "anonymous_id": ""}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	task.Status = model.TaskStatusCompleted
+	task.OutputPath = "output.mp3"
+	task.Progress = 100
+	if err := tp.finishTask(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored model.ConversionTask
+	db.First(&stored, "id = ?", task.ID)
+	if stored.UserID != "member" || stored.AnonymousID != "" {
+		t.Errorf("user_id=%q anonymous_id=%q，应保持认领后的归属", stored.UserID, stored.AnonymousID)
+	}
+	if stored.Status != model.TaskStatusCompleted || stored.OutputPath != "output.mp3" {
+		t.Errorf("status=%s output_path=%q", stored.Status, stored.OutputPath)
+	}
+}
+
+// writeTaskOutput 在任务的输出路径写入转换结果，模拟转换完成
+func writeTaskOutput(t *testing.T, tp *TaskProcessor, task *model.ConversionTask, content string) {
+	t.Helper()
+	task.OutputPath = tp.ffmpegConverter.GenerateOutputPath(task.ID, tp.outputDir, ".mp3")
+	if err := os.MkdirAll(filepath.Dir(task.OutputPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(task.OutputPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	task.OutputSize = int64(len(content))
+	task.OutputHash = content
+	task.Progress = 100
+	task.Status = model.TaskStatusCompleted
+}
+
+func TestOutputsOfTasksSharingInput(t *testing.T) {
+	tp, db := newTestProcessor(t)
+	ctx := context.Background()
+
+	// 去重后的两个任务共享同一输入，转换参数不同，在同一秒内完成
+	shared := model.ConversionTask{Status: model.TaskStatusProcessing, InputPath: "uploads/shared.mp4", InputHash: "input", OutputFormat: "mp3"}
+	first, second := shared, shared
+	first.ID, first.AudioBitrate = "first", "128k"
+	second.ID, second.AudioBitrate = "second", "320k"
+	createTestTask(t, db, &first)
+	createTestTask(t, db, &second)
+
+	writeTaskOutput(t, tp, &first, "first-output")
+	writeTaskOutput(t, tp, &second, "second-output")
+	if first.OutputPath == second.OutputPath {
+		t.Fatalf("两个任务的输出路径相同: %s", first.OutputPath)
+	}
+	for _, task := range []*model.ConversionTask{&first, &second} {
+		if !tp.registerOutput(ctx, task) {
+			t.Fatalf("任务 %s 登记输出失败", task.ID)
+		}
+		if err := tp.finishTask(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 释放一个任务的输出不影响另一个任务
+	if err := tp.blobStore.Release(ctx, first.OutputPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(second.OutputPath)
+	if err != nil || string(data) != "second-output" {
+		t.Errorf("另一个任务的输出 = %q, %v", data, err)
+	}
+}
+
+func TestRegisterOutputConflict(t *testing.T) {
+	tp, db := newTestProcessor(t)
+	ctx := context.Background()
+
+	// 相同输入和转换参数的两个任务同时完成，只有一个能登记
+	shared := model.ConversionTask{Status: model.TaskStatusProcessing, InputPath: "uploads/shared.mp4", InputHash: "input", OutputFormat: "mp3"}
+	winner, loser := shared, shared
+	winner.ID, loser.ID = "winner", "loser"
+	createTestTask(t, db, &winner)
+	createTestTask(t, db, &loser)
+	writeTaskOutput(t, tp, &winner, "winner-output")
+	writeTaskOutput(t, tp, &loser, "loser-output")
+	loserOutput := loser.OutputPath
+
+	if !tp.registerOutput(ctx, &winner) {
+		t.Fatal("第一个任务应登记成功")
+	}
+	if err := tp.finishTask(ctx, &winner); err != nil {
+		t.Fatal(err)
+	}
+	if tp.registerOutput(ctx, &loser) {
+		t.Fatal("第二个任务不应使用未登记的输出")
+	}
+
+	// 第二个任务改为复用已登记的输出，自己的输出被删除
+	var stored model.ConversionTask
+	db.First(&stored, "id = ?", loser.ID)
+	if stored.Status != model.TaskStatusCompleted || stored.OutputPath != winner.OutputPath {
+		t.Errorf("status=%s output_path=%s，应复用 %s", stored.Status, stored.OutputPath, winner.OutputPath)
+	}
+	if _, err := os.Stat(loserOutput); !os.IsNotExist(err) {
+		t.Error("未登记的输出没有删除")
+	}
+
+	// 两个任务都释放后才删除共享的输出
+	if err := tp.blobStore.Release(ctx, winner.OutputPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(winner.OutputPath); err != nil {
+		t.Fatalf("仍被引用的输出被删除: %v", err)
+	}
+	if err := tp.blobStore.Release(ctx, stored.OutputPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(winner.OutputPath); !os.IsNotExist(err) {
+		t.Error("最后一个引用释放后输出仍存在")
+	}
+}
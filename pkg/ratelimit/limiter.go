@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript 令牌桶算法，读取、补充、扣减在同一个Lua脚本中原子完成
+// 使用Redis服务器时间，避免多实例之间时钟不一致
+//
+// KEYS[1] 桶的键
+// ARGV[1] 桶容量（突发上限）
+// ARGV[2] 每秒补充的令牌数
+// ARGV[3] 本次请求消耗的令牌数
+//
+// 返回 {是否允许, 剩余令牌, 需等待的毫秒数, 桶补满需要的毫秒数}
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+
+local elapsed = math.max(0, now - ts)
+tokens = math.min(capacity, tokens + elapsed * rate / 1000)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+else
+  retry_after = math.ceil((cost - tokens) * 1000 / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity * 1000 / rate) + 1000)
+
+local reset = math.ceil((capacity - tokens) * 1000 / rate)
+return {allowed, math.floor(tokens), retry_after, reset}
+`)
+
+// Policy 限流策略：每Period补充Limit个令牌，最多积累Burst个
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// ratePerSecond 每秒补充的令牌数
+func (p Policy) ratePerSecond() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// capacity 桶容量
+func (p Policy) capacity() int {
+	if p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// Result 限流判定结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 桶容量
+	Remaining  int           // 剩余令牌
+	RetryAfter time.Duration // 被拒绝时需要等待的时间
+	Reset      time.Duration // 桶补满需要的时间
+}
+
+// Limiter 基于Redis的分布式令牌桶限流器
+type Limiter struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewLimiter 创建限流器
+func NewLimiter(client *redis.Client, prefix string) *Limiter {
+	if prefix == "" {
+		prefix = "rate_limit"
+	}
+	return &Limiter{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Allow 尝试从key对应的桶中扣除cost个令牌
+func (l *Limiter) Allow(ctx context.Context, key string, policy Policy, cost int) (*Result, error) {
+	if cost < 1 {
+		cost = 1
+	}
+
+	capacity := policy.capacity()
+	bucketKey := fmt.Sprintf("%s:%s:%s", l.prefix, policy.Name, key)
+
+	values, err := tokenBucketScript.Run(ctx, l.client, []string{bucketKey},
+		capacity,
+		strconv.FormatFloat(policy.ratePerSecond(), 'f', -1, 64),
+		cost,
+	).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("执行限流脚本失败: %v", err)
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("限流脚本返回值异常: %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	retryAfter, _ := values[2].(int64)
+	reset, _ := values[3].(int64)
+
+	return &Result{
+		Allowed:    allowed == 1,
+		Limit:      capacity,
+		Remaining:  int(remaining),
+		RetryAfter: time.Duration(retryAfter) * time.Millisecond,
+		Reset:      time.Duration(reset) * time.Millisecond,
+	}, nil
+}
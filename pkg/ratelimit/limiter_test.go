@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1700000000, 0))
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewLimiter(client, ""), mr
+}
+
+func TestLimiterAllow(t *testing.T) {
+	// 每秒补充1个令牌，最多积累3个
+	policy := Policy{Name: "test", Limit: 1, Period: time.Second, Burst: 3}
+
+	tests := []struct {
+		name          string
+		advance       time.Duration // 请求前经过的时间
+		cost          int
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "新桶是满的", cost: 1, wantAllowed: true, wantRemaining: 2},
+		{name: "消耗突发容量", cost: 2, wantAllowed: true, wantRemaining: 0},
+		{name: "令牌用完后拒绝", cost: 1, wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		{name: "补充一个令牌", advance: time.Second, cost: 1, wantAllowed: true, wantRemaining: 0},
+		{name: "不足时按缺少的令牌计算等待时间", advance: 500 * time.Millisecond, cost: 2, wantAllowed: false, wantRemaining: 0, wantRetry: 1500 * time.Millisecond},
+		{name: "补充不超过容量", advance: time.Hour, cost: 1, wantAllowed: true, wantRemaining: 2},
+		{name: "cost小于1按1计算", cost: 0, wantAllowed: true, wantRemaining: 1},
+	}
+
+	limiter, mr := newTestLimiter(t)
+	now := time.Unix(1700000000, 0)
+	for _, tt := range tests {
+		now = now.Add(tt.advance)
+		mr.SetTime(now)
+
+		result, err := limiter.Allow(context.Background(), "client", policy, tt.cost)
+		if err != nil {
+			t.Fatalf("%s: Allow 失败: %v", tt.name, err)
+		}
+		if result.Allowed != tt.wantAllowed || result.Remaining != tt.wantRemaining || result.RetryAfter != tt.wantRetry {
+			t.Errorf("%s: allowed=%v remaining=%d retry=%v，应为 allowed=%v remaining=%d retry=%v",
+				tt.name, result.Allowed, result.Remaining, result.RetryAfter,
+				tt.wantAllowed, tt.wantRemaining, tt.wantRetry)
+		}
+		if result.Limit != 3 {
+			t.Errorf("%s: limit = %d，应为 3", tt.name, result.Limit)
+		}
+	}
+}
+
+func TestLimiterSeparatesKeysAndPolicies(t *testing.T) {
+	limiter, _ := newTestLimiter(t)
+	ctx := context.Background()
+	upload := Policy{Name: "upload", Limit: 1, Period: time.Minute}
+	api := Policy{Name: "api", Limit: 1, Period: time.Minute}
+
+	for _, step := range []struct {
+		key    string
+		policy Policy
+		want   bool
+	}{
+		{"a", upload, true},
+		{"a", upload, false},
+		{"b", upload, true},
+		{"a", api, true},
+	} {
+		result, err := limiter.Allow(ctx, step.key, step.policy, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != step.want {
+			t.Errorf("key=%s policy=%s allowed=%v，应为 %v", step.key, step.policy.Name, result.Allowed, step.want)
+		}
+	}
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	limiter, _ := newTestLimiter(t)
+	policy := Policy{Name: "burst", Limit: 1, Period: time.Hour, Burst: 10}
+
+	// 并发请求不能超过桶容量
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := limiter.Allow(context.Background(), "client", policy, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if result.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("允许的请求数 = %d，应为 10", allowed)
+	}
+}
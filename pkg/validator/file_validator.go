@@ -1,19 +1,29 @@
 package validator
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"video-converter/pkg/converter"
 )
 
 // FileValidator 文件验证器
 type FileValidator struct {
 	MaxFileSize  int64    // 最大文件大小（字节）
-	AllowedTypes []string // 允许的MIME类型
+	AllowedTypes []string // 允许的MIME类型，与内容识别出的类型比较
 	AllowedExts  []string // 允许的文件扩展名
+
+	prober *converter.FFmpegConverter // 深度验证使用的ffprobe，未启用时为nil
 }
 
+// probeTimeout 深度验证时ffprobe的超时时间
+const probeTimeout = 30 * time.Second
+
 // ValidationError 验证错误
 type ValidationError struct {
 	Field   string `json:"field"`
@@ -26,26 +36,25 @@ func (e ValidationError) Error() string {
 
 // ValidationResult 验证结果
 type ValidationResult struct {
-	Valid  bool              `json:"valid"`
-	Errors []ValidationError `json:"errors,omitempty"`
+	Valid       bool              `json:"valid"`
+	Errors      []ValidationError `json:"errors,omitempty"`
+	ContentType string            `json:"content_type,omitempty"` // 内容验证识别出的MIME类型
 }
 
 // NewFileValidator 创建文件验证器
 func NewFileValidator(maxSize int64, allowedTypes []string) *FileValidator {
-	// 默认允许的视频文件扩展名
+	// 默认允许的视频、音频文件扩展名
 	allowedExts := []string{
 		".mp4", ".avi", ".mov", ".wmv", ".flv", ".webm",
 		".mkv", ".m4v", ".3gp", ".asf", ".rm", ".rmvb",
+		".ts", ".mts", ".m2ts", ".mpg", ".mpeg", ".vob",
+		".wav", ".flac", ".m4a", ".ogg", ".oga", ".opus",
+		".amr", ".mp3", ".aac", ".wma", ".caf",
 	}
 
-	// 如果没有指定允许的MIME类型，使用默认的
+	// 如果没有指定允许的MIME类型，允许所有可识别的封装格式
 	if len(allowedTypes) == 0 {
-		allowedTypes = []string{
-			"video/mp4", "video/avi", "video/mov", "video/wmv",
-			"video/flv", "video/webm", "video/mkv", "video/m4v",
-			"video/quicktime", "video/x-msvideo", "video/x-ms-wmv",
-			"application/octet-stream", // 通用二进制文件类型
-		}
+		allowedTypes = SniffedMimeTypes
 	}
 
 	return &FileValidator{
@@ -57,10 +66,15 @@ func NewFileValidator(maxSize int64, allowedTypes []string) *FileValidator {
 
 // ValidateFile 验证上传的文件
 func (fv *FileValidator) ValidateFile(fileHeader *multipart.FileHeader) ValidationResult {
+	return fv.ValidateFileName(fileHeader.Filename, fileHeader.Size)
+}
+
+// ValidateFileName 根据文件名和大小验证文件，用于内容尚未到达时（如断点续传创建上传）
+func (fv *FileValidator) ValidateFileName(filename string, size int64) ValidationResult {
 	var errors []ValidationError
 
 	// 1. 检查文件大小
-	if fileHeader.Size > fv.MaxFileSize {
+	if size > fv.MaxFileSize {
 		errors = append(errors, ValidationError{
 			Field:   "file_size",
 			Message: fmt.Sprintf("文件大小超过限制，最大允许 %d MB", fv.MaxFileSize/(1024*1024)),
@@ -68,7 +82,7 @@ func (fv *FileValidator) ValidateFile(fileHeader *multipart.FileHeader) Validati
 	}
 
 	// 2. 检查文件扩展名
-	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	ext := strings.ToLower(filepath.Ext(filename))
 	if !fv.isAllowedExtension(ext) {
 		errors = append(errors, ValidationError{
 			Field:   "file_extension",
@@ -77,7 +91,7 @@ func (fv *FileValidator) ValidateFile(fileHeader *multipart.FileHeader) Validati
 	}
 
 	// 3. 检查文件名
-	if fileHeader.Filename == "" {
+	if filename == "" {
 		errors = append(errors, ValidationError{
 			Field:   "filename",
 			Message: "文件名不能为空",
@@ -85,7 +99,7 @@ func (fv *FileValidator) ValidateFile(fileHeader *multipart.FileHeader) Validati
 	}
 
 	// 4. 检查文件名长度
-	if len(fileHeader.Filename) > 255 {
+	if len(filename) > 255 {
 		errors = append(errors, ValidationError{
 			Field:   "filename",
 			Message: "文件名长度不能超过255个字符",
@@ -93,7 +107,7 @@ func (fv *FileValidator) ValidateFile(fileHeader *multipart.FileHeader) Validati
 	}
 
 	// 5. 检查文件名中的非法字符
-	if fv.hasIllegalChars(fileHeader.Filename) {
+	if fv.hasIllegalChars(filename) {
 		errors = append(errors, ValidationError{
 			Field:   "filename",
 			Message: "文件名包含非法字符",
@@ -107,13 +121,29 @@ func (fv *FileValidator) ValidateFile(fileHeader *multipart.FileHeader) Validati
 }
 
 // ValidateFileContent 验证文件内容（通过文件头判断真实类型）
-func (fv *FileValidator) ValidateFileContent(file multipart.File) ValidationResult {
-	var errors []ValidationError
-
+func (fv *FileValidator) ValidateFileContent(file multipart.File, filename string) ValidationResult {
 	// 读取文件头（前512字节）用于检测文件类型
 	buffer := make([]byte, 512)
-	_, err := file.Read(buffer)
-	if err != nil {
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && n == 0 {
+		return ValidationResult{Valid: false, Errors: []ValidationError{{
+			Field:   "file_content",
+			Message: "无法读取文件内容",
+		}}}
+	}
+
+	// 重置文件指针到开始位置
+	file.Seek(0, 0)
+
+	return fv.ValidateFileHeader(buffer[:n], filename)
+}
+
+// ValidateFileHeader 根据已读取的文件头验证文件内容，用于无法回退读取位置的数据流
+// 文件头无法识别为音视频封装格式、识别出的类型不在允许的MIME类型中，或与扩展名不符时验证失败
+func (fv *FileValidator) ValidateFileHeader(header []byte, filename string) ValidationResult {
+	var errors []ValidationError
+
+	if len(header) == 0 {
 		errors = append(errors, ValidationError{
 			Field:   "file_content",
 			Message: "无法读取文件内容",
@@ -121,20 +151,64 @@ func (fv *FileValidator) ValidateFileContent(file multipart.File) ValidationResu
 		return ValidationResult{Valid: false, Errors: errors}
 	}
 
-	// 重置文件指针到开始位置
-	file.Seek(0, 0)
+	container := SniffContainer(header)
+	if container == nil {
+		errors = append(errors, ValidationError{
+			Field:   "file_content",
+			Message: "无法识别文件格式，文件可能已损坏或不是音视频文件",
+		})
+		return ValidationResult{Valid: false, Errors: errors}
+	}
 
-	// 检测文件类型
-	contentType := fv.detectContentType(buffer)
+	if !fv.isAllowedType(container.MimeType) {
+		errors = append(errors, ValidationError{
+			Field:   "file_type",
+			Message: fmt.Sprintf("不允许上传的文件类型: %s", container.MimeType),
+		})
+	}
 
-	// 对于个人项目，我们采用更宽松的验证策略
-	// 只要文件扩展名正确，就允许通过
-	if !fv.isAllowedContentType(contentType) {
-		// 不直接拒绝，而是给出警告但允许继续
-		// errors = append(errors, ValidationError{
-		// 	Field:   "content_type",
-		// 	Message: fmt.Sprintf("不支持的文件类型: %s", contentType),
-		// })
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !container.Matches(ext) {
+		errors = append(errors, ValidationError{
+			Field:   "file_extension",
+			Message: fmt.Sprintf("文件扩展名 %s 与实际格式 %s 不符", ext, container.Name),
+		})
+	}
+
+	return ValidationResult{
+		Valid:       len(errors) == 0,
+		Errors:      errors,
+		ContentType: container.MimeType,
+	}
+}
+
+// EnableDeepValidation 启用基于ffprobe的深度验证
+func (fv *FileValidator) EnableDeepValidation(prober *converter.FFmpegConverter) {
+	fv.prober = prober
+}
+
+// ValidateMedia 深度验证：用ffprobe完整解析已保存的文件，确认其可以被转换
+// 文件头正确但内容损坏的文件在这里被拒绝，而不是在转换时才失败；未启用深度验证时直接通过
+func (fv *FileValidator) ValidateMedia(ctx context.Context, filePath string) ValidationResult {
+	if fv.prober == nil {
+		return ValidationResult{Valid: true}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var errors []ValidationError
+	probe, err := fv.prober.Probe(ctx, filePath)
+	if err != nil {
+		errors = append(errors, ValidationError{
+			Field:   "file_content",
+			Message: fmt.Sprintf("文件无法解析: %v", err),
+		})
+	} else if probe.AudioStreams() == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "file_content",
+			Message: "文件不包含音频流，无法转换",
+		})
 	}
 
 	return ValidationResult{
@@ -153,10 +227,10 @@ func (fv *FileValidator) isAllowedExtension(ext string) bool {
 	return false
 }
 
-// isAllowedContentType 检查是否为允许的MIME类型
-func (fv *FileValidator) isAllowedContentType(contentType string) bool {
+// isAllowedType 检查是否为允许的MIME类型
+func (fv *FileValidator) isAllowedType(mimeType string) bool {
 	for _, allowedType := range fv.AllowedTypes {
-		if strings.HasPrefix(contentType, allowedType) {
+		if strings.EqualFold(mimeType, allowedType) {
 			return true
 		}
 	}
@@ -174,30 +248,6 @@ func (fv *FileValidator) hasIllegalChars(filename string) bool {
 	return false
 }
 
-// detectContentType 检测文件的真实类型
-func (fv *FileValidator) detectContentType(buffer []byte) string {
-	// 对于个人项目，简化检测逻辑
-	// 只要文件扩展名匹配，就认为是有效的视频文件
-
-	// QuickTime/MOV格式检查
-	if len(buffer) >= 8 {
-		ftypStr := string(buffer[4:8])
-		if ftypStr == "ftyp" || ftypStr == "moov" || ftypStr == "mdat" {
-			return "video/mp4" // 统一返回mp4类型
-		}
-	}
-
-	// RIFF格式检查 (AVI)
-	if len(buffer) >= 4 && string(buffer[0:4]) == "RIFF" {
-		return "video/avi"
-	}
-
-	// 默认返回mp4类型
-	return "video/mp4"
-}
-
-// 移除之前有问题的辅助函数
-
 // GetMaxSizeText 获取最大文件大小的可读文本
 func (fv *FileValidator) GetMaxSizeText() string {
 	mb := fv.MaxFileSize / (1024 * 1024)
@@ -0,0 +1,44 @@
+package validator
+
+import (
+	"testing"
+)
+
+func TestValidateFileHeaderAllowedTypes(t *testing.T) {
+	mp4Header := append([]byte{0x00, 0x00, 0x00, 0x18}, []byte("ftypisom\x00\x00\x02\x00isomiso2")...)
+	wavHeader := []byte("RIFF\x24\x00\x00\x00WAVEfmt ")
+
+	tests := []struct {
+		name         string
+		allowedTypes []string
+		header       []byte
+		filename     string
+		wantValid    bool
+		wantType     string
+		wantField    string
+	}{
+		{name: "默认允许可识别的格式", header: mp4Header, filename: "a.mp4", wantValid: true, wantType: "video/mp4"},
+		{name: "类型在允许列表中", allowedTypes: []string{"audio/wav"}, header: wavHeader, filename: "a.wav", wantValid: true, wantType: "audio/wav"},
+		{name: "类型不在允许列表中", allowedTypes: []string{"audio/wav"}, header: mp4Header, filename: "a.mp4", wantField: "file_type"},
+		{name: "类型比较不区分大小写", allowedTypes: []string{"Video/MP4"}, header: mp4Header, filename: "a.mp4", wantValid: true, wantType: "video/mp4"},
+		{name: "扩展名与内容不符", header: wavHeader, filename: "a.mp4", wantField: "file_extension"},
+		{name: "无法识别的内容", header: []byte("<html><body></body></html>"), filename: "a.mp4", wantField: "file_content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fv := NewFileValidator(1<<20, tt.allowedTypes)
+			result := fv.ValidateFileHeader(tt.header, tt.filename)
+
+			if result.Valid != tt.wantValid {
+				t.Fatalf("Valid = %v，应为 %v，错误: %v", result.Valid, tt.wantValid, result.Errors)
+			}
+			if tt.wantValid && result.ContentType != tt.wantType {
+				t.Errorf("ContentType = %q，应为 %q", result.ContentType, tt.wantType)
+			}
+			if tt.wantField != "" && (len(result.Errors) == 0 || result.Errors[0].Field != tt.wantField) {
+				t.Errorf("错误 = %v，应包含字段 %s", result.Errors, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package validator
+
+import (
+	"bytes"
+)
+
+// Container 通过文件头识别出的封装格式
+type Container struct {
+	Name       string   // 封装格式名称
+	MimeType   string   // 标准MIME类型
+	Extensions []string // 与该格式相符的扩展名
+}
+
+// 同一家族的封装格式互相兼容，扩展名在家族内混用（如MP4改名为.mov）不视为不符
+var (
+	isoExtensions      = []string{".mp4", ".m4v", ".mov", ".3gp", ".3g2", ".m4a", ".m4b"}
+	matroskaExtensions = []string{".mkv", ".webm", ".mka"}
+	asfExtensions      = []string{".asf", ".wmv", ".wma"}
+	mpegTSExtensions   = []string{".ts", ".mts", ".m2ts"}
+	mpegPSExtensions   = []string{".mpg", ".mpeg", ".vob"}
+	realExtensions     = []string{".rm", ".rmvb"}
+	oggExtensions      = []string{".ogg", ".oga", ".opus"}
+	// ID3标签可以出现在MP3、AAC、FLAC之前，标签较大时无法在文件头中看到后面的数据
+	id3Extensions = []string{".mp3", ".aac", ".flac"}
+)
+
+var (
+	// asfHeaderGUID ASF头对象的GUID
+	asfHeaderGUID = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+	// ebmlMagic EBML头（Matroska/WebM）
+	ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+	// mpegPackStart MPEG-PS的pack头
+	mpegPackStart = []byte{0x00, 0x00, 0x01, 0xBA}
+	// mpegSequenceStart MPEG-1/2视频序列头（无封装的视频流）
+	mpegSequenceStart = []byte{0x00, 0x00, 0x01, 0xB3}
+)
+
+const (
+	id3HeaderSize      = 10
+	mpegTSPacketSize   = 188
+	mpegM2TSPacketSize = 192
+	mpegTSSyncByte     = 0x47
+)
+
+// SniffedMimeTypes SniffContainer 可能识别出的全部MIME类型，file.allowed_types 应从中选择
+var SniffedMimeTypes = []string{
+	"video/mp4", "video/quicktime", "video/3gpp", "video/webm", "video/x-matroska",
+	"video/x-msvideo", "video/x-flv", "video/x-ms-asf", "video/mpeg", "video/mp2t",
+	"application/vnd.rn-realmedia",
+	"audio/mp4", "audio/mpeg", "audio/aac", "audio/wav", "audio/flac", "audio/ogg",
+	"audio/amr", "audio/x-caf",
+}
+
+// SniffContainer 根据文件头识别封装格式，无法识别时返回nil
+// 文件头至少需要512字节才能可靠识别MPEG-TS
+func SniffContainer(header []byte) *Container {
+	switch {
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		return sniffISOBrand(string(header[8:12]))
+
+	case len(header) >= 8 && isQuickTimeAtom(string(header[4:8])):
+		// 早期QuickTime文件没有ftyp，直接以moov/mdat等原子开头
+		return &Container{Name: "mov", MimeType: "video/quicktime", Extensions: isoExtensions}
+
+	case bytes.HasPrefix(header, ebmlMagic):
+		// DocType在EBML头内，位于文件最开始的几十个字节
+		if bytes.Contains(header, []byte("webm")) {
+			return &Container{Name: "webm", MimeType: "video/webm", Extensions: matroskaExtensions}
+		}
+		return &Container{Name: "matroska", MimeType: "video/x-matroska", Extensions: matroskaExtensions}
+
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "AVI ":
+		return &Container{Name: "avi", MimeType: "video/x-msvideo", Extensions: []string{".avi"}}
+
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return &Container{Name: "wav", MimeType: "audio/wav", Extensions: []string{".wav"}}
+
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return &Container{Name: "flac", MimeType: "audio/flac", Extensions: []string{".flac"}}
+
+	case bytes.HasPrefix(header, []byte("OggS")):
+		// Opus的标识头位于第一个Ogg页的数据开头
+		if len(header) >= 36 && string(header[28:36]) == "OpusHead" {
+			return &Container{Name: "opus", MimeType: "audio/ogg", Extensions: oggExtensions}
+		}
+		return &Container{Name: "ogg", MimeType: "audio/ogg", Extensions: oggExtensions}
+
+	case bytes.HasPrefix(header, []byte("#!AMR")):
+		// 包括 "#!AMR\n" 和 "#!AMR-WB\n"
+		return &Container{Name: "amr", MimeType: "audio/amr", Extensions: []string{".amr"}}
+
+	case bytes.HasPrefix(header, []byte("caff")):
+		return &Container{Name: "caf", MimeType: "audio/x-caf", Extensions: []string{".caf"}}
+
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return sniffID3(header)
+
+	case len(header) >= 4 && string(header[0:3]) == "FLV" && header[3] == 0x01:
+		return &Container{Name: "flv", MimeType: "video/x-flv", Extensions: []string{".flv"}}
+
+	case bytes.HasPrefix(header, asfHeaderGUID):
+		return &Container{Name: "asf", MimeType: "video/x-ms-asf", Extensions: asfExtensions}
+
+	case bytes.HasPrefix(header, []byte(".RMF")):
+		return &Container{Name: "realmedia", MimeType: "application/vnd.rn-realmedia", Extensions: realExtensions}
+
+	case bytes.HasPrefix(header, mpegPackStart), bytes.HasPrefix(header, mpegSequenceStart):
+		return &Container{Name: "mpeg", MimeType: "video/mpeg", Extensions: mpegPSExtensions}
+
+	case isMPEGTS(header, 0, mpegTSPacketSize):
+		return &Container{Name: "mpegts", MimeType: "video/mp2t", Extensions: mpegTSExtensions}
+
+	case isMPEGTS(header, 4, mpegM2TSPacketSize):
+		// M2TS每个TS包前有4字节时间戳
+		return &Container{Name: "m2ts", MimeType: "video/mp2t", Extensions: mpegTSExtensions}
+
+	case isADTS(header):
+		return &Container{Name: "aac", MimeType: "audio/aac", Extensions: []string{".aac"}}
+
+	case isMPEGAudioFrame(header):
+		return &Container{Name: "mp3", MimeType: "audio/mpeg", Extensions: []string{".mp3"}}
+	}
+
+	return nil
+}
+
+// Matches 扩展名是否与封装格式相符
+func (c *Container) Matches(ext string) bool {
+	for _, allowed := range c.Extensions {
+		if ext == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffISOBrand 根据ftyp的主品牌区分MP4、MOV、3GP和M4A
+func sniffISOBrand(brand string) *Container {
+	switch {
+	case brand == "M4A " || brand == "M4B ":
+		return &Container{Name: "m4a", MimeType: "audio/mp4", Extensions: isoExtensions}
+	case brand == "qt  ":
+		return &Container{Name: "mov", MimeType: "video/quicktime", Extensions: isoExtensions}
+	case len(brand) == 4 && (brand[:3] == "3gp" || brand[:3] == "3g2"):
+		return &Container{Name: "3gp", MimeType: "video/3gpp", Extensions: isoExtensions}
+	default:
+		return &Container{Name: "mp4", MimeType: "video/mp4", Extensions: isoExtensions}
+	}
+}
+
+// sniffID3 跳过ID3v2标签识别后面的音频数据，标签超出文件头时按MP3处理
+func sniffID3(header []byte) *Container {
+	if len(header) >= id3HeaderSize {
+		// 标签长度为4个字节的同步安全整数（每字节只用低7位），不含10字节的标签头
+		size := int(header[6]&0x7F)<<21 | int(header[7]&0x7F)<<14 | int(header[8]&0x7F)<<7 | int(header[9]&0x7F)
+		if end := id3HeaderSize + size; end+4 <= len(header) {
+			if container := SniffContainer(header[end:]); container != nil {
+				return container
+			}
+		}
+	}
+	return &Container{Name: "mp3", MimeType: "audio/mpeg", Extensions: id3Extensions}
+}
+
+// isADTS 是否以AAC的ADTS帧头开头：12位同步字，layer固定为0
+func isADTS(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xF6 == 0xF0
+}
+
+// isMPEGAudioFrame 是否以MPEG音频帧头开头：11位同步字，版本和layer不能为保留值
+func isMPEGAudioFrame(header []byte) bool {
+	if len(header) < 3 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := (header[1] >> 3) & 0x03
+	layer := (header[1] >> 1) & 0x03
+	bitrate := header[2] >> 4
+	return version != 0x01 && layer != 0x00 && bitrate != 0x0F
+}
+
+// isQuickTimeAtom 是否为可以出现在文件开头的QuickTime原子类型
+func isQuickTimeAtom(atom string) bool {
+	switch atom {
+	case "moov", "mdat", "free", "skip", "wide", "pnot":
+		return true
+	}
+	return false
+}
+
+// isMPEGTS 检查文件头中连续的TS包是否都以同步字节开头
+// 单个0x47太容易误判，要求至少连续两个包
+func isMPEGTS(header []byte, offset, packetSize int) bool {
+	packets := 0
+	for pos := offset; pos < len(header); pos += packetSize {
+		if header[pos] != mpegTSSyncByte {
+			return false
+		}
+		packets++
+	}
+	return packets >= 2
+}
@@ -138,9 +138,11 @@ class VideoConverter {
     }
     
     handleFile(file) {
-        // 验证文件类型
-        if (!file.type.startsWith('video/')) {
-            this.showToast('请选择视频文件', 'error');
+        // 验证文件类型（部分音频格式如AMR浏览器识别不出MIME类型，按扩展名兜底）
+        const audioExts = ['.wav', '.flac', '.m4a', '.ogg', '.opus', '.amr', '.mp3', '.aac', '.wma', '.caf'];
+        const ext = file.name.slice(file.name.lastIndexOf('.')).toLowerCase();
+        if (!file.type.startsWith('video/') && !file.type.startsWith('audio/') && !audioExts.includes(ext)) {
+            this.showToast('请选择视频或音频文件', 'error');
             return;
         }
         
@@ -287,8 +289,7 @@ class VideoConverter {
                     this.resetToUpload();
                 }
             } else {
-                // 文件转换
-                // 1. 上传文件（带进度显示）
+                // 文件转换：上传时携带转换参数，上传完成后直接进入转换队列
                 const uploadResponse = await this.uploadFile();
                 if (!uploadResponse.success) {
                     this.showToast(uploadResponse.message || '文件上传失败', 'error');
@@ -297,22 +298,8 @@ class VideoConverter {
                 }
                 
                 this.currentTaskId = uploadResponse.data.task_id;
-                
-                // 2. 开始转换
-                const convertResponse = await this.apiCall('/convert/file', 'POST', {
-                    task_id: this.currentTaskId,
-                    audio_codec: 'libmp3lame',
-                    audio_bitrate: document.getElementById('bitrate-select').value,
-                    sample_rate: document.getElementById('sample-rate-select').value
-                });
-                
-                if (convertResponse.success) {
-                    this.startProgressTracking();
-                    this.showToast('转换任务已开始', 'success');
-                } else {
-                    this.showToast(convertResponse.message || '开始转换失败', 'error');
-                    this.resetToUpload();
-                }
+                this.startProgressTracking();
+                this.showToast('转换任务已开始', 'success');
             }
             
         } catch (error) {
@@ -327,6 +314,9 @@ class VideoConverter {
         formData.append('file', this.currentFile);
         formData.append('title', document.getElementById('file-title').value || this.currentFile.name);
         formData.append('description', '通过前端界面上传的视频文件');
+        formData.append('audio_bitrate', document.getElementById('bitrate-select').value);
+        formData.append('sample_rate', document.getElementById('sample-rate-select').value);
+        formData.append('auto_convert', 'true');
         
         return new Promise((resolve, reject) => {
             const xhr = new XMLHttpRequest();
@@ -420,11 +410,13 @@ class VideoConverter {
         const progressFill = document.getElementById('progress-fill');
         
         const statusMap = {
+            'uploaded': '等待转换...',
             'queued': '排队中...',
             'processing': '转换中...',
             'completed': '转换完成',
             'failed': '转换失败',
-            'canceled': '已取消'
+            'canceled': '已取消',
+            'expired': '已过期'
         };
         
         statusText.textContent = statusMap[data.status] || data.status;
@@ -592,6 +584,7 @@ class VideoConverter {
                     <span>创建时间: ${this.formatDate(task.created_at)}</span>
                     <span>进度: ${Math.round(task.progress)}%</span>
                 </div>
+                ${task.expires_at && task.status !== 'expired' ? `<div class="task-meta"><span>文件保留至: ${this.formatDate(task.expires_at)}</span></div>` : ''}
                 ${this.getTaskActions(task)}
             </div>
         `).join('');
@@ -604,11 +597,13 @@ class VideoConverter {
     
     getStatusText(status) {
         const statusMap = {
+            'uploaded': '等待转换',
             'queued': '排队中',
             'processing': '处理中',
             'completed': '已完成',
             'failed': '失败',
-            'canceled': '已取消'
+            'canceled': '已取消',
+            'expired': '已过期'
         };
         return statusMap[status] || status;
     }
@@ -622,7 +617,7 @@ class VideoConverter {
                     </button>
                 </div>
             `;
-        } else if (task.status === 'queued' || task.status === 'processing') {
+        } else if (task.status === 'uploaded' || task.status === 'queued' || task.status === 'processing') {
             return `
                 <div class="task-actions">
                     <button class="task-btn cancel" onclick="app.cancelTask('${task.id}')">
@@ -655,8 +650,12 @@ class VideoConverter {
             // 从Content-Disposition头提取文件名
             let fileName = '转换后的音频.mp3';
             if (contentDisposition) {
-                const fileNameMatch = contentDisposition.match(/filename[^;=\n]*=((['"]).*?\2|[^;\n]*)/);
-                if (fileNameMatch && fileNameMatch[1]) {
+                // 优先使用 RFC 5987 编码的 filename*，其中保留了中文等非ASCII字符
+                const extMatch = contentDisposition.match(/filename\*=UTF-8''([^;\n]*)/i);
+                const fileNameMatch = contentDisposition.match(/filename=((['"]).*?\2|[^;\n]*)/);
+                if (extMatch && extMatch[1]) {
+                    fileName = decodeURIComponent(extMatch[1]);
+                } else if (fileNameMatch && fileNameMatch[1]) {
                     fileName = fileNameMatch[1].replace(/['"]/g, '');
                 }
             }